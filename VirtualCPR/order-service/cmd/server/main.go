@@ -1,58 +1,108 @@
 package main
 
 import (
-	"fmt"
-	"log"
+	"context"
+	"net/http"
 	"os"
+	"time"
 
-	"github.com/gin-gonic/gin"
-	_ "github.com/lib/pq"
 	"github.com/robaa12/keploy-ContractTesting-MicroServices/order-service/internal/handlers"
 	"github.com/robaa12/keploy-ContractTesting-MicroServices/order-service/internal/repository"
 	"github.com/robaa12/keploy-ContractTesting-MicroServices/order-service/internal/service"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/order-service/migrations"
 	"github.com/robaa12/keploy-ContractTesting-MicroServices/order-service/pkg/client"
-	"github.com/robaa12/keploy-ContractTesting-MicroServices/order-service/pkg/database"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/auth"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/config"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/database"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/health"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/httpserver"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/idempotency"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/lifecycle"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/logging"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/metrics"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/tracing"
 )
 
 func main() {
-	dbConfig := database.GetConfigFromEnv()
+	env := config.FromEnv()
+	loggingConfig := logging.ConfigFromEnv(env)
+	dbConfig := database.ConfigFromEnv(env, "order_service")
+	authConfig := auth.GetConfigFromEnv(env)
+	serviceClientConfig := auth.GetServiceClientConfigFromEnv(env, "order-service")
+	serverConfig := httpserver.ConfigFromEnv(env, "order-service", "8081")
+	userServiceURL := env.String("USER_SERVICE_URL", "http://localhost:8080")
+	userTimeout := env.Duration("USER_SERVICE_TIMEOUT", 5*time.Second)
+	paymentServiceURL := env.String("PAYMENT_SERVICE_URL", "http://localhost:8082")
+	paymentTimeout := env.Duration("PAYMENT_SERVICE_TIMEOUT", 10*time.Second)
+	idempotencyConfig := idempotency.ConfigFromEnv(env)
+	sagaConfig := service.SagaConfigFromEnv(env)
+	lifecycleConfig := lifecycle.ConfigFromEnv(env)
+	tracingConfig := tracing.ConfigFromEnv(env)
+	logging.Setup("order-service", loggingConfig)
+	if err := env.Err(); err != nil {
+		logging.Fatal("Invalid configuration", err)
+	}
+
+	// Tracing is stopped last so spans from the other shutdown hooks are flushed
+	app := lifecycle.New(lifecycleConfig)
+	shutdownTracing, err := tracing.Setup(context.Background(), serverConfig.Name, tracingConfig)
+	if err != nil {
+		logging.Fatal("Failed to setup tracing", err)
+	}
+	app.OnStop("tracing", shutdownTracing)
 
 	// Connect to the database
 	db, err := database.NewPostgresDB(dbConfig)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		logging.Fatal("Failed to connect to database", err)
 	}
-	defer db.Close()
+	serviceMetrics := metrics.New(serverConfig.Name)
+	serviceMetrics.RegisterDB(db, dbConfig.DBName)
+	app.OnStop("database", func(context.Context) error {
+		return db.Close()
+	})
 
-	if err := database.SetupSchema(db); err != nil {
-		log.Fatalf("Failed to setup schema: %v", err)
+	// Apply schema migrations, or run the migrate subcommand and exit
+	migrator, err := database.NewMigrator(db, migrations.Files)
+	if err != nil {
+		logging.Fatal("Failed to load migrations", err)
+	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := database.RunMigrateCommand(context.Background(), migrator, os.Args[2:], os.Stdout); err != nil {
+			logging.Fatal("Migration failed", err)
+		}
+		return
+	}
+	if err := database.EnsureSchema(context.Background(), migrator, dbConfig.AutoMigrate); err != nil {
+		logging.Fatal("Failed to prepare database schema", err)
 	}
 
-	userServiceURL := getEnvOrDefault("USER_SERVICE_URL", "http://localhost:8080")
-	userTimeout := 5
-	userClient := client.NewHttpUserClient(userServiceURL, userTimeout)
+	userClient := client.NewHttpUserClient(userServiceURL, userTimeout, serviceMetrics)
+	paymentClient := client.NewHttpPaymentClient(paymentServiceURL, paymentTimeout, serviceMetrics)
+	serviceTokens := auth.NewServiceTokens(serviceClientConfig, &http.Client{Transport: tracing.Transport(nil), Timeout: userTimeout})
 
+	// Checkouts left unfinished by a previous run are resumed right away. The
+	// runner stops before the database closes, storing where it got to.
 	orderRepo := repository.NewPostgresOrderRepository(db)
-	orderService := service.NewOrderService(orderRepo, userClient)
-	orderHandler := handlers.NewOrderHandler(*orderService)
+	checkoutSagas := service.NewCheckoutSagas(repository.NewPostgresSagaRepository(db), orderRepo, userClient, paymentClient, serviceTokens, sagaConfig)
+	app.OnStop("checkout sagas", checkoutSagas.Stop)
+	orderService := service.NewOrderService(orderRepo, userClient, paymentClient, checkoutSagas)
+	verifier := auth.NewVerifier(authConfig)
+	orderHandler := handlers.NewOrderHandler(*orderService, verifier, idempotency.NewStore(db, idempotencyConfig))
 
-	router := gin.Default()
-	router.Use(gin.Logger())
-	router.Use(gin.Recovery())
+	checker := health.NewChecker()
+	checker.Add("database", health.Database(db), health.Options{Timeout: 2 * time.Second, CacheTTL: 2 * time.Second})
+	healthClient := &http.Client{}
+	checker.Add("user-service", health.HTTP(healthClient, userServiceURL+"/healthz"), health.Options{Timeout: 2 * time.Second, CacheTTL: 5 * time.Second})
+	checker.Add("payment-service", health.HTTP(healthClient, paymentServiceURL+"/healthz"), health.Options{Timeout: 2 * time.Second, CacheTTL: 5 * time.Second})
 
+	router := httpserver.NewRouter(serverConfig, serviceMetrics)
+	checker.RegisterRoutes(router)
+	serviceMetrics.RegisterRoutes(router)
 	orderHandler.RegisterRoutes(router)
+	logging.RegisterRoutes(router.Group("", auth.Enforce(verifier, handlers.RoutePolicy)))
 
-	port := getEnvOrDefault("PORT", "8081")
-	log.Printf("Order service starting on port %s", port)
-	if err := router.Run(fmt.Sprintf(":%s", port)); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
-	}
-}
-
-func getEnvOrDefault(key, defaultValue string) string {
-	value := os.Getenv(key)
-	if value == "" {
-		return defaultValue
+	if err := app.Run(httpserver.New(serverConfig, router)); err != nil {
+		logging.Fatal("Server stopped with error", err)
 	}
-	return value
 }
@@ -1,37 +1,66 @@
 package handlers
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/robaa12/keploy-ContractTesting-MicroServices/order-service/internal/models"
 	"github.com/robaa12/keploy-ContractTesting-MicroServices/order-service/internal/service"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/apperrors"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/auth"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/idempotency"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/logging"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/pagination"
 )
 
 type OrderServiceInterface interface {
-	CreateOrder(req models.CreateOrderRequest) (models.OrderResponse, error)
-	GetOrder(id string) (models.OrderResponse, error)
-	GetOrderByUserID(userID string) ([]models.OrderResponse, error)
-	ListOrders() ([]models.OrderResponse, error)
-	UpdateOrderStatus(id string, status string) (models.OrderResponse, error)
-	DeleteOrder(id string) error
+	CreateOrder(ctx context.Context, req models.CreateOrderRequest) (models.OrderResponse, error)
+	GetOrder(ctx context.Context, id string) (models.OrderResponse, error)
+	GetOrderByUserID(ctx context.Context, userID string) ([]models.OrderResponse, error)
+	ListOrders(ctx context.Context, filter models.OrderFilter, params pagination.Params) ([]models.OrderResponse, *pagination.Cursor, error)
+	UpdateOrderStatus(ctx context.Context, id string, status string) (models.OrderResponse, error)
+	DeleteOrder(ctx context.Context, id string) error
+	Checkout(ctx context.Context, id string, req models.CheckoutRequest) (models.CheckoutResponse, error)
+	GetCheckout(ctx context.Context, id string) (models.CheckoutResponse, error)
 }
 
 type OrderHandler struct {
 	orderService service.OrderService
+	verifier     *auth.Verifier
+	idempotency  *idempotency.Store
 }
 
-func NewOrderHandler(orderService service.OrderService) *OrderHandler {
-	return &OrderHandler{orderService: orderService}
+func NewOrderHandler(orderService service.OrderService, verifier *auth.Verifier, keys *idempotency.Store) *OrderHandler {
+	return &OrderHandler{orderService: orderService, verifier: verifier, idempotency: keys}
+}
+
+// RoutePolicy declares who may call each order route. Support staff can read
+// any order but only admins can change them.
+var RoutePolicy = auth.Policy{
+	{Method: http.MethodPost, Path: "/api/orders", Roles: []auth.Role{auth.RoleCustomer, auth.RoleAdmin}},
+	{Method: http.MethodGet, Path: "/api/orders", Roles: []auth.Role{auth.RoleAdmin}},
+	{Method: http.MethodGet, Path: "/api/orders/:id", Roles: []auth.Role{auth.RoleCustomer, auth.RoleSupport, auth.RoleAdmin}},
+	{Method: http.MethodGet, Path: "/api/orders/user/:userId", Roles: []auth.Role{auth.RoleSupport, auth.RoleAdmin}, SelfParam: "userId"},
+	{Method: http.MethodPost, Path: "/api/orders/:id/checkout", Roles: []auth.Role{auth.RoleCustomer, auth.RoleAdmin}},
+	{Method: http.MethodGet, Path: "/api/orders/:id/checkout", Roles: []auth.Role{auth.RoleCustomer, auth.RoleSupport, auth.RoleAdmin}},
+	{Method: http.MethodPut, Path: "/api/orders/:id/status", Roles: []auth.Role{auth.RoleAdmin}},
+	{Method: http.MethodDelete, Path: "/api/orders/:id", Roles: []auth.Role{auth.RoleAdmin}},
+	{Method: http.MethodGet, Path: logging.LevelsPath, Roles: []auth.Role{auth.RoleAdmin}},
+	{Method: http.MethodPut, Path: logging.LoggerLevelPath, Roles: []auth.Role{auth.RoleAdmin}},
+	{Method: http.MethodDelete, Path: logging.LoggerLevelPath, Roles: []auth.Role{auth.RoleAdmin}},
 }
 
 func (h *OrderHandler) RegisterRoutes(router *gin.Engine) {
 	orders := router.Group("/api/orders")
+	orders.Use(auth.Enforce(h.verifier, RoutePolicy))
 	{
-		orders.POST("", h.CreateOrder)
+		orders.POST("", h.idempotency.Middleware(auth.CallerID), h.CreateOrder)
 		orders.GET("", h.ListOrders)
 		orders.GET("/:id", h.GetOrder)
 		orders.GET("/user/:userId", h.GetOrderByUser)
+		orders.POST("/:id/checkout", h.idempotency.Middleware(auth.CallerID), h.Checkout)
+		orders.GET("/:id/checkout", h.GetCheckout)
 		orders.PUT("/:id/status", h.UpdateOrderStatus)
 		orders.DELETE("/:id", h.DeleteOrder)
 	}
@@ -41,17 +70,19 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 	var request models.CreateOrderRequest
 
 	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(apperrors.InvalidRequest(err))
 		return
 	}
 
-	order, err := h.orderService.CreateOrder(request)
+	identity, _ := auth.IdentityFrom(c)
+	if !identity.CanWriteUser(request.UserID) {
+		c.Error(apperrors.Forbidden("cannot create orders for another user"))
+		return
+	}
+
+	order, err := h.orderService.CreateOrder(c.Request.Context(), request)
 	if err != nil {
-		statusCode := http.StatusInternalServerError
-		if err.Error() == "user not found" {
-			statusCode = http.StatusBadRequest
-		}
-		c.JSON(statusCode, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
@@ -61,13 +92,15 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 func (h *OrderHandler) GetOrder(c *gin.Context) {
 	id := c.Param("id")
 
-	order, err := h.orderService.GetOrder(id)
+	order, err := h.orderService.GetOrder(c.Request.Context(), id)
 	if err != nil {
-		statusCode := http.StatusInternalServerError
-		if err.Error() == "order not found" {
-			statusCode = http.StatusNotFound
-		}
-		c.JSON(statusCode, gin.H{"error": err.Error()})
+		c.Error(err)
+		return
+	}
+
+	identity, _ := auth.IdentityFrom(c)
+	if !identity.CanReadUser(order.UserID) {
+		c.Error(apperrors.Forbidden("cannot access another user's order"))
 		return
 	}
 	c.JSON(http.StatusOK, order)
@@ -76,59 +109,134 @@ func (h *OrderHandler) GetOrder(c *gin.Context) {
 func (h *OrderHandler) GetOrderByUser(c *gin.Context) {
 	userId := c.Param("userId")
 
-	orders, err := h.orderService.GetOrderByUserID(userId)
+	orders, err := h.orderService.GetOrderByUserID(c.Request.Context(), userId)
 	if err != nil {
-		statusCode := http.StatusInternalServerError
-		if err.Error() == "user not found" {
-			statusCode = http.StatusNotFound
-		}
-		c.JSON(statusCode, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusOK, orders)
 }
 
 func (h *OrderHandler) ListOrders(c *gin.Context) {
-	orders, err := h.orderService.ListOrders()
+	params, err := pagination.ParseParams(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	filter, err := parseOrderFilter(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, orders)
+	orders, next, err := h.orderService.ListOrders(c.Request.Context(), filter, params)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, pagination.NewPage(c, orders, params, next))
+}
+
+func parseOrderFilter(c *gin.Context) (models.OrderFilter, error) {
+	filter := models.OrderFilter{Status: c.Query("status")}
+	if filter.Status != "" && !models.IsValidOrderStatus(filter.Status) {
+		return models.OrderFilter{}, apperrors.Validation("status must be one of: pending processing cancelled completed")
+	}
+
+	var err error
+	if filter.CreatedFrom, err = pagination.ParseTime(c, "created_from"); err != nil {
+		return models.OrderFilter{}, err
+	}
+	if filter.CreatedTo, err = pagination.ParseTime(c, "created_to"); err != nil {
+		return models.OrderFilter{}, err
+	}
+	return filter, nil
 }
 
 func (h *OrderHandler) UpdateOrderStatus(c *gin.Context) {
 	id := c.Param("id")
 	var request models.UpdateOrderRequest
 	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(apperrors.InvalidRequest(err))
 		return
 	}
 
-	order, err := h.orderService.UpdateOrderStatus(id, request.Status)
+	order, err := h.orderService.UpdateOrderStatus(c.Request.Context(), id, request.Status)
 	if err != nil {
-		statusCode := http.StatusInternalServerError
-		if err.Error() == "order not found" {
-			statusCode = http.StatusNotFound
-		}
-		c.JSON(statusCode, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
 	c.JSON(http.StatusOK, order)
 }
 
+// Checkout pays for the order with the card in the request. It answers 200
+// once the checkout has finished, and 202 while it is still running, for
+// example waiting for 3-D Secure with the payment's client_secret in the
+// response. A checkout that fails answers with the reason, such as 402 for a
+// declined card, after the order has been cancelled.
+func (h *OrderHandler) Checkout(c *gin.Context) {
+	id := c.Param("id")
+	var request models.CheckoutRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.Error(apperrors.InvalidRequest(err))
+		return
+	}
+
+	order, err := h.orderService.GetOrder(c.Request.Context(), id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	identity, _ := auth.IdentityFrom(c)
+	if !identity.CanWriteUser(order.UserID) {
+		c.Error(apperrors.Forbidden("cannot check out another user's order"))
+		return
+	}
+
+	checkout, err := h.orderService.Checkout(c.Request.Context(), id, request)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	status := http.StatusAccepted
+	if checkout.Checkout.Status.Finished() {
+		status = http.StatusOK
+	}
+	c.JSON(status, checkout)
+}
+
+// GetCheckout returns the order's latest checkout, for clients following one
+// that was still running.
+func (h *OrderHandler) GetCheckout(c *gin.Context) {
+	id := c.Param("id")
+
+	order, err := h.orderService.GetOrder(c.Request.Context(), id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	identity, _ := auth.IdentityFrom(c)
+	if !identity.CanReadUser(order.UserID) {
+		c.Error(apperrors.Forbidden("cannot access another user's order"))
+		return
+	}
+
+	checkout, err := h.orderService.GetCheckout(c.Request.Context(), id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, checkout)
+}
+
 func (h *OrderHandler) DeleteOrder(c *gin.Context) {
 	id := c.Param("id")
 
-	err := h.orderService.DeleteOrder(id)
+	err := h.orderService.DeleteOrder(c.Request.Context(), id)
 	if err != nil {
-		statusCode := http.StatusInternalServerError
-		if err.Error() == "order not found" {
-			statusCode = http.StatusNotFound
-		}
-		c.JSON(statusCode, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
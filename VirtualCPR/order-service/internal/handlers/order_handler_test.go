@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/order-service/internal/models"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/order-service/internal/repository"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/order-service/internal/service"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/order-service/pkg/client"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/apperrors"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/auth"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/httpserver"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/metrics"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/pagination"
+)
+
+// stubOrders answers from orders unless an error is set for the method, which
+// it then fails with the way the Postgres repository would.
+type stubOrders struct {
+	orders map[string]models.Order
+	errs   map[string]error
+}
+
+var _ repository.OrderRepository = stubOrders{}
+
+func (r stubOrders) CreateOrder(ctx context.Context, order models.Order) (models.Order, error) {
+	return order, r.errs["CreateOrder"]
+}
+
+func (r stubOrders) GetOrderByID(ctx context.Context, orderID string) (models.Order, error) {
+	if err := r.errs["GetOrderByID"]; err != nil {
+		return models.Order{}, err
+	}
+	order, ok := r.orders[orderID]
+	if !ok {
+		return models.Order{}, apperrors.NotFound("order not found")
+	}
+	return order, nil
+}
+
+func (r stubOrders) GetOrdersByUserID(ctx context.Context, userID string) ([]models.Order, error) {
+	return nil, r.errs["GetOrdersByUserID"]
+}
+
+func (r stubOrders) ListOrders(ctx context.Context, filter models.OrderFilter, params pagination.Params) ([]models.Order, error) {
+	return nil, r.errs["ListOrders"]
+}
+
+func (r stubOrders) UpdateOrderStatus(ctx context.Context, orderID, status string, from []string) error {
+	return r.errs["UpdateOrderStatus"]
+}
+
+func (r stubOrders) DeleteOrder(ctx context.Context, orderID string) error {
+	return r.errs["DeleteOrder"]
+}
+
+// stubUsers stands in for user-service, failing every lookup with err when
+// it is set.
+type stubUsers struct {
+	err error
+}
+
+func (u stubUsers) ValidateUser(ctx context.Context, userID string) (client.User, error) {
+	if u.err != nil {
+		return client.User{}, u.err
+	}
+	return client.User{ID: userID, Name: "Ada", Email: "ada@example.com"}, nil
+}
+
+const handlerTestSecret = "handler-test-secret-at-least-32-bytes"
+
+func TestHandlersMapErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keys, err := auth.NewKeyManager(auth.KeyConfig{Algorithm: auth.AlgorithmHS256, Secret: handlerTestSecret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cause := errors.New("dial tcp 10.0.0.7:5432: connection refused")
+	order := `{"user_id":"user-1","products":[{"id":"p-1","name":"Book","price":12.5,"quantity":1}]}`
+	tests := []struct {
+		name     string
+		as       auth.Role
+		method   string
+		path     string
+		body     string
+		errs     map[string]error
+		usersErr error
+		status   int
+		fields   []string
+	}{
+		{"found", auth.RoleCustomer, http.MethodGet, "/api/orders/order-1", "", nil, nil, http.StatusOK, nil},
+		{"missing row", auth.RoleCustomer, http.MethodGet, "/api/orders/order-9", "", map[string]error{"GetOrderByID": fmt.Errorf("scan order: %w", sql.ErrNoRows)}, nil, http.StatusNotFound, nil},
+		{"another user's order", auth.RoleCustomer, http.MethodGet, "/api/orders/order-2", "", nil, nil, http.StatusForbidden, nil},
+		{"create", auth.RoleCustomer, http.MethodPost, "/api/orders", order, nil, nil, http.StatusCreated, nil},
+		{"invalid body", auth.RoleCustomer, http.MethodPost, "/api/orders", `{"products":[]}`, nil, nil, http.StatusBadRequest, []string{"user_id", "products"}},
+		{"unknown user", auth.RoleAdmin, http.MethodPost, "/api/orders", order, nil, apperrors.NotFound("user not found"), http.StatusBadRequest, nil},
+		{"user-service down", auth.RoleCustomer, http.MethodPost, "/api/orders", order, nil, apperrors.Upstream("failed to call user service", cause), http.StatusBadGateway, nil},
+		{"database down", auth.RoleCustomer, http.MethodPost, "/api/orders", order, map[string]error{"CreateOrder": cause}, nil, http.StatusInternalServerError, nil},
+		{"status set by checkout", auth.RoleAdmin, http.MethodPut, "/api/orders/order-1/status", `{"status":"completed"}`, nil, nil, http.StatusBadRequest, []string{"status"}},
+		{"checked out order", auth.RoleAdmin, http.MethodPut, "/api/orders/order-2/status", `{"status":"cancelled"}`, nil, nil, http.StatusConflict, nil},
+		// Checkout reserved the order after the handler read it
+		{"lost race with checkout", auth.RoleAdmin, http.MethodPut, "/api/orders/order-1/status", `{"status":"cancelled"}`, map[string]error{"UpdateOrderStatus": apperrors.Conflict("the order's status cannot be changed from its current one")}, nil, http.StatusConflict, nil},
+		{"delete missing", auth.RoleAdmin, http.MethodDelete, "/api/orders/order-9", "", map[string]error{"DeleteOrder": sql.ErrNoRows}, nil, http.StatusNotFound, nil},
+		{"unknown status filter", auth.RoleAdmin, http.MethodGet, "/api/orders?status=shipped", "", nil, nil, http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := stubOrders{
+				orders: map[string]models.Order{
+					"order-1": {ID: "order-1", UserID: "user-1", Status: "pending"},
+					"order-2": {ID: "order-2", UserID: "user-2", Status: "completed", PaymentID: "payment-1"},
+				},
+				errs: tt.errs,
+			}
+			orders := service.NewOrderService(repo, stubUsers{err: tt.usersErr}, nil, nil)
+			router := httpserver.NewRouter(httpserver.Config{Name: "order-service"}, metrics.New("order-service"))
+			NewOrderHandler(*orders, auth.NewVerifier(auth.Config{Secret: handlerTestSecret}), nil).RegisterRoutes(router)
+
+			token, _, err := keys.Issue("user-1", "", tt.as)
+			if err != nil {
+				t.Fatal(err)
+			}
+			request := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			request.Header.Set("Content-Type", "application/json")
+			request.Header.Set("Authorization", "Bearer "+token)
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != tt.status {
+				t.Fatalf("status = %d, want %d; body = %s", recorder.Code, tt.status, recorder.Body)
+			}
+			if tt.status < http.StatusBadRequest {
+				return
+			}
+			if got := recorder.Header().Get("Content-Type"); got != apperrors.ProblemContentType {
+				t.Errorf("Content-Type = %q, want %q", got, apperrors.ProblemContentType)
+			}
+			var problem apperrors.Problem
+			if err := json.Unmarshal(recorder.Body.Bytes(), &problem); err != nil {
+				t.Fatalf("decoding problem: %v", err)
+			}
+			var fields []string
+			for _, field := range problem.Errors {
+				fields = append(fields, field.Field)
+			}
+			if fmt.Sprint(fields) != fmt.Sprint(tt.fields) {
+				t.Errorf("invalid fields = %v, want %v", fields, tt.fields)
+			}
+			if strings.Contains(recorder.Body.String(), "connection refused") {
+				t.Errorf("response leaks the cause: %s", recorder.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/auth"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/logging"
+)
+
+func TestRoutePolicy(t *testing.T) {
+	const self, other = "user-1", "user-2"
+	callers := map[string]*auth.Identity{
+		"anonymous": nil,
+		"customer":  {UserID: self, Role: auth.RoleCustomer},
+		"support":   {UserID: "support-1", Role: auth.RoleSupport},
+		"admin":     {UserID: "admin-1", Role: auth.RoleAdmin},
+	}
+	tests := []struct {
+		method  string
+		path    string
+		params  gin.Params
+		allowed []string
+	}{
+		{http.MethodPost, "/api/orders", nil, []string{"customer", "admin"}},
+		{http.MethodGet, "/api/orders", nil, []string{"admin"}},
+		{http.MethodGet, "/api/orders/:id", nil, []string{"customer", "support", "admin"}},
+		{http.MethodGet, "/api/orders/user/:userId", gin.Params{{Key: "userId", Value: self}}, []string{"customer", "support", "admin"}},
+		{http.MethodGet, "/api/orders/user/:userId", gin.Params{{Key: "userId", Value: other}}, []string{"support", "admin"}},
+		{http.MethodPost, "/api/orders/:id/checkout", nil, []string{"customer", "admin"}},
+		{http.MethodGet, "/api/orders/:id/checkout", nil, []string{"customer", "support", "admin"}},
+		// Support can read orders but not change them
+		{http.MethodPut, "/api/orders/:id/status", nil, []string{"admin"}},
+		{http.MethodDelete, "/api/orders/:id", nil, []string{"admin"}},
+		{http.MethodGet, logging.LevelsPath, nil, []string{"admin"}},
+		{http.MethodPut, logging.LoggerLevelPath, nil, []string{"admin"}},
+		{http.MethodDelete, logging.LoggerLevelPath, nil, []string{"admin"}},
+		// Routes without a rule are denied to everyone
+		{http.MethodPatch, "/api/orders/:id", nil, nil},
+	}
+
+	covered := map[string]bool{}
+	for _, tt := range tests {
+		covered[tt.method+" "+tt.path] = true
+		for name, identity := range callers {
+			want := false
+			for _, allowed := range tt.allowed {
+				want = want || allowed == name
+			}
+			err := RoutePolicy.Authorize(tt.method, tt.path, identity, tt.params)
+			if (err == nil) != want {
+				t.Errorf("%s %s %v as %s: error = %v, want allowed = %t", tt.method, tt.path, tt.params, name, err, want)
+			}
+		}
+	}
+	for _, rule := range RoutePolicy {
+		if !covered[rule.Method+" "+rule.Path] {
+			t.Errorf("route %s %s has no test case", rule.Method, rule.Path)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/order-service/internal/repository"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/order-service/internal/service"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/order-service/pkg/client"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/auth"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/database"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/httpserver"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/metrics"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/requestid"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/tracing"
+)
+
+// exportedSpan is the part of a file exporter line the test looks at.
+type exportedSpan struct {
+	Name        string
+	SpanKind    int
+	SpanContext struct{ TraceID, SpanID string }
+	Parent      struct{ TraceID, SpanID string }
+}
+
+const (
+	spanKindServer = 2
+	spanKindClient = 3
+)
+
+func TestGetOrderTrace(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const (
+		traceID      = "4bf92f3577b34da6a3ce929d0e0e4736"
+		remoteSpanID = "00f067aa0ba902b7"
+		secret       = "tracing-test-secret-at-least-32-bytes"
+	)
+
+	traceFile := filepath.Join(t.TempDir(), "traces.jsonl")
+	shutdown, err := tracing.Setup(context.Background(), "order-service", tracing.Config{Exporter: tracing.ExporterFile, File: traceFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userServiceHeaders := make(chan http.Header, 1)
+	userService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userServiceHeaders <- r.Header.Clone()
+		json.NewEncoder(w).Encode(client.User{ID: "user-1", Name: "Ada", Email: "ada@example.com"})
+	}))
+	defer userService.Close()
+
+	db, err := database.Open("tracing-test", "", "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	serviceMetrics := metrics.New("order-service")
+	orders := service.NewOrderService(
+		repository.NewPostgresOrderRepository(db),
+		client.NewHttpUserClient(userService.URL, time.Second, serviceMetrics),
+		nil,
+		nil,
+	)
+	keys, err := auth.NewKeyManager(auth.KeyConfig{Algorithm: auth.AlgorithmHS256, Secret: secret, Issuer: "user-service", TTL: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := keys.Issue("user-1", "ada@example.com", auth.RoleCustomer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := httpserver.NewRouter(httpserver.Config{Name: "order-service"}, serviceMetrics)
+	NewOrderHandler(*orders, auth.NewVerifier(auth.Config{Secret: secret, Issuer: "user-service"}), nil).RegisterRoutes(router)
+
+	request := httptest.NewRequest(http.MethodGet, "/api/orders/order-1", nil)
+	request.Header.Set("Authorization", "Bearer "+token)
+	request.Header.Set("traceparent", "00-"+traceID+"-"+remoteSpanID+"-01")
+	request.Header.Set(requestid.Header, "checkout-42")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", recorder.Code, recorder.Body.String())
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := readSpans(t, traceFile)
+	var server, query, outbound *exportedSpan
+	for i, span := range spans {
+		if span.SpanContext.TraceID != traceID {
+			t.Errorf("span %q is in trace %s, want %s", span.Name, span.SpanContext.TraceID, traceID)
+		}
+		switch {
+		case span.SpanKind == spanKindServer:
+			server = &spans[i]
+		case strings.HasPrefix(span.Name, "sql."):
+			query = &spans[i]
+		case span.SpanKind == spanKindClient:
+			outbound = &spans[i]
+		}
+	}
+	if server == nil || query == nil || outbound == nil {
+		t.Fatalf("want server, query and outbound spans, got %+v", spans)
+	}
+
+	if server.Name != "/api/orders/:id" {
+		t.Errorf("server span name = %q, want the route template", server.Name)
+	}
+	if server.Parent.SpanID != remoteSpanID {
+		t.Errorf("server span parent = %s, want the incoming traceparent's span %s", server.Parent.SpanID, remoteSpanID)
+	}
+	if query.Parent.SpanID != server.SpanContext.SpanID {
+		t.Errorf("query span parent = %s, want the server span %s", query.Parent.SpanID, server.SpanContext.SpanID)
+	}
+	if outbound.Parent.SpanID != server.SpanContext.SpanID {
+		t.Errorf("user-service call parent = %s, want the server span %s", outbound.Parent.SpanID, server.SpanContext.SpanID)
+	}
+
+	headers := <-userServiceHeaders
+	if want := "00-" + traceID + "-" + outbound.SpanContext.SpanID + "-01"; headers.Get("traceparent") != want {
+		t.Errorf("user-service traceparent = %q, want %q", headers.Get("traceparent"), want)
+	}
+	if headers.Get("Authorization") != "Bearer "+token {
+		t.Error("user-service call did not carry the caller's token")
+	}
+	if headers.Get(requestid.Header) != "checkout-42" || recorder.Header().Get(requestid.Header) != "checkout-42" {
+		t.Errorf("request ID sent to user-service = %q and echoed = %q, want the caller's %q",
+			headers.Get(requestid.Header), recorder.Header().Get(requestid.Header), "checkout-42")
+	}
+}
+
+func readSpans(t *testing.T, path string) []exportedSpan {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var spans []exportedSpan
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var span exportedSpan
+		if err := json.Unmarshal(scanner.Bytes(), &span); err != nil {
+			t.Fatalf("decoding span: %v", err)
+		}
+		spans = append(spans, span)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return spans
+}
+
+// The stand-in driver answers the order lookup with one row, so the
+// repository runs its real query through the traced pool without Postgres.
+func init() {
+	sql.Register("tracing-test", orderDriver{})
+}
+
+type orderDriver struct{}
+
+func (orderDriver) Open(string) (driver.Conn, error) { return orderConn{}, nil }
+
+type orderConn struct{}
+
+func (orderConn) Prepare(query string) (driver.Stmt, error) { return orderStmt{}, nil }
+func (orderConn) Close() error                              { return nil }
+func (orderConn) Begin() (driver.Tx, error)                 { return nil, driver.ErrSkip }
+
+type orderStmt struct{}
+
+func (orderStmt) Close() error                               { return nil }
+func (orderStmt) NumInput() int                              { return -1 }
+func (orderStmt) Exec([]driver.Value) (driver.Result, error) { return nil, driver.ErrSkip }
+func (orderStmt) Query([]driver.Value) (driver.Rows, error)  { return &orderRows{}, nil }
+
+type orderRows struct{ done bool }
+
+func (*orderRows) Columns() []string {
+	return []string{"id", "user_id", "products", "total_amount", "status", "payment_id", "created_at", "updated_at"}
+}
+
+func (*orderRows) Close() error { return nil }
+
+func (r *orderRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	now := time.Now()
+	copy(dest, []driver.Value{"order-1", "user-1", []byte(`[]`), 0.0, "pending", "", now, now})
+	return nil
+}
@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+	"math"
+	"time"
+)
 
 type Order struct {
 	ID          string    `json:"id"`
@@ -8,6 +11,7 @@ type Order struct {
 	Products    []Product `json:"products"`
 	TotalAmount float64   `json:"total_amount"`
 	Status      string    `json:"status"`
+	PaymentID   string    `json:"payment_id,omitempty"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdateAt    time.Time `json:"updated_at"`
 }
@@ -19,13 +23,44 @@ type Product struct {
 	Quantity int     `json:"quantity"`
 }
 
+// IsValidOrderStatus reports whether status is one an order can be in. An
+// order is processing while a checkout holds it and completed once checkout
+// has paid for it; only checkout sets either.
+func IsValidOrderStatus(status string) bool {
+	switch status {
+	case "pending", "processing", "cancelled", "completed":
+		return true
+	}
+	return false
+}
+
+// ManualStatusSources returns the statuses an order may be in to be set to
+// status through PUT /api/orders/:id/status, or nil if it cannot be set that
+// way. Processing and completed orders belong to their checkout: moving them
+// would strand a running saga or a captured payment, and a paid order set
+// back to pending could be checked out again.
+func ManualStatusSources(status string) []string {
+	switch status {
+	case "pending", "cancelled":
+		return []string{"pending", "cancelled"}
+	}
+	return nil
+}
+
+// OrderFilter narrows ListOrders by status and creation time range.
+type OrderFilter struct {
+	Status      string
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+}
+
 type CreateOrderRequest struct {
 	UserID   string    `json:"user_id" binding:"required"`
 	Products []Product `json:"products" binding:"required,min=1"`
 }
 
 type UpdateOrderRequest struct {
-	Status string `json:"status" binding:"required,oneof=pending cancelled completed"`
+	Status string `json:"status" binding:"required,oneof=pending cancelled"`
 }
 
 type OrderResponse struct {
@@ -36,10 +71,35 @@ type OrderResponse struct {
 	Products    []Product `json:"products"`
 	TotalAmount float64   `json:"total_amount"`
 	Status      string    `json:"status"`
+	PaymentID   string    `json:"payment_id,omitempty"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdateAt    time.Time `json:"updated_at"`
 }
 
+type CheckoutRequest struct {
+	CardToken string `json:"card_token" binding:"required"`
+	// Currency defaults to usd.
+	Currency string `json:"currency,omitempty" binding:"omitempty,len=3"`
+}
+
+type CheckoutResponse struct {
+	Order    OrderResponse        `json:"order"`
+	Checkout CheckoutSagaResponse `json:"checkout"`
+	// Payment is omitted until the checkout has made one.
+	Payment *CheckoutPayment `json:"payment,omitempty"`
+}
+
+// CheckoutPayment is the part of payment-service's payment that checkout
+// returns.
+type CheckoutPayment struct {
+	ID       string `json:"id"`
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+	Status   string `json:"status"`
+	// ClientSecret lets the client finish a payment that requires 3-D Secure.
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
 func CalculateTotalAmount(products []Product) float64 {
 	var totalAmount float64
 	for _, p := range products {
@@ -47,3 +107,9 @@ func CalculateTotalAmount(products []Product) float64 {
 	}
 	return totalAmount
 }
+
+// AmountInCents converts a dollar amount, as stored in total_amount, to the
+// smallest currency unit that payment-service charges in.
+func AmountInCents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
@@ -0,0 +1,100 @@
+package models
+
+import "time"
+
+// SagaStatus is where a checkout saga stands as a whole.
+type SagaStatus string
+
+const (
+	// SagaStatusRunning is moving forward through the checkout steps.
+	SagaStatusRunning SagaStatus = "running"
+	// SagaStatusCompensating is undoing the steps of a failed checkout.
+	SagaStatusCompensating SagaStatus = "compensating"
+	// SagaStatusCompleted paid for the order and completed it.
+	SagaStatusCompleted SagaStatus = "completed"
+	// SagaStatusCompensated failed and undid everything it had done.
+	SagaStatusCompensated SagaStatus = "compensated"
+	// SagaStatusFailed could not undo a failed checkout and needs someone to
+	// look at it, for example to refund a payment by hand.
+	SagaStatusFailed SagaStatus = "failed"
+)
+
+// Finished reports whether the saga has nothing left to run.
+func (s SagaStatus) Finished() bool {
+	return s == SagaStatusCompleted || s == SagaStatusCompensated || s == SagaStatusFailed
+}
+
+// SagaStep is the next step a saga will run. The first four move the
+// checkout forward, the last two undo it.
+type SagaStep string
+
+const (
+	SagaStepValidateUser   SagaStep = "validate_user"
+	SagaStepReserve        SagaStep = "reserve"
+	SagaStepPay            SagaStep = "pay"
+	SagaStepConfirm        SagaStep = "confirm"
+	SagaStepReleasePayment SagaStep = "release_payment"
+	SagaStepCancelOrder    SagaStep = "cancel_order"
+	// SagaStepDone follows the last step of a finished saga.
+	SagaStepDone SagaStep = "done"
+)
+
+// CheckoutSaga is the persisted progress of one checkout of an order. Each
+// step is stored once it has run, so a saga interrupted by a crash resumes at
+// the step it was on.
+type CheckoutSaga struct {
+	ID      string
+	OrderID string
+	Status  SagaStatus
+	Step    SagaStep
+	// CardToken is what the pay step charges. It is cleared once the saga
+	// no longer needs it.
+	CardToken string
+	Currency  string
+	PaymentID string
+	// CallerID and CallerRole are who started the checkout. The steps
+	// themselves run as order-service.
+	CallerID   string
+	CallerRole string
+	// Attempts counts consecutive failures of the current step.
+	Attempts      int
+	LastError     string
+	NextAttemptAt time.Time
+	// LeaseUntil is when the runner working on the saga loses its claim on
+	// it. It is zero while no runner holds the saga.
+	LeaseUntil time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// NeedsCard reports whether the saga may still have to pay, and so keep its
+// card token: it is running and has not got past the pay step.
+func (s CheckoutSaga) NeedsCard() bool {
+	if s.Status != SagaStatusRunning {
+		return false
+	}
+	return s.Step == SagaStepValidateUser || s.Step == SagaStepReserve || s.Step == SagaStepPay
+}
+
+// CheckoutSagaResponse is the public view of a checkout saga.
+type CheckoutSagaResponse struct {
+	ID        string     `json:"id"`
+	Status    SagaStatus `json:"status"`
+	Step      SagaStep   `json:"step"`
+	PaymentID string     `json:"payment_id,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+func (s *CheckoutSaga) ToCheckoutSagaResponse() CheckoutSagaResponse {
+	return CheckoutSagaResponse{
+		ID:        s.ID,
+		Status:    s.Status,
+		Step:      s.Step,
+		PaymentID: s.PaymentID,
+		LastError: s.LastError,
+		CreatedAt: s.CreatedAt,
+		UpdatedAt: s.UpdatedAt,
+	}
+}
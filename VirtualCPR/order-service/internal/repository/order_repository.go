@@ -1,35 +1,41 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"github.com/robaa12/keploy-ContractTesting-MicroServices/order-service/internal/models"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/apperrors"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/pagination"
 )
 
 type OrderRepository interface {
-	CreateOrder(order models.Order) (models.Order, error)
-	GetOrderByID(orderID string) (models.Order, error)
-	GetOrdersByUserID(userID string) ([]models.Order, error)
-	ListOrders() ([]models.Order, error)
-	UpdateOrderStatus(orderID, status string) (models.Order, error)
-	DeleteOrder(orderID string) error
+	CreateOrder(ctx context.Context, order models.Order) (models.Order, error)
+	GetOrderByID(ctx context.Context, orderID string) (models.Order, error)
+	GetOrdersByUserID(ctx context.Context, userID string) ([]models.Order, error)
+	ListOrders(ctx context.Context, filter models.OrderFilter, params pagination.Params) ([]models.Order, error)
+	// UpdateOrderStatus sets the order's status if it is currently one of
+	// from, and reports a conflict otherwise.
+	UpdateOrderStatus(ctx context.Context, orderID, status string, from []string) error
+	DeleteOrder(ctx context.Context, orderID string) error
 }
 
 type PostgresOrderRepository struct {
 	db *sql.DB
 }
 
-func NewPostgresOrderRepository(db *sql.DB) PostgresOrderRepository {
-	return PostgresOrderRepository{
+func NewPostgresOrderRepository(db *sql.DB) *PostgresOrderRepository {
+	return &PostgresOrderRepository{
 		db: db,
 	}
 }
 
-func (r *PostgresOrderRepository) CreateOrder(order models.Order) (models.Order, error) {
+func (r *PostgresOrderRepository) CreateOrder(ctx context.Context, order models.Order) (models.Order, error) {
 	query := `INSERT INTO orders (id, user_id, products, total_amount, status, created_at, updated_at)
               VALUES ($1, $2, $3, $4, $5, $6, $7)
               RETURNING id, user_id, products, total_amount, status, created_at, updated_at`
@@ -52,7 +58,7 @@ func (r *PostgresOrderRepository) CreateOrder(order models.Order) (models.Order,
 	}
 
 	var returnedProductsJSON []byte
-	err = r.db.QueryRow(query, order.ID, order.UserID, productsJSON, order.TotalAmount, order.Status, order.CreatedAt, order.UpdateAt).Scan(&order.ID, &order.UserID, &returnedProductsJSON, &order.TotalAmount, &order.Status, &order.CreatedAt, &order.UpdateAt)
+	err = r.db.QueryRowContext(ctx, query, order.ID, order.UserID, productsJSON, order.TotalAmount, order.Status, order.CreatedAt, order.UpdateAt).Scan(&order.ID, &order.UserID, &returnedProductsJSON, &order.TotalAmount, &order.Status, &order.CreatedAt, &order.UpdateAt)
 
 	if err != nil {
 		return models.Order{}, err
@@ -64,18 +70,18 @@ func (r *PostgresOrderRepository) CreateOrder(order models.Order) (models.Order,
 	return order, nil
 }
 
-func (r *PostgresOrderRepository) GetOrderByID(orderID string) (models.Order, error) {
-	query := `SELECT id, user_id, products, total_amount, status, created_at, updated_at
+func (r *PostgresOrderRepository) GetOrderByID(ctx context.Context, orderID string) (models.Order, error) {
+	query := `SELECT id, user_id, products, total_amount, status, COALESCE(payment_id, ''), created_at, updated_at
 			  FROM orders
 			  WHERE id = $1`
 
 	var order models.Order
 	var productsJSON []byte
-	err := r.db.QueryRow(query, orderID).Scan(&order.ID, &order.UserID, &productsJSON, &order.TotalAmount, &order.Status, &order.CreatedAt, &order.UpdateAt)
+	err := r.db.QueryRowContext(ctx, query, orderID).Scan(&order.ID, &order.UserID, &productsJSON, &order.TotalAmount, &order.Status, &order.PaymentID, &order.CreatedAt, &order.UpdateAt)
 
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return models.Order{}, errors.New("order not found")
+			return models.Order{}, apperrors.NotFound("order not found")
 		}
 		return models.Order{}, err
 	}
@@ -87,12 +93,12 @@ func (r *PostgresOrderRepository) GetOrderByID(orderID string) (models.Order, er
 	return order, nil
 }
 
-func (r *PostgresOrderRepository) GetOrdersByUserID(userID string) ([]models.Order, error) {
-	query := `SELECT id, user_id, products, total_amount, status, created_at, updated_at
+func (r *PostgresOrderRepository) GetOrdersByUserID(ctx context.Context, userID string) ([]models.Order, error) {
+	query := `SELECT id, user_id, products, total_amount, status, COALESCE(payment_id, ''), created_at, updated_at
 			  FROM orders
 			  WHERE user_id = $1`
 
-	rows, err := r.db.Query(query, userID)
+	rows, err := r.db.QueryContext(ctx, query, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -102,7 +108,7 @@ func (r *PostgresOrderRepository) GetOrdersByUserID(userID string) ([]models.Ord
 	for rows.Next() {
 		var order models.Order
 		var productsJSON []byte
-		if err = rows.Scan(&order.ID, &order.UserID, &productsJSON, &order.TotalAmount, &order.Status, &order.CreatedAt, &order.UpdateAt); err != nil {
+		if err = rows.Scan(&order.ID, &order.UserID, &productsJSON, &order.TotalAmount, &order.Status, &order.PaymentID, &order.CreatedAt, &order.UpdateAt); err != nil {
 			return nil, err
 		}
 
@@ -116,11 +122,23 @@ func (r *PostgresOrderRepository) GetOrdersByUserID(userID string) ([]models.Ord
 	return orders, nil
 }
 
-func (r *PostgresOrderRepository) ListOrders() ([]models.Order, error) {
-	query := `SELECT id, user_id, products, total_amount, status, created_at, updated_at
-			  FROM orders`
+// ListOrders returns one page of orders, newest first. It fetches one row more
+// than params.Limit so the caller can tell whether there is a next page.
+func (r *PostgresOrderRepository) ListOrders(ctx context.Context, filter models.OrderFilter, params pagination.Params) ([]models.Order, error) {
+	var builder pagination.Query
+	if filter.Status != "" {
+		builder.Where("status = ?", filter.Status)
+	}
+	if filter.CreatedFrom != nil {
+		builder.Where("created_at >= ?", *filter.CreatedFrom)
+	}
+	if filter.CreatedTo != nil {
+		builder.Where("created_at < ?", *filter.CreatedTo)
+	}
+	query := builder.Build(`SELECT id, user_id, products, total_amount, status, COALESCE(payment_id, ''), created_at, updated_at
+			  FROM orders`, params)
 
-	rows, err := r.db.Query(query)
+	rows, err := r.db.QueryContext(ctx, query, builder.Args...)
 	if err != nil {
 		return nil, err
 	}
@@ -130,7 +148,7 @@ func (r *PostgresOrderRepository) ListOrders() ([]models.Order, error) {
 	for rows.Next() {
 		var order models.Order
 		var productsJSON []byte
-		if err = rows.Scan(&order.ID, &order.UserID, &productsJSON, &order.TotalAmount, &order.Status, &order.CreatedAt, &order.UpdateAt); err != nil {
+		if err = rows.Scan(&order.ID, &order.UserID, &productsJSON, &order.TotalAmount, &order.Status, &order.PaymentID, &order.CreatedAt, &order.UpdateAt); err != nil {
 			return nil, err
 		}
 
@@ -147,10 +165,10 @@ func (r *PostgresOrderRepository) ListOrders() ([]models.Order, error) {
 	return orders, nil
 }
 
-func (r *PostgresOrderRepository) UpdateOrderStatus(id, status string) error {
-	query := `UPDATE orders SET status = $1, updated_at = $2 WHERE id = $3`
+func (r *PostgresOrderRepository) UpdateOrderStatus(ctx context.Context, id, status string, from []string) error {
+	query := `UPDATE orders SET status = $1, updated_at = $2 WHERE id = $3 AND status = ANY($4)`
 
-	result, err := r.db.Exec(query, status, time.Now(), id)
+	result, err := r.db.ExecContext(ctx, query, status, time.Now(), id, pq.Array(from))
 	if err != nil {
 		return err
 	}
@@ -160,15 +178,19 @@ func (r *PostgresOrderRepository) UpdateOrderStatus(id, status string) error {
 		return err
 	}
 	if rowsAffected == 0 {
-		return errors.New("order not found")
+		// Either the order is gone or it moved to a status it cannot leave
+		if _, err := r.GetOrderByID(ctx, id); err != nil {
+			return err
+		}
+		return apperrors.Conflict("the order's status cannot be changed from its current one")
 	}
 	return nil
 }
 
-func (r *PostgresOrderRepository) DeleteOrder(id string) error {
+func (r *PostgresOrderRepository) DeleteOrder(ctx context.Context, id string) error {
 	query := `DELETE FROM orders WHERE id = $1`
 
-	result, err := r.db.Exec(query, id)
+	result, err := r.db.ExecContext(ctx, query, id)
 	if err != nil {
 		return err
 	}
@@ -178,7 +200,7 @@ func (r *PostgresOrderRepository) DeleteOrder(id string) error {
 	}
 
 	if rowsAffected == 0 {
-		return errors.New("order not found")
+		return apperrors.NotFound("order not found")
 	}
 	return nil
 }
@@ -0,0 +1,268 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/order-service/internal/models"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/apperrors"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/database"
+)
+
+var (
+	// ErrCheckoutInProgress is returned when an order already has an
+	// unfinished checkout saga.
+	ErrCheckoutInProgress = apperrors.Conflict("order already has a checkout in progress")
+	// ErrSagaClaimed is returned by ClaimSaga when the saga has finished or
+	// another runner holds its lease.
+	ErrSagaClaimed = apperrors.Conflict("checkout is being processed")
+)
+
+// SagaRepository stores checkout sagas together with the order changes their
+// local steps make, so a step and the record that it ran commit together.
+type SagaRepository interface {
+	CreateSaga(ctx context.Context, saga models.CheckoutSaga) (models.CheckoutSaga, error)
+	GetSaga(ctx context.Context, id string) (models.CheckoutSaga, error)
+	GetLatestSagaByOrderID(ctx context.Context, orderID string) (models.CheckoutSaga, error)
+	// ClaimSaga leases an unfinished saga until leaseUntil, so no other
+	// runner works on it meanwhile, and returns it.
+	ClaimSaga(ctx context.Context, id string, now, leaseUntil time.Time) (models.CheckoutSaga, error)
+	// ListDueSagas returns up to limit unfinished, unleased sagas whose next
+	// attempt is due, oldest first.
+	ListDueSagas(ctx context.Context, now time.Time, limit int) ([]models.CheckoutSaga, error)
+	// UpdateSaga stores the saga's progress and lease. A zero LeaseUntil
+	// releases the saga to other runners.
+	UpdateSaga(ctx context.Context, saga models.CheckoutSaga) error
+	// ReserveOrder moves a pending order to processing.
+	ReserveOrder(ctx context.Context, orderID string) error
+	// CompleteOrder moves a processing order to completed and records its
+	// payment.
+	CompleteOrder(ctx context.Context, orderID, paymentID string) error
+	// CancelOrder cancels a pending or processing order. Orders in any other
+	// status are left alone.
+	CancelOrder(ctx context.Context, orderID string) error
+	// InTx runs fn with a repository whose queries share one transaction.
+	InTx(ctx context.Context, fn func(repo SagaRepository) error) error
+}
+
+type PostgresSagaRepository struct {
+	db *sql.DB
+	// q runs the queries: db itself, or the transaction started by InTx
+	q database.Querier
+}
+
+func NewPostgresSagaRepository(db *sql.DB) *PostgresSagaRepository {
+	return &PostgresSagaRepository{
+		db: db,
+		q:  db,
+	}
+}
+
+const sagaColumns = `id, order_id, status, step, card_token, currency, COALESCE(payment_id, ''), caller_id, caller_role,
+	attempts, last_error, next_attempt_at, lease_until, created_at, updated_at`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSaga(row scanner) (models.CheckoutSaga, error) {
+	var saga models.CheckoutSaga
+	var leaseUntil sql.NullTime
+	err := row.Scan(
+		&saga.ID,
+		&saga.OrderID,
+		&saga.Status,
+		&saga.Step,
+		&saga.CardToken,
+		&saga.Currency,
+		&saga.PaymentID,
+		&saga.CallerID,
+		&saga.CallerRole,
+		&saga.Attempts,
+		&saga.LastError,
+		&saga.NextAttemptAt,
+		&leaseUntil,
+		&saga.CreatedAt,
+		&saga.UpdatedAt,
+	)
+	saga.LeaseUntil = leaseUntil.Time
+	return saga, err
+}
+
+func (r *PostgresSagaRepository) CreateSaga(ctx context.Context, saga models.CheckoutSaga) (models.CheckoutSaga, error) {
+	query := `INSERT INTO checkout_sagas (id, order_id, status, step, card_token, currency, caller_id, caller_role,
+				  next_attempt_at, created_at, updated_at)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+			  RETURNING ` + sagaColumns
+	if saga.ID == "" {
+		saga.ID = uuid.New().String()
+	}
+	now := time.Now()
+	saga.NextAttemptAt = now
+	saga.CreatedAt = now
+	saga.UpdatedAt = now
+
+	created, err := scanSaga(r.q.QueryRowContext(ctx, query,
+		saga.ID,
+		saga.OrderID,
+		saga.Status,
+		saga.Step,
+		saga.CardToken,
+		saga.Currency,
+		saga.CallerID,
+		saga.CallerRole,
+		saga.NextAttemptAt,
+		saga.CreatedAt,
+		saga.UpdatedAt,
+	))
+	if err != nil {
+		if isUniqueViolation(err) {
+			return models.CheckoutSaga{}, ErrCheckoutInProgress
+		}
+		return models.CheckoutSaga{}, err
+	}
+	return created, nil
+}
+
+func (r *PostgresSagaRepository) GetSaga(ctx context.Context, id string) (models.CheckoutSaga, error) {
+	query := `SELECT ` + sagaColumns + `
+			  FROM checkout_sagas
+			  WHERE id = $1`
+	return r.getSaga(ctx, query, id)
+}
+
+func (r *PostgresSagaRepository) GetLatestSagaByOrderID(ctx context.Context, orderID string) (models.CheckoutSaga, error) {
+	query := `SELECT ` + sagaColumns + `
+			  FROM checkout_sagas
+			  WHERE order_id = $1
+			  ORDER BY created_at DESC
+			  LIMIT 1`
+	return r.getSaga(ctx, query, orderID)
+}
+
+func (r *PostgresSagaRepository) ClaimSaga(ctx context.Context, id string, now, leaseUntil time.Time) (models.CheckoutSaga, error) {
+	query := `UPDATE checkout_sagas SET lease_until = $1
+			  WHERE id = $2 AND status IN ($3, $4) AND (lease_until IS NULL OR lease_until < $5)
+			  RETURNING ` + sagaColumns
+	saga, err := scanSaga(r.q.QueryRowContext(ctx, query, leaseUntil, id, models.SagaStatusRunning, models.SagaStatusCompensating, now))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.CheckoutSaga{}, ErrSagaClaimed
+	}
+	return saga, err
+}
+
+func (r *PostgresSagaRepository) getSaga(ctx context.Context, query string, args ...any) (models.CheckoutSaga, error) {
+	saga, err := scanSaga(r.q.QueryRowContext(ctx, query, args...))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.CheckoutSaga{}, apperrors.NotFound("checkout not found")
+		}
+		return models.CheckoutSaga{}, err
+	}
+	return saga, nil
+}
+
+func (r *PostgresSagaRepository) ListDueSagas(ctx context.Context, now time.Time, limit int) ([]models.CheckoutSaga, error) {
+	query := `SELECT ` + sagaColumns + `
+			  FROM checkout_sagas
+			  WHERE status IN ($1, $2) AND next_attempt_at <= $3 AND (lease_until IS NULL OR lease_until < $3)
+			  ORDER BY next_attempt_at
+			  LIMIT $4`
+	rows, err := r.q.QueryContext(ctx, query, models.SagaStatusRunning, models.SagaStatusCompensating, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sagas []models.CheckoutSaga
+	for rows.Next() {
+		saga, err := scanSaga(rows)
+		if err != nil {
+			return nil, err
+		}
+		sagas = append(sagas, saga)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return sagas, nil
+}
+
+func (r *PostgresSagaRepository) UpdateSaga(ctx context.Context, saga models.CheckoutSaga) error {
+	query := `UPDATE checkout_sagas SET status = $1, step = $2, payment_id = $3, card_token = $4, attempts = $5, last_error = $6,
+				  next_attempt_at = $7, lease_until = $8, updated_at = $9
+			  WHERE id = $10`
+
+	var paymentID sql.NullString
+	if saga.PaymentID != "" {
+		paymentID = sql.NullString{String: saga.PaymentID, Valid: true}
+	}
+	var leaseUntil sql.NullTime
+	if !saga.LeaseUntil.IsZero() {
+		leaseUntil = sql.NullTime{Time: saga.LeaseUntil, Valid: true}
+	}
+	result, err := r.q.ExecContext(ctx, query, saga.Status, saga.Step, paymentID, saga.CardToken, saga.Attempts, saga.LastError,
+		saga.NextAttemptAt, leaseUntil, time.Now(), saga.ID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return apperrors.NotFound("checkout not found")
+	}
+	return nil
+}
+
+func (r *PostgresSagaRepository) ReserveOrder(ctx context.Context, orderID string) error {
+	query := `UPDATE orders SET status = 'processing', updated_at = $1 WHERE id = $2 AND status = 'pending'`
+	return r.moveOrder(ctx, query, "only a pending order can be checked out", time.Now(), orderID)
+}
+
+func (r *PostgresSagaRepository) CompleteOrder(ctx context.Context, orderID, paymentID string) error {
+	query := `UPDATE orders SET status = 'completed', payment_id = $1, updated_at = $2 WHERE id = $3 AND status = 'processing'`
+	return r.moveOrder(ctx, query, "the order was changed during checkout", paymentID, time.Now(), orderID)
+}
+
+func (r *PostgresSagaRepository) CancelOrder(ctx context.Context, orderID string) error {
+	query := `UPDATE orders SET status = 'cancelled', updated_at = $1 WHERE id = $2 AND status IN ('pending', 'processing')`
+	_, err := r.q.ExecContext(ctx, query, time.Now(), orderID)
+	return err
+}
+
+// moveOrder runs a conditional order update and reports conflict when the
+// order was not in the status it expects.
+func (r *PostgresSagaRepository) moveOrder(ctx context.Context, query, conflict string, args ...any) error {
+	result, err := r.q.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return apperrors.Conflict(conflict)
+	}
+	return nil
+}
+
+func (r *PostgresSagaRepository) InTx(ctx context.Context, fn func(repo SagaRepository) error) error {
+	if _, ok := r.q.(*sql.Tx); ok {
+		return fn(r)
+	}
+	return database.InTx(ctx, r.db, func(tx *sql.Tx) error {
+		return fn(&PostgresSagaRepository{db: r.db, q: tx})
+	})
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
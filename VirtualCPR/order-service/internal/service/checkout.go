@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/order-service/internal/models"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/order-service/pkg/client"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/apperrors"
+)
+
+const defaultCurrency = "usd"
+
+// Checkout pays for a pending order through payment-service. It runs the
+// checkout saga as far as it can go now: a payment waiting for 3-D Secure, or
+// a step waiting to be retried, leaves the saga running in the background and
+// the order processing until it completes or is cancelled. Checking out an
+// order whose checkout is already in progress returns that checkout. The
+// error is the reason the checkout failed, when it failed during this call.
+func (s *OrderService) Checkout(ctx context.Context, orderID string, request models.CheckoutRequest) (models.CheckoutResponse, error) {
+	order, err := s.repo.GetOrderByID(ctx, orderID)
+	if err != nil {
+		return models.CheckoutResponse{}, err
+	}
+	if order.Status != "pending" && order.Status != "processing" {
+		return models.CheckoutResponse{}, apperrors.Conflict(fmt.Sprintf("a %s order cannot be checked out", order.Status))
+	}
+
+	saga, payment, err := s.checkout.Start(ctx, order, request)
+	if err != nil {
+		return models.CheckoutResponse{}, err
+	}
+	return s.checkoutResponse(ctx, saga, payment)
+}
+
+// GetCheckout returns the latest checkout of an order, with its payment as
+// payment-service reports it now.
+func (s *OrderService) GetCheckout(ctx context.Context, orderID string) (models.CheckoutResponse, error) {
+	saga, err := s.checkout.Latest(ctx, orderID)
+	if err != nil {
+		return models.CheckoutResponse{}, err
+	}
+	var payment client.Payment
+	if saga.PaymentID != "" {
+		if payment, err = s.paymentClient.GetPayment(ctx, saga.PaymentID); err != nil {
+			return models.CheckoutResponse{}, err
+		}
+	}
+	return s.checkoutResponse(ctx, saga, payment)
+}
+
+func (s *OrderService) checkoutResponse(ctx context.Context, saga models.CheckoutSaga, payment client.Payment) (models.CheckoutResponse, error) {
+	order, err := s.GetOrder(ctx, saga.OrderID)
+	if err != nil {
+		return models.CheckoutResponse{}, err
+	}
+	response := models.CheckoutResponse{
+		Order:    order,
+		Checkout: saga.ToCheckoutSagaResponse(),
+	}
+	if payment.ID != "" {
+		response.Payment = &models.CheckoutPayment{
+			ID:           payment.ID,
+			Amount:       payment.Amount,
+			Currency:     payment.Currency,
+			Status:       payment.Status,
+			ClientSecret: payment.ClientSecret,
+		}
+	}
+	return response, nil
+}
@@ -0,0 +1,471 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/order-service/internal/models"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/order-service/internal/repository"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/order-service/pkg/client"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/apperrors"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/auth"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/config"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/logging"
+)
+
+const (
+	// sagaBatchSize bounds how many sagas one pass of the runner picks up.
+	sagaBatchSize = 50
+	// sagaRetryBase and sagaRetryMax bound the backoff between attempts of a
+	// failing step.
+	sagaRetryBase = 2 * time.Second
+	sagaRetryMax  = 5 * time.Minute
+)
+
+// errPaymentPending stops a saga until its payment leaves a status, such as
+// requires_action, that only the customer or the card network can change.
+var errPaymentPending = errors.New("payment is still in progress")
+
+type SagaConfig struct {
+	// PollInterval is how often unfinished sagas are looked for, and so how
+	// long a saga waiting on its payment waits between checks.
+	PollInterval time.Duration
+	// Lease is how long a runner may work on a saga before another may take
+	// it over, for example after the first one crashed.
+	Lease time.Duration
+	// MaxAttempts is how many times a step failing with a transient error is
+	// tried before the checkout is given up.
+	MaxAttempts int
+	// PaymentTimeout is how long a checkout waits for the customer to
+	// authenticate its payment.
+	PaymentTimeout time.Duration
+}
+
+// SagaConfigFromEnv reads CHECKOUT_SAGA_POLL_INTERVAL, CHECKOUT_SAGA_LEASE,
+// CHECKOUT_SAGA_MAX_ATTEMPTS and CHECKOUT_SAGA_PAYMENT_TIMEOUT.
+func SagaConfigFromEnv(env *config.Env) SagaConfig {
+	return SagaConfig{
+		PollInterval:   env.Duration("CHECKOUT_SAGA_POLL_INTERVAL", 5*time.Second),
+		Lease:          env.Duration("CHECKOUT_SAGA_LEASE", time.Minute),
+		MaxAttempts:    env.Int("CHECKOUT_SAGA_MAX_ATTEMPTS", 10),
+		PaymentTimeout: env.Duration("CHECKOUT_SAGA_PAYMENT_TIMEOUT", 30*time.Minute),
+	}
+}
+
+// CheckoutSagas runs checkouts as sagas: validate the user, reserve the
+// order, authorize the payment, then capture it and complete the order. Each
+// step is persisted once it has run, so a checkout interrupted by a crash or
+// a failing dependency is picked up again by the background runner. When a
+// step fails for good, the steps already run are undone: the payment is
+// voided or refunded and the order cancelled.
+//
+// The steps call the other services as order-service itself, not as the
+// caller who started the checkout: the caller's token expires long before a
+// saga resumed after a restart may need it, and a customer may not refund a
+// payment the saga has to undo.
+type CheckoutSagas struct {
+	repo          repository.SagaRepository
+	orders        repository.OrderRepository
+	userClient    client.UserClient
+	paymentClient client.PaymentClient
+	service       ServiceIdentity
+	config        SagaConfig
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// ServiceIdentity provides order-service's own identity, with a token the
+// saga steps call the other services with.
+type ServiceIdentity interface {
+	Identity(ctx context.Context) (auth.Identity, error)
+}
+
+// NewCheckoutSagas starts the background runner, which first resumes any
+// saga left unfinished by a previous run of the service.
+func NewCheckoutSagas(repo repository.SagaRepository, orders repository.OrderRepository, userClient client.UserClient, paymentClient client.PaymentClient, service ServiceIdentity, config SagaConfig) *CheckoutSagas {
+	ctx, cancel := context.WithCancel(context.Background())
+	sagas := &CheckoutSagas{
+		repo:          repo,
+		orders:        orders,
+		userClient:    userClient,
+		paymentClient: paymentClient,
+		service:       service,
+		config:        config,
+		ctx:           ctx,
+		cancel:        cancel,
+		done:          make(chan struct{}),
+	}
+	go sagas.run()
+	return sagas
+}
+
+// Stop cancels the sagas the runner is working on, which are stored to be
+// resumed later, and waits for it to end or for ctx to expire.
+func (s *CheckoutSagas) Stop(ctx context.Context) error {
+	s.cancel()
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Start begins a checkout of order on behalf of the caller in ctx and runs it
+// as far as it can go now. If the order already has a checkout in progress,
+// that one is run instead and request is ignored. The error is the one that
+// made the checkout fail, when it failed during this call.
+func (s *CheckoutSagas) Start(ctx context.Context, order models.Order, request models.CheckoutRequest) (models.CheckoutSaga, client.Payment, error) {
+	identity, ok := auth.IdentityFromContext(ctx)
+	if !ok {
+		return models.CheckoutSaga{}, client.Payment{}, apperrors.Unauthorized("missing caller identity")
+	}
+	saga, err := s.repo.CreateSaga(ctx, models.CheckoutSaga{
+		OrderID:    order.ID,
+		Status:     models.SagaStatusRunning,
+		Step:       models.SagaStepValidateUser,
+		CardToken:  request.CardToken,
+		Currency:   cmp.Or(request.Currency, defaultCurrency),
+		CallerID:   identity.UserID,
+		CallerRole: string(identity.Role),
+	})
+	if errors.Is(err, repository.ErrCheckoutInProgress) {
+		saga, err = s.repo.GetLatestSagaByOrderID(ctx, order.ID)
+	}
+	if err != nil {
+		return models.CheckoutSaga{}, client.Payment{}, err
+	}
+	// The checkout goes on even if the client goes away
+	return s.Run(context.WithoutCancel(ctx), saga.ID)
+}
+
+// Latest returns the most recent checkout of an order.
+func (s *CheckoutSagas) Latest(ctx context.Context, orderID string) (models.CheckoutSaga, error) {
+	return s.repo.GetLatestSagaByOrderID(ctx, orderID)
+}
+
+// Run claims a saga and runs its steps until it finishes or has to wait. A
+// saga another runner holds, or one already finished, is returned as stored.
+func (s *CheckoutSagas) Run(ctx context.Context, id string) (models.CheckoutSaga, client.Payment, error) {
+	now := time.Now()
+	saga, err := s.repo.ClaimSaga(ctx, id, now, now.Add(s.config.Lease))
+	if errors.Is(err, repository.ErrSagaClaimed) {
+		saga, err = s.repo.GetSaga(ctx, id)
+		return saga, client.Payment{}, err
+	}
+	if err != nil {
+		return models.CheckoutSaga{}, client.Payment{}, err
+	}
+	return s.execute(ctx, saga)
+}
+
+func (s *CheckoutSagas) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.config.PollInterval)
+	defer ticker.Stop()
+	for {
+		s.resume(s.ctx)
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// resume runs one batch of sagas whose next attempt is due.
+func (s *CheckoutSagas) resume(ctx context.Context) {
+	log := logging.For("checkout-saga")
+	due, err := s.repo.ListDueSagas(ctx, time.Now(), sagaBatchSize)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.ErrorContext(ctx, "Failed to list due checkouts", "error", err)
+		}
+		return
+	}
+	for _, saga := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		if _, _, err := s.Run(ctx, saga.ID); err != nil {
+			log.DebugContext(ctx, "Checkout run ended with error", "saga_id", saga.ID, "error", err)
+		}
+	}
+}
+
+// execute runs the steps of a claimed saga. A step that fails transiently is
+// retried with backoff by the runner; one that fails for good, or too often,
+// turns the saga to compensation, and a compensation that fails for good
+// leaves it failed. The lease is released whenever execute stops.
+func (s *CheckoutSagas) execute(ctx context.Context, saga models.CheckoutSaga) (models.CheckoutSaga, client.Payment, error) {
+	log := logging.For("checkout-saga")
+	var payment client.Payment
+	var failure error
+	for !saga.Status.Finished() {
+		err := s.step(ctx, &saga, &payment)
+		if err == nil {
+			continue
+		}
+
+		switch {
+		case ctx.Err() != nil:
+			// Stopped rather than failed; resume as soon as possible
+			saga.NextAttemptAt = time.Now()
+		case errors.Is(err, errPaymentPending):
+			saga.NextAttemptAt = time.Now().Add(s.config.PollInterval)
+		case transient(err) && saga.Attempts+1 < s.config.MaxAttempts:
+			saga.Attempts++
+			saga.LastError = apperrors.Message(err)
+			saga.NextAttemptAt = time.Now().Add(sagaBackoff(saga.Attempts))
+			log.WarnContext(ctx, "Checkout step failed, retrying", "saga_id", saga.ID, "step", saga.Step, "attempt", saga.Attempts, "error", err)
+		case saga.Status == models.SagaStatusRunning:
+			failure = err
+			log.InfoContext(ctx, "Checkout failed, compensating", "saga_id", saga.ID, "order_id", saga.OrderID, "step", saga.Step, "error", err)
+			saga.Status = models.SagaStatusCompensating
+			saga.Step = compensationStep(saga.Step)
+			saga.Attempts = 0
+			saga.LastError = apperrors.Message(err)
+			if err := s.save(ctx, &saga, nil); err != nil {
+				return saga, payment, err
+			}
+			continue
+		default:
+			log.ErrorContext(ctx, "Checkout compensation failed, needs manual attention", "saga_id", saga.ID, "order_id", saga.OrderID,
+				"step", saga.Step, "payment_id", saga.PaymentID, "error", err)
+			saga.Status = models.SagaStatusFailed
+			saga.LastError = apperrors.Message(err)
+			if failure == nil {
+				failure = err
+			}
+		}
+		break
+	}
+
+	saga.LeaseUntil = time.Time{}
+	if !saga.NeedsCard() {
+		saga.CardToken = ""
+	}
+	if err := s.repo.UpdateSaga(context.WithoutCancel(ctx), saga); err != nil {
+		return saga, payment, err
+	}
+	if saga.Status == models.SagaStatusCompleted {
+		log.InfoContext(ctx, "Checkout completed", "saga_id", saga.ID, "order_id", saga.OrderID, "payment_id", saga.PaymentID)
+	}
+	return saga, payment, failure
+}
+
+// step runs the saga's current step as order-service and, when it succeeds,
+// stores the saga moved to the next one.
+func (s *CheckoutSagas) step(ctx context.Context, saga *models.CheckoutSaga, payment *client.Payment) error {
+	identity, err := s.service.Identity(ctx)
+	if err != nil {
+		return apperrors.Upstream("failed to obtain a service token", err)
+	}
+	ctx = auth.WithIdentity(ctx, identity)
+
+	switch saga.Step {
+	case models.SagaStepValidateUser:
+		order, err := s.orders.GetOrderByID(ctx, saga.OrderID)
+		if err != nil {
+			return err
+		}
+		if _, err := s.userClient.ValidateUser(ctx, order.UserID); err != nil {
+			if errors.Is(err, apperrors.ErrNotFound) {
+				return apperrors.Validation("user not found")
+			}
+			return err
+		}
+		return s.advance(ctx, saga, models.SagaStepReserve, nil)
+
+	case models.SagaStepReserve:
+		return s.advance(ctx, saga, models.SagaStepPay, func(repo repository.SagaRepository) error {
+			return repo.ReserveOrder(ctx, saga.OrderID)
+		})
+
+	case models.SagaStepPay:
+		return s.pay(ctx, saga, payment)
+
+	case models.SagaStepConfirm:
+		return s.confirm(ctx, saga, payment)
+
+	case models.SagaStepReleasePayment:
+		return s.releasePayment(ctx, saga, payment)
+
+	case models.SagaStepCancelOrder:
+		return s.advance(ctx, saga, models.SagaStepDone, func(repo repository.SagaRepository) error {
+			return repo.CancelOrder(ctx, saga.OrderID)
+		})
+
+	default:
+		return fmt.Errorf("unknown checkout step %q", saga.Step)
+	}
+}
+
+// pay authorizes the order's amount. The idempotency key is derived from the
+// saga, so running the step again after a crash replays the payment already
+// made instead of charging twice.
+func (s *CheckoutSagas) pay(ctx context.Context, saga *models.CheckoutSaga, payment *client.Payment) error {
+	var err error
+	if saga.PaymentID == "" {
+		order, err := s.orders.GetOrderByID(ctx, saga.OrderID)
+		if err != nil {
+			return err
+		}
+		*payment, err = s.paymentClient.CreatePayment(ctx, client.CreatePaymentRequest{
+			UserID:        order.UserID,
+			OrderID:       order.ID,
+			Amount:        models.AmountInCents(order.TotalAmount),
+			Currency:      saga.Currency,
+			Desc:          "Order " + order.ID,
+			CardToken:     saga.CardToken,
+			CaptureMethod: client.CaptureManual,
+		}, "checkout-saga-"+saga.ID)
+		if err != nil {
+			return err
+		}
+		saga.PaymentID = payment.ID
+	} else {
+		*payment, err = s.paymentClient.GetPayment(ctx, saga.PaymentID)
+		if err != nil {
+			return err
+		}
+	}
+
+	switch payment.Status {
+	case client.PaymentStatusAuthorized:
+		return s.advance(ctx, saga, models.SagaStepConfirm, nil)
+	case client.PaymentStatusFailed, client.PaymentStatusVoided:
+		return apperrors.New(apperrors.ErrPaymentRequired, "the payment failed")
+	default:
+		if time.Since(saga.CreatedAt) > s.config.PaymentTimeout {
+			return apperrors.New(apperrors.ErrPaymentRequired, "the payment was not completed in time")
+		}
+		return errPaymentPending
+	}
+}
+
+// confirm captures the authorized payment and completes the order. A capture
+// that already happened, for example before a crash, is recognised from the
+// payment's status.
+func (s *CheckoutSagas) confirm(ctx context.Context, saga *models.CheckoutSaga, payment *client.Payment) error {
+	captured, err := s.paymentClient.CapturePayment(ctx, saga.PaymentID)
+	if errors.Is(err, apperrors.ErrConflict) {
+		captured, err = s.paymentClient.GetPayment(ctx, saga.PaymentID)
+		if err == nil && captured.Status != client.PaymentStatusCaptured {
+			err = apperrors.Conflict(fmt.Sprintf("a %s payment cannot be captured", captured.Status))
+		}
+	}
+	if err != nil {
+		return err
+	}
+	*payment = captured
+	return s.advance(ctx, saga, models.SagaStepDone, func(repo repository.SagaRepository) error {
+		return repo.CompleteOrder(ctx, saga.OrderID, saga.PaymentID)
+	})
+}
+
+// releasePayment voids the saga's payment if it is only authorized, or
+// refunds it if it was captured. A saga that failed before recording its
+// payment has none to release here; an authorization it may have left behind
+// is voided by payment-service once it expires.
+func (s *CheckoutSagas) releasePayment(ctx context.Context, saga *models.CheckoutSaga, payment *client.Payment) error {
+	if saga.PaymentID != "" {
+		current, err := s.paymentClient.GetPayment(ctx, saga.PaymentID)
+		if err != nil {
+			return err
+		}
+		switch current.Status {
+		// Voiding again finishes a void that was interrupted
+		case client.PaymentStatusAuthorized, client.PaymentStatusRequiresAction, client.PaymentStatusVoiding:
+			if current, err = s.paymentClient.VoidPayment(ctx, saga.PaymentID); err != nil {
+				return err
+			}
+		case client.PaymentStatusCaptured, client.PaymentStatusSucceeded, client.PaymentStatusPartiallyRefunded:
+			if err := s.paymentClient.RefundPayment(ctx, saga.PaymentID); err != nil {
+				return err
+			}
+		case client.PaymentStatusProcessing, client.PaymentStatusCapturing:
+			return errPaymentPending
+		}
+		*payment = current
+	}
+	return s.advance(ctx, saga, models.SagaStepCancelOrder, nil)
+}
+
+// advance stores the saga moved to next, together with the local change a
+// step makes, if any, in one transaction. Moving to SagaStepDone finishes the
+// saga.
+func (s *CheckoutSagas) advance(ctx context.Context, saga *models.CheckoutSaga, next models.SagaStep, change func(repo repository.SagaRepository) error) error {
+	updated := *saga
+	updated.Step = next
+	updated.Attempts = 0
+	if updated.Status == models.SagaStatusRunning {
+		updated.LastError = ""
+	}
+	if next == models.SagaStepDone {
+		updated.Status = models.SagaStatusCompleted
+		if saga.Status == models.SagaStatusCompensating {
+			updated.Status = models.SagaStatusCompensated
+		}
+	}
+	if err := s.save(ctx, &updated, change); err != nil {
+		return err
+	}
+	*saga = updated
+	return nil
+}
+
+// save stores the saga, renewing its lease, after running change in the same
+// transaction. The card token is dropped as soon as the saga no longer needs
+// it. save is not cancelled with ctx: the step it records has already
+// happened.
+func (s *CheckoutSagas) save(ctx context.Context, saga *models.CheckoutSaga, change func(repo repository.SagaRepository) error) error {
+	ctx = context.WithoutCancel(ctx)
+	if !saga.NeedsCard() {
+		saga.CardToken = ""
+	}
+	saga.NextAttemptAt = time.Now()
+	saga.LeaseUntil = saga.NextAttemptAt.Add(s.config.Lease)
+	return s.repo.InTx(ctx, func(repo repository.SagaRepository) error {
+		if change != nil {
+			if err := change(repo); err != nil {
+				return err
+			}
+		}
+		return repo.UpdateSaga(ctx, *saga)
+	})
+}
+
+// compensationStep is the first step undoing a saga that failed at step. A
+// saga that got as far as paying may hold a payment to release.
+func compensationStep(step models.SagaStep) models.SagaStep {
+	if step == models.SagaStepPay || step == models.SagaStepConfirm {
+		return models.SagaStepReleasePayment
+	}
+	return models.SagaStepCancelOrder
+}
+
+// transient reports whether a step failing with err may succeed when tried
+// again. Errors a dependency answered with, such as a declined payment or a
+// rejected token, will not change and are permanent.
+func transient(err error) bool {
+	var appErr *apperrors.Error
+	if !errors.As(err, &appErr) {
+		return true
+	}
+	return errors.Is(err, apperrors.ErrUpstream) || errors.Is(err, apperrors.ErrTimeout)
+}
+
+// sagaBackoff is the delay before attempt n+1 of a failing step.
+func sagaBackoff(attempt int) time.Duration {
+	delay := sagaRetryBase << (attempt - 1)
+	if delay <= 0 || delay > sagaRetryMax {
+		return sagaRetryMax
+	}
+	return delay
+}
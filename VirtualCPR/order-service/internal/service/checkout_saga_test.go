@@ -0,0 +1,445 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/order-service/internal/models"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/order-service/pkg/client"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/apperrors"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/auth"
+)
+
+const serviceToken = "order-service-token"
+
+// serviceIdentity stands in for the service tokens order-service obtains
+// from user-service.
+type serviceIdentity struct{}
+
+func (serviceIdentity) Identity(ctx context.Context) (auth.Identity, error) {
+	return auth.Identity{UserID: "order-service", Role: auth.RoleService, Token: serviceToken}, nil
+}
+
+// requireService rejects calls that do not carry order-service's own token,
+// so a step run with the caller's identity fails the way payment-service
+// would refuse it.
+func requireService(ctx context.Context) error {
+	identity, ok := auth.IdentityFromContext(ctx)
+	if !ok || identity.Role != auth.RoleService || identity.Token != serviceToken {
+		return apperrors.Forbidden("insufficient permissions")
+	}
+	return nil
+}
+
+type fakeUsers struct {
+	crash *crashSwitch
+}
+
+func (u fakeUsers) ValidateUser(ctx context.Context, userID string) (client.User, error) {
+	if err := requireService(ctx); err != nil {
+		return client.User{}, err
+	}
+	if err := u.crash.check(); err != nil {
+		return client.User{}, err
+	}
+	return client.User{ID: userID}, nil
+}
+
+// fakePayments keeps payments the way payment-service would, replaying a
+// creation retried with the same idempotency key. Each change reaches the
+// crash point "payment:<change>" once it has happened, so a crash there
+// loses only the response.
+type fakePayments struct {
+	crash *crashSwitch
+	// decline fails every new payment, failCapture every capture.
+	decline     bool
+	failCapture bool
+	// afterCapture runs once a payment has been captured.
+	afterCapture func()
+
+	mu       sync.Mutex
+	payments map[string]client.Payment
+	keys     map[string]string
+	captures int
+	refunds  int
+}
+
+func newFakePayments(crash *crashSwitch) *fakePayments {
+	return &fakePayments{
+		crash:    crash,
+		payments: make(map[string]client.Payment),
+		keys:     make(map[string]string),
+	}
+}
+
+func (p *fakePayments) CreatePayment(ctx context.Context, request client.CreatePaymentRequest, idempotencyKey string) (client.Payment, error) {
+	if err := requireService(ctx); err != nil {
+		return client.Payment{}, err
+	}
+	if err := p.crash.check(); err != nil {
+		return client.Payment{}, err
+	}
+	p.mu.Lock()
+	payment, replayed := p.payments[p.keys[idempotencyKey]]
+	if !replayed {
+		payment = client.Payment{
+			ID:       fmt.Sprintf("payment-%d", len(p.payments)+1),
+			UserID:   request.UserID,
+			OrderID:  request.OrderID,
+			Amount:   request.Amount,
+			Currency: request.Currency,
+			Status:   client.PaymentStatusAuthorized,
+		}
+		if p.decline {
+			payment.Status = client.PaymentStatusFailed
+		}
+		p.payments[payment.ID] = payment
+		p.keys[idempotencyKey] = payment.ID
+	}
+	p.mu.Unlock()
+
+	p.crash.reached("payment:create")
+	if err := p.crash.check(); err != nil {
+		return client.Payment{}, err
+	}
+	if payment.Status == client.PaymentStatusFailed {
+		return client.Payment{}, apperrors.New(apperrors.ErrPaymentRequired, "the card was declined")
+	}
+	return payment, nil
+}
+
+func (p *fakePayments) GetPayment(ctx context.Context, paymentID string) (client.Payment, error) {
+	if err := requireService(ctx); err != nil {
+		return client.Payment{}, err
+	}
+	if err := p.crash.check(); err != nil {
+		return client.Payment{}, err
+	}
+	return p.get(paymentID)
+}
+
+func (p *fakePayments) CapturePayment(ctx context.Context, paymentID string) (client.Payment, error) {
+	payment, err := p.change(ctx, paymentID, "capture", func(payment *client.Payment) error {
+		if p.failCapture {
+			return apperrors.New(apperrors.ErrUnprocessable, "the payment cannot be captured")
+		}
+		if payment.Status != client.PaymentStatusAuthorized {
+			return apperrors.Conflict(fmt.Sprintf("a %s payment cannot be captured", payment.Status))
+		}
+		payment.Status = client.PaymentStatusCaptured
+		p.captures++
+		return nil
+	})
+	if err == nil && p.afterCapture != nil {
+		p.afterCapture()
+	}
+	return payment, err
+}
+
+func (p *fakePayments) VoidPayment(ctx context.Context, paymentID string) (client.Payment, error) {
+	return p.change(ctx, paymentID, "void", func(payment *client.Payment) error {
+		switch payment.Status {
+		case client.PaymentStatusAuthorized, client.PaymentStatusRequiresAction, client.PaymentStatusVoiding:
+		default:
+			return apperrors.Conflict(fmt.Sprintf("a %s payment cannot be voided", payment.Status))
+		}
+		payment.Status = client.PaymentStatusVoided
+		return nil
+	})
+}
+
+func (p *fakePayments) RefundPayment(ctx context.Context, paymentID string) error {
+	_, err := p.change(ctx, paymentID, "refund", func(payment *client.Payment) error {
+		if payment.Status != client.PaymentStatusCaptured {
+			return apperrors.Conflict(fmt.Sprintf("a %s payment cannot be refunded", payment.Status))
+		}
+		payment.Status = client.PaymentStatusRefunded
+		p.refunds++
+		return nil
+	})
+	return err
+}
+
+func (p *fakePayments) change(ctx context.Context, paymentID, name string, apply func(payment *client.Payment) error) (client.Payment, error) {
+	if err := requireService(ctx); err != nil {
+		return client.Payment{}, err
+	}
+	if err := p.crash.check(); err != nil {
+		return client.Payment{}, err
+	}
+	p.mu.Lock()
+	payment, ok := p.payments[paymentID]
+	if !ok {
+		p.mu.Unlock()
+		return client.Payment{}, apperrors.NotFound("payment not found")
+	}
+	if err := apply(&payment); err != nil {
+		p.mu.Unlock()
+		return client.Payment{}, err
+	}
+	p.payments[paymentID] = payment
+	p.mu.Unlock()
+
+	p.crash.reached("payment:" + name)
+	return payment, p.crash.check()
+}
+
+func (p *fakePayments) get(paymentID string) (client.Payment, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	payment, ok := p.payments[paymentID]
+	if !ok {
+		return client.Payment{}, apperrors.NotFound("payment not found")
+	}
+	return payment, nil
+}
+
+// sagaWorld is order-service's store and the services the checkout saga
+// calls, kept across simulated restarts.
+type sagaWorld struct {
+	crash    *crashSwitch
+	repo     *memoryRepository
+	payments *fakePayments
+	order    models.Order
+}
+
+func newSagaWorld(t *testing.T) *sagaWorld {
+	t.Helper()
+	crash := &crashSwitch{}
+	w := &sagaWorld{
+		crash:    crash,
+		repo:     newMemoryRepository(crash),
+		payments: newFakePayments(crash),
+		order:    models.Order{ID: "order-1", UserID: "user-1", TotalAmount: 12.5, Status: "pending"},
+	}
+	if _, err := w.repo.CreateOrder(context.Background(), w.order); err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+// start runs a new instance of order-service's saga runner.
+func (w *sagaWorld) start(t *testing.T) *CheckoutSagas {
+	t.Helper()
+	sagas := NewCheckoutSagas(w.repo, w.repo, fakeUsers{crash: w.crash}, w.payments, serviceIdentity{}, SagaConfig{
+		PollInterval:   10 * time.Millisecond,
+		Lease:          time.Minute,
+		MaxAttempts:    3,
+		PaymentTimeout: time.Hour,
+	})
+	t.Cleanup(func() { w.stop(t, sagas) })
+	return sagas
+}
+
+func (w *sagaWorld) stop(t *testing.T, sagas *CheckoutSagas) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := sagas.Stop(ctx); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+}
+
+// checkout starts a checkout of the order as its customer.
+func (w *sagaWorld) checkout(sagas *CheckoutSagas) error {
+	ctx := auth.WithIdentity(context.Background(), auth.Identity{UserID: w.order.UserID, Role: auth.RoleCustomer, Token: "customer-token"})
+	_, _, err := sagas.Start(ctx, w.order, models.CheckoutRequest{CardToken: "tok_visa"})
+	return err
+}
+
+// finished waits for the order's latest checkout to finish and returns it.
+func (w *sagaWorld) finished(t *testing.T) models.CheckoutSaga {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		saga, err := w.repo.GetLatestSagaByOrderID(context.Background(), w.order.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if saga.Status.Finished() {
+			return saga
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("checkout did not finish, stuck %s at %s: %s", saga.Status, saga.Step, saga.LastError)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestCheckoutResumesAfterCrash(t *testing.T) {
+	tests := []struct {
+		name string
+		// crashAt is the point order-service dies at during the first run.
+		crashAt string
+		// setup makes the checkout fail, if it should.
+		setup       func(w *sagaWorld)
+		wantSaga    models.SagaStatus
+		wantOrder   string
+		wantPayment string
+		wantRefunds int
+	}{
+		{name: "after validate_user", crashAt: "saga:reserve",
+			wantSaga: models.SagaStatusCompleted, wantOrder: "completed", wantPayment: client.PaymentStatusCaptured},
+		{name: "after reserve", crashAt: "saga:pay",
+			wantSaga: models.SagaStatusCompleted, wantOrder: "completed", wantPayment: client.PaymentStatusCaptured},
+		{name: "during pay, before the payment was recorded", crashAt: "payment:create",
+			wantSaga: models.SagaStatusCompleted, wantOrder: "completed", wantPayment: client.PaymentStatusCaptured},
+		{name: "after pay", crashAt: "saga:confirm",
+			wantSaga: models.SagaStatusCompleted, wantOrder: "completed", wantPayment: client.PaymentStatusCaptured},
+		{name: "during confirm, after the capture", crashAt: "payment:capture",
+			wantSaga: models.SagaStatusCompleted, wantOrder: "completed", wantPayment: client.PaymentStatusCaptured},
+		{name: "after confirm", crashAt: "saga:done",
+			wantSaga: models.SagaStatusCompleted, wantOrder: "completed", wantPayment: client.PaymentStatusCaptured},
+		{name: "compensating a declined card", crashAt: "saga:release_payment",
+			setup:    func(w *sagaWorld) { w.payments.decline = true },
+			wantSaga: models.SagaStatusCompensated, wantOrder: "cancelled", wantPayment: client.PaymentStatusFailed},
+		{name: "compensating a failed capture", crashAt: "saga:release_payment",
+			setup:    func(w *sagaWorld) { w.payments.failCapture = true },
+			wantSaga: models.SagaStatusCompensated, wantOrder: "cancelled", wantPayment: client.PaymentStatusVoided},
+		{name: "compensating a captured payment", crashAt: "saga:release_payment",
+			setup:    cancelOrderOnCapture,
+			wantSaga: models.SagaStatusCompensated, wantOrder: "cancelled", wantPayment: client.PaymentStatusRefunded, wantRefunds: 1},
+		{name: "during compensation, after the refund", crashAt: "payment:refund",
+			setup:    cancelOrderOnCapture,
+			wantSaga: models.SagaStatusCompensated, wantOrder: "cancelled", wantPayment: client.PaymentStatusRefunded, wantRefunds: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newSagaWorld(t)
+			if tt.setup != nil {
+				tt.setup(w)
+			}
+			w.crash.at = tt.crashAt
+
+			first := w.start(t)
+			w.checkout(first)
+			if err := w.crash.check(); err == nil {
+				t.Fatalf("the checkout never reached %s", tt.crashAt)
+			}
+			w.stop(t, first)
+
+			crashed, err := w.repo.GetLatestSagaByOrderID(context.Background(), w.order.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := crashed.CardToken != "", crashed.NeedsCard(); got != want {
+				t.Errorf("stored card token present = %t at %s %s, want %t", got, crashed.Status, crashed.Step, want)
+			}
+
+			// The leases of the crashed runner run out and order-service starts again
+			w.crash.restart()
+			w.repo.expireLeases()
+			w.start(t)
+			saga := w.finished(t)
+
+			if saga.Status != tt.wantSaga {
+				t.Errorf("checkout status = %s (%s), want %s", saga.Status, saga.LastError, tt.wantSaga)
+			}
+			if saga.CardToken != "" {
+				t.Error("finished checkout still stores the card token")
+			}
+			order, err := w.repo.GetOrderByID(context.Background(), w.order.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if order.Status != tt.wantOrder {
+				t.Errorf("order status = %s, want %s", order.Status, tt.wantOrder)
+			}
+			if len(w.payments.payments) != 1 {
+				t.Fatalf("made %d payments, want 1", len(w.payments.payments))
+			}
+			for _, payment := range w.payments.payments {
+				if payment.Status != tt.wantPayment {
+					t.Errorf("payment status = %s, want %s", payment.Status, tt.wantPayment)
+				}
+				if payment.Amount != 1250 {
+					t.Errorf("payment amount = %d, want 1250", payment.Amount)
+				}
+				if tt.wantSaga == models.SagaStatusCompleted && order.PaymentID != payment.ID {
+					t.Errorf("order payment_id = %q, want %q", order.PaymentID, payment.ID)
+				}
+			}
+			if w.payments.captures > 1 {
+				t.Errorf("captured %d times, want at most once", w.payments.captures)
+			}
+			if w.payments.refunds != tt.wantRefunds {
+				t.Errorf("refunded %d times, want %d", w.payments.refunds, tt.wantRefunds)
+			}
+		})
+	}
+}
+
+// A customer cannot refund their own payment, but the saga undoing their
+// checkout can, since it calls payment-service as order-service.
+func TestCheckoutRefundsCustomerPaymentAfterCapture(t *testing.T) {
+	w := newSagaWorld(t)
+	cancelOrderOnCapture(w)
+	sagas := w.start(t)
+
+	err := w.checkout(sagas)
+	if !errors.Is(err, apperrors.ErrConflict) {
+		t.Fatalf("Start() error = %v, want the order conflict", err)
+	}
+	saga := w.finished(t)
+	if saga.Status != models.SagaStatusCompensated {
+		t.Fatalf("checkout status = %s (%s), want compensated", saga.Status, saga.LastError)
+	}
+	payment, err := w.payments.get(saga.PaymentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payment.Status != client.PaymentStatusRefunded || w.payments.refunds != 1 {
+		t.Errorf("payment %s after %d refunds, want refunded once", payment.Status, w.payments.refunds)
+	}
+	if saga.CallerID != w.order.UserID || saga.CallerRole != string(auth.RoleCustomer) {
+		t.Errorf("checkout started by %s %s, want the customer", saga.CallerRole, saga.CallerID)
+	}
+}
+
+// cancelOrderOnCapture changes the order behind the checkout's back while
+// its payment is being captured, as a change made directly in the database
+// would, so the checkout cannot complete it and has to refund.
+func cancelOrderOnCapture(w *sagaWorld) {
+	w.payments.afterCapture = func() {
+		w.repo.UpdateOrderStatus(context.Background(), w.order.ID, "cancelled", []string{"processing"})
+	}
+}
+
+func TestReleasePaymentWaitsForSettlement(t *testing.T) {
+	tests := []struct {
+		status  string
+		want    string
+		wantErr error
+	}{
+		{client.PaymentStatusAuthorized, client.PaymentStatusVoided, nil},
+		// payment-service resumes a void it was interrupted in
+		{client.PaymentStatusVoiding, client.PaymentStatusVoided, nil},
+		// A capture in flight may still take the money, so it is waited out
+		// rather than the order cancelled with its payment captured
+		{client.PaymentStatusCapturing, client.PaymentStatusCapturing, errPaymentPending},
+	}
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			w := newSagaWorld(t)
+			w.payments.payments["payment-1"] = client.Payment{ID: "payment-1", Status: tt.status}
+			// Leased, so the runner leaves the saga to this test
+			saga := &models.CheckoutSaga{ID: "saga-1", OrderID: w.order.ID, PaymentID: "payment-1", Status: models.SagaStatusCompensating, Step: models.SagaStepReleasePayment, LeaseUntil: time.Now().Add(time.Hour)}
+			w.repo.sagas[saga.ID] = *saga
+			sagas := w.start(t)
+
+			identity, _ := serviceIdentity{}.Identity(context.Background())
+			var payment client.Payment
+			err := sagas.releasePayment(auth.WithIdentity(context.Background(), identity), saga, &payment)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("releasePayment() error = %v, want %v", err, tt.wantErr)
+			}
+			if got := w.payments.payments["payment-1"].Status; got != tt.want {
+				t.Errorf("payment status = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
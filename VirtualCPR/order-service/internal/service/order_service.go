@@ -1,30 +1,42 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/robaa12/keploy-ContractTesting-MicroServices/order-service/internal/models"
 	"github.com/robaa12/keploy-ContractTesting-MicroServices/order-service/internal/repository"
 	"github.com/robaa12/keploy-ContractTesting-MicroServices/order-service/pkg/client"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/apperrors"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/pagination"
 )
 
 type OrderService struct {
-	repo       repository.PostgresOrderRepository
-	userClient client.UserClient
+	repo          repository.OrderRepository
+	userClient    client.UserClient
+	paymentClient client.PaymentClient
+	checkout      *CheckoutSagas
 }
 
-func NewOrderService(repo repository.PostgresOrderRepository, userClient client.UserClient) *OrderService {
+func NewOrderService(repo repository.OrderRepository, userClient client.UserClient, paymentClient client.PaymentClient, checkout *CheckoutSagas) *OrderService {
 	return &OrderService{
-		repo:       repo,
-		userClient: userClient,
+		repo:          repo,
+		userClient:    userClient,
+		paymentClient: paymentClient,
+		checkout:      checkout,
 	}
 }
 
-func (s *OrderService) CreateOrder(req models.CreateOrderRequest) (models.OrderResponse, error) {
-	user, err := s.userClient.ValidateUser(req.UserID)
+func (s *OrderService) CreateOrder(ctx context.Context, req models.CreateOrderRequest) (models.OrderResponse, error) {
+	user, err := s.userClient.ValidateUser(ctx, req.UserID)
 	if err != nil {
+		if errors.Is(err, apperrors.ErrNotFound) {
+			return models.OrderResponse{}, apperrors.Validation("user not found")
+		}
 		return models.OrderResponse{}, err
 	}
 
@@ -40,7 +52,7 @@ func (s *OrderService) CreateOrder(req models.CreateOrderRequest) (models.OrderR
 		UpdateAt:    time.Now(),
 	}
 
-	createdOrder, err := s.repo.CreateOrder(order)
+	createdOrder, err := s.repo.CreateOrder(ctx, order)
 	if err != nil {
 		return models.OrderResponse{}, err
 	}
@@ -57,19 +69,21 @@ func (s *OrderService) CreateOrder(req models.CreateOrderRequest) (models.OrderR
 	}, nil
 }
 
-func (s *OrderService) GetOrder(orderID string) (models.OrderResponse, error) {
-	order, err := s.repo.GetOrderByID(orderID)
+func (s *OrderService) GetOrder(ctx context.Context, orderID string) (models.OrderResponse, error) {
+	order, err := s.repo.GetOrderByID(ctx, orderID)
 	if err != nil {
 		return models.OrderResponse{}, err
 	}
 
-	user, err := s.userClient.ValidateUser(order.UserID)
+	user, err := s.userClient.ValidateUser(ctx, order.UserID)
 	if err != nil {
 		return models.OrderResponse{
 			ID:          order.ID,
+			UserID:      order.UserID,
 			Products:    order.Products,
 			TotalAmount: order.TotalAmount,
 			Status:      order.Status,
+			PaymentID:   order.PaymentID,
 			CreatedAt:   order.CreatedAt,
 			UpdateAt:    order.UpdateAt,
 		}, nil
@@ -83,17 +97,18 @@ func (s *OrderService) GetOrder(orderID string) (models.OrderResponse, error) {
 		Products:    order.Products,
 		TotalAmount: order.TotalAmount,
 		Status:      order.Status,
+		PaymentID:   order.PaymentID,
 		CreatedAt:   order.CreatedAt,
 		UpdateAt:    order.UpdateAt,
 	}, nil
 }
 
-func (s *OrderService) GetOrderByUserID(userID string) ([]models.OrderResponse, error) {
-	user, err := s.userClient.ValidateUser(userID)
+func (s *OrderService) GetOrderByUserID(ctx context.Context, userID string) ([]models.OrderResponse, error) {
+	user, err := s.userClient.ValidateUser(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
-	orders, err := s.repo.GetOrdersByUserID(userID)
+	orders, err := s.repo.GetOrdersByUserID(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -108,6 +123,7 @@ func (s *OrderService) GetOrderByUserID(userID string) ([]models.OrderResponse,
 			Products:    order.Products,
 			TotalAmount: order.TotalAmount,
 			Status:      order.Status,
+			PaymentID:   order.PaymentID,
 			CreatedAt:   order.CreatedAt,
 			UpdateAt:    order.UpdateAt,
 		})
@@ -115,11 +131,16 @@ func (s *OrderService) GetOrderByUserID(userID string) ([]models.OrderResponse,
 	return orderResponses, nil
 }
 
-func (s *OrderService) ListOrders() ([]models.OrderResponse, error) {
-	orders, err := s.repo.ListOrders()
+func (s *OrderService) ListOrders(ctx context.Context, filter models.OrderFilter, params pagination.Params) ([]models.OrderResponse, *pagination.Cursor, error) {
+	orders, err := s.repo.ListOrders(ctx, filter, params)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+
+	orders, next := pagination.Trim(orders, params, func(order models.Order) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: order.CreatedAt, ID: order.ID}
+	})
+
 	var orderResponses []models.OrderResponse
 	for _, order := range orders {
 		orderResponse := models.OrderResponse{
@@ -128,41 +149,48 @@ func (s *OrderService) ListOrders() ([]models.OrderResponse, error) {
 			Products:    order.Products,
 			TotalAmount: order.TotalAmount,
 			Status:      order.Status,
+			PaymentID:   order.PaymentID,
 			CreatedAt:   order.CreatedAt,
 			UpdateAt:    order.UpdateAt,
 		}
-		user, err := s.userClient.ValidateUser(order.UserID)
+		user, err := s.userClient.ValidateUser(ctx, order.UserID)
 		if err == nil {
 			orderResponse.UserName = user.Name
 			orderResponse.UserEmail = user.Email
 		}
 		orderResponses = append(orderResponses, orderResponse)
 	}
-	return orderResponses, nil
+	return orderResponses, next, nil
 }
 
-func (s *OrderService) UpdateOrderStatus(id, status string) (models.OrderResponse, error) {
-	order, err := s.repo.GetOrderByID(id)
+func (s *OrderService) UpdateOrderStatus(ctx context.Context, id, status string) (models.OrderResponse, error) {
+	order, err := s.repo.GetOrderByID(ctx, id)
 	if err != nil {
 		return models.OrderResponse{}, err
 	}
 
-	validStatuses := map[string]bool{"pending": true, "cancelled": true, "completed": true}
-	if !validStatuses[status] {
-		return models.OrderResponse{}, errors.New("invalid status. Must be pending, completed, or cancelled")
+	// Only checkout moves an order to processing and completed, as it takes
+	// the payment, and only checkout moves it on from there
+	from := models.ManualStatusSources(status)
+	if from == nil {
+		return models.OrderResponse{}, apperrors.Validation("invalid status. Must be pending or cancelled; orders are completed by checkout")
+	}
+	if !slices.Contains(from, order.Status) {
+		return models.OrderResponse{}, apperrors.Conflict(fmt.Sprintf("a %s order cannot be set to %s", order.Status, status))
 	}
 
-	if err := s.repo.UpdateOrderStatus(id, status); err != nil {
+	if err := s.repo.UpdateOrderStatus(ctx, id, status, from); err != nil {
 		return models.OrderResponse{}, err
 	}
 
-	user, err := s.userClient.ValidateUser(order.UserID)
+	user, err := s.userClient.ValidateUser(ctx, order.UserID)
 	orderResponse := models.OrderResponse{
 		ID:          order.ID,
 		UserID:      order.UserID,
 		Products:    order.Products,
 		TotalAmount: order.TotalAmount,
 		Status:      status,
+		PaymentID:   order.PaymentID,
 		CreatedAt:   order.CreatedAt,
 		UpdateAt:    time.Now(),
 	}
@@ -173,23 +201,25 @@ func (s *OrderService) UpdateOrderStatus(id, status string) (models.OrderRespons
 	return orderResponse, nil
 }
 
-func (s *OrderService) DeleteOrder(id string) error {
-	return s.repo.DeleteOrder(id)
+func (s *OrderService) DeleteOrder(ctx context.Context, id string) error {
+	return s.repo.DeleteOrder(ctx, id)
 }
 
-func (s *OrderService) GetOrderByID(id string) (models.OrderResponse, error) {
-	order, err := s.repo.GetOrderByID(id)
+func (s *OrderService) GetOrderByID(ctx context.Context, id string) (models.OrderResponse, error) {
+	order, err := s.repo.GetOrderByID(ctx, id)
 	if err != nil {
 		return models.OrderResponse{}, err
 	}
 
-	user, err := s.userClient.ValidateUser(order.UserID)
+	user, err := s.userClient.ValidateUser(ctx, order.UserID)
 	if err != nil {
 		return models.OrderResponse{
 			ID:          order.ID,
+			UserID:      order.UserID,
 			Products:    order.Products,
 			TotalAmount: order.TotalAmount,
 			Status:      order.Status,
+			PaymentID:   order.PaymentID,
 			CreatedAt:   order.CreatedAt,
 			UpdateAt:    order.UpdateAt,
 		}, nil
@@ -203,6 +233,7 @@ func (s *OrderService) GetOrderByID(id string) (models.OrderResponse, error) {
 		Products:    order.Products,
 		TotalAmount: order.TotalAmount,
 		Status:      order.Status,
+		PaymentID:   order.PaymentID,
 		CreatedAt:   order.CreatedAt,
 		UpdateAt:    order.UpdateAt,
 	}, nil
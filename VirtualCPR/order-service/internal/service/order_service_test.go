@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/order-service/internal/models"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/apperrors"
+)
+
+func TestUpdateOrderStatusLeavesPaymentStatusesToCheckout(t *testing.T) {
+	tests := []struct {
+		status  string
+		wantErr error
+	}{
+		{"pending", nil},
+		{"cancelled", nil},
+		// An order is only completed once checkout has captured its payment
+		{"completed", apperrors.ErrValidation},
+		{"processing", apperrors.ErrValidation},
+		{"shipped", apperrors.ErrValidation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			repo := newMemoryRepository(&crashSwitch{})
+			repo.CreateOrder(context.Background(), models.Order{ID: "order-1", UserID: "user-1", Status: "pending"})
+			orders := NewOrderService(repo, fakeUsers{crash: &crashSwitch{}}, nil, nil)
+
+			_, err := orders.UpdateOrderStatus(context.Background(), "order-1", tt.status)
+			if tt.wantErr == nil && err != nil || tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("UpdateOrderStatus(%s) error = %v, want %v", tt.status, err, tt.wantErr)
+			}
+			order, _ := repo.GetOrderByID(context.Background(), "order-1")
+			want := tt.status
+			if tt.wantErr != nil {
+				want = "pending"
+			}
+			if order.Status != want {
+				t.Errorf("order status = %s, want %s", order.Status, want)
+			}
+		})
+	}
+}
+
+func TestUpdateOrderStatusLeavesCheckedOutOrdersAlone(t *testing.T) {
+	for _, from := range []string{"processing", "completed"} {
+		for _, to := range []string{"pending", "cancelled"} {
+			t.Run(from+" to "+to, func(t *testing.T) {
+				repo := newMemoryRepository(&crashSwitch{})
+				repo.CreateOrder(context.Background(), models.Order{ID: "order-1", UserID: "user-1", Status: from, PaymentID: "payment-1"})
+				orders := NewOrderService(repo, fakeUsers{crash: &crashSwitch{}}, nil, nil)
+
+				if _, err := orders.UpdateOrderStatus(context.Background(), "order-1", to); !errors.Is(err, apperrors.ErrConflict) {
+					t.Fatalf("UpdateOrderStatus(%s) error = %v, want a conflict", to, err)
+				}
+				if order, _ := repo.GetOrderByID(context.Background(), "order-1"); order.Status != from {
+					t.Errorf("order status = %s, want it left %s", order.Status, from)
+				}
+			})
+		}
+	}
+}
+
+// staleOrders answers reads with the order as it was before checkout
+// reserved it.
+type staleOrders struct {
+	*memoryRepository
+	stale models.Order
+}
+
+func (r staleOrders) GetOrderByID(ctx context.Context, orderID string) (models.Order, error) {
+	return r.stale, nil
+}
+
+func TestUpdateOrderStatusLosesRaceWithCheckout(t *testing.T) {
+	repo := newMemoryRepository(&crashSwitch{})
+	order := models.Order{ID: "order-1", UserID: "user-1", Status: "pending"}
+	repo.CreateOrder(context.Background(), order)
+	orders := NewOrderService(staleOrders{repo, order}, fakeUsers{crash: &crashSwitch{}}, nil, nil)
+
+	// Checkout reserves the order after the status endpoint has read it
+	if err := repo.ReserveOrder(context.Background(), "order-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := orders.UpdateOrderStatus(context.Background(), "order-1", "cancelled"); !errors.Is(err, apperrors.ErrConflict) {
+		t.Fatalf("UpdateOrderStatus error = %v, want a conflict", err)
+	}
+	if current, _ := repo.GetOrderByID(context.Background(), "order-1"); current.Status != "processing" {
+		t.Errorf("order status = %s, want processing", current.Status)
+	}
+}
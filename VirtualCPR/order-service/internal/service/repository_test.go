@@ -0,0 +1,279 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/order-service/internal/models"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/order-service/internal/repository"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/apperrors"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/pagination"
+)
+
+// errCrashed is what every store write and outbound call fails with once a
+// test has crashed order-service.
+var errCrashed = errors.New("order-service crashed")
+
+// crashSwitch simulates order-service dying at a chosen point. Once the point
+// is reached nothing more is stored or sent, as if the process had stopped
+// there, until restart.
+type crashSwitch struct {
+	mu      sync.Mutex
+	at      string
+	tripped bool
+}
+
+// reached trips the switch when point is the one to crash at.
+func (c *crashSwitch) reached(point string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if point == c.at {
+		c.tripped = true
+	}
+}
+
+func (c *crashSwitch) check() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.tripped {
+		return errCrashed
+	}
+	return nil
+}
+
+func (c *crashSwitch) restart() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.at, c.tripped = "", false
+}
+
+// memoryRepository keeps orders and checkout sagas in maps so the saga can be
+// tested without Postgres. Transactions are not isolated. Storing a saga
+// reaches the crash point "saga:<step>".
+type memoryRepository struct {
+	crash *crashSwitch
+
+	mu     sync.Mutex
+	orders map[string]models.Order
+	sagas  map[string]models.CheckoutSaga
+}
+
+var (
+	_ repository.SagaRepository  = (*memoryRepository)(nil)
+	_ repository.OrderRepository = (*memoryRepository)(nil)
+)
+
+func newMemoryRepository(crash *crashSwitch) *memoryRepository {
+	return &memoryRepository{
+		crash:  crash,
+		orders: make(map[string]models.Order),
+		sagas:  make(map[string]models.CheckoutSaga),
+	}
+}
+
+// expireLeases releases every saga, as happens when a crashed runner's
+// leases run out.
+func (r *memoryRepository) expireLeases() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, saga := range r.sagas {
+		saga.LeaseUntil = time.Time{}
+		r.sagas[id] = saga
+	}
+}
+
+func (r *memoryRepository) CreateOrder(ctx context.Context, order models.Order) (models.Order, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.orders[order.ID] = order
+	return order, nil
+}
+
+func (r *memoryRepository) GetOrderByID(ctx context.Context, orderID string) (models.Order, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	order, ok := r.orders[orderID]
+	if !ok {
+		return models.Order{}, apperrors.NotFound("order not found")
+	}
+	return order, nil
+}
+
+func (r *memoryRepository) GetOrdersByUserID(ctx context.Context, userID string) ([]models.Order, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var orders []models.Order
+	for _, order := range r.orders {
+		if order.UserID == userID {
+			orders = append(orders, order)
+		}
+	}
+	return orders, nil
+}
+
+func (r *memoryRepository) ListOrders(ctx context.Context, filter models.OrderFilter, params pagination.Params) ([]models.Order, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var orders []models.Order
+	for _, order := range r.orders {
+		if filter.Status == "" || order.Status == filter.Status {
+			orders = append(orders, order)
+		}
+	}
+	return orders, nil
+}
+
+func (r *memoryRepository) UpdateOrderStatus(ctx context.Context, orderID, status string, from []string) error {
+	return r.moveOrder(orderID, from, status, "", "the order's status cannot be changed from its current one")
+}
+
+func (r *memoryRepository) DeleteOrder(ctx context.Context, orderID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.orders, orderID)
+	return nil
+}
+
+func (r *memoryRepository) CreateSaga(ctx context.Context, saga models.CheckoutSaga) (models.CheckoutSaga, error) {
+	if err := r.crash.check(); err != nil {
+		return models.CheckoutSaga{}, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.sagas {
+		if existing.OrderID == saga.OrderID && !existing.Status.Finished() {
+			return models.CheckoutSaga{}, repository.ErrCheckoutInProgress
+		}
+	}
+	now := time.Now()
+	saga.ID = fmt.Sprintf("saga-%d", len(r.sagas)+1)
+	saga.NextAttemptAt = now
+	saga.CreatedAt = now
+	saga.UpdatedAt = now
+	r.sagas[saga.ID] = saga
+	return saga, nil
+}
+
+func (r *memoryRepository) GetSaga(ctx context.Context, id string) (models.CheckoutSaga, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	saga, ok := r.sagas[id]
+	if !ok {
+		return models.CheckoutSaga{}, apperrors.NotFound("checkout not found")
+	}
+	return saga, nil
+}
+
+func (r *memoryRepository) GetLatestSagaByOrderID(ctx context.Context, orderID string) (models.CheckoutSaga, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var latest *models.CheckoutSaga
+	for _, saga := range r.sagas {
+		if saga.OrderID == orderID && (latest == nil || saga.CreatedAt.After(latest.CreatedAt)) {
+			latest = &saga
+		}
+	}
+	if latest == nil {
+		return models.CheckoutSaga{}, apperrors.NotFound("checkout not found")
+	}
+	return *latest, nil
+}
+
+func (r *memoryRepository) ClaimSaga(ctx context.Context, id string, now, leaseUntil time.Time) (models.CheckoutSaga, error) {
+	if err := r.crash.check(); err != nil {
+		return models.CheckoutSaga{}, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	saga, ok := r.sagas[id]
+	if !ok || saga.Status.Finished() || saga.LeaseUntil.After(now) {
+		return models.CheckoutSaga{}, repository.ErrSagaClaimed
+	}
+	saga.LeaseUntil = leaseUntil
+	r.sagas[id] = saga
+	return saga, nil
+}
+
+func (r *memoryRepository) ListDueSagas(ctx context.Context, now time.Time, limit int) ([]models.CheckoutSaga, error) {
+	if err := r.crash.check(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var due []models.CheckoutSaga
+	for _, saga := range r.sagas {
+		if !saga.Status.Finished() && !saga.NextAttemptAt.After(now) && !saga.LeaseUntil.After(now) {
+			due = append(due, saga)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].NextAttemptAt.Before(due[j].NextAttemptAt)
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+func (r *memoryRepository) UpdateSaga(ctx context.Context, saga models.CheckoutSaga) error {
+	if err := r.crash.check(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	if _, ok := r.sagas[saga.ID]; !ok {
+		r.mu.Unlock()
+		return apperrors.NotFound("checkout not found")
+	}
+	saga.UpdatedAt = time.Now()
+	r.sagas[saga.ID] = saga
+	r.mu.Unlock()
+	r.crash.reached("saga:" + string(saga.Step))
+	return nil
+}
+
+func (r *memoryRepository) ReserveOrder(ctx context.Context, orderID string) error {
+	return r.moveOrder(orderID, []string{"pending"}, "processing", "", "only a pending order can be checked out")
+}
+
+func (r *memoryRepository) CompleteOrder(ctx context.Context, orderID, paymentID string) error {
+	return r.moveOrder(orderID, []string{"processing"}, "completed", paymentID, "the order was changed during checkout")
+}
+
+func (r *memoryRepository) CancelOrder(ctx context.Context, orderID string) error {
+	err := r.moveOrder(orderID, []string{"pending", "processing"}, "cancelled", "", "")
+	if errors.Is(err, apperrors.ErrConflict) {
+		return nil
+	}
+	return err
+}
+
+func (r *memoryRepository) moveOrder(orderID string, from []string, to, paymentID, conflict string) error {
+	if err := r.crash.check(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	order, ok := r.orders[orderID]
+	if !ok {
+		return apperrors.NotFound("order not found")
+	}
+	for _, status := range from {
+		if order.Status == status {
+			order.Status = to
+			if paymentID != "" {
+				order.PaymentID = paymentID
+			}
+			r.orders[orderID] = order
+			return nil
+		}
+	}
+	return apperrors.Conflict(conflict)
+}
+
+func (r *memoryRepository) InTx(ctx context.Context, fn func(repo repository.SagaRepository) error) error {
+	return fn(r)
+}
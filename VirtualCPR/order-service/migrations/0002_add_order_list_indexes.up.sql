@@ -0,0 +1,4 @@
+-- Keyset pagination and the ListOrders filters
+CREATE INDEX IF NOT EXISTS idx_orders_created_at_id ON orders (created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_orders_status_created_at_id ON orders (status, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_orders_user_id_created_at_id ON orders (user_id, created_at DESC, id DESC);
@@ -0,0 +1,2 @@
+-- The payment made for the order at checkout, kept in payment-service
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS payment_id VARCHAR(36);
@@ -0,0 +1,27 @@
+-- Progress of each order checkout, so an interrupted one resumes where it
+-- stopped or undoes what it did
+CREATE TABLE IF NOT EXISTS checkout_sagas (
+    id VARCHAR(36) PRIMARY KEY,
+    order_id VARCHAR(36) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    step VARCHAR(20) NOT NULL,
+    card_token VARCHAR(255) NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    payment_id VARCHAR(36),
+    caller_id VARCHAR(36) NOT NULL,
+    caller_role VARCHAR(20) NOT NULL,
+    caller_token TEXT NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMP NOT NULL,
+    lease_until TIMESTAMP,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+-- An order has at most one checkout in progress
+CREATE UNIQUE INDEX IF NOT EXISTS idx_checkout_sagas_active_order_id ON checkout_sagas (order_id)
+    WHERE status IN ('running', 'compensating');
+-- The saga runner picks up unfinished sagas that are due
+CREATE INDEX IF NOT EXISTS idx_checkout_sagas_due ON checkout_sagas (next_attempt_at)
+    WHERE status IN ('running', 'compensating');
+CREATE INDEX IF NOT EXISTS idx_checkout_sagas_order_id_created_at ON checkout_sagas (order_id, created_at DESC);
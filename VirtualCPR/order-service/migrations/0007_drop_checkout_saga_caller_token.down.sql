@@ -0,0 +1 @@
+ALTER TABLE checkout_sagas ADD COLUMN IF NOT EXISTS caller_token TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,6 @@
+-- Checkout steps call the other services with order-service's own token, so
+-- the caller's is no longer kept. Card tokens are dropped once the saga is
+-- past paying.
+ALTER TABLE checkout_sagas DROP COLUMN IF EXISTS caller_token;
+UPDATE checkout_sagas SET card_token = ''
+    WHERE card_token <> '' AND (status <> 'running' OR step NOT IN ('validate_user', 'reserve', 'pay'));
@@ -0,0 +1,214 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/apperrors"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/auth"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/idempotency"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/metrics"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/requestid"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/tracing"
+)
+
+// Payment statuses order-service acts on. payment-service has a few others,
+// such as pending, that checkout treats like requires_action and waits out.
+const (
+	PaymentStatusRequiresAction    = "requires_action"
+	PaymentStatusProcessing        = "processing"
+	PaymentStatusSucceeded         = "succeeded"
+	PaymentStatusFailed            = "failed"
+	PaymentStatusAuthorized        = "authorized"
+	PaymentStatusCapturing         = "capturing"
+	PaymentStatusCaptured          = "captured"
+	PaymentStatusVoiding           = "voiding"
+	PaymentStatusVoided            = "voided"
+	PaymentStatusPartiallyRefunded = "partially_refunded"
+	PaymentStatusRefunded          = "refunded"
+)
+
+// CaptureManual only authorizes a payment; CapturePayment takes the money.
+const CaptureManual = "manual"
+
+type PaymentClient interface {
+	// CreatePayment charges the card. A non-empty idempotencyKey is sent as
+	// the Idempotency-Key header, so a retry cannot charge twice.
+	CreatePayment(ctx context.Context, request CreatePaymentRequest, idempotencyKey string) (Payment, error)
+	GetPayment(ctx context.Context, paymentID string) (Payment, error)
+	// CapturePayment takes the whole amount of an authorized payment.
+	CapturePayment(ctx context.Context, paymentID string) (Payment, error)
+	// VoidPayment releases a payment that has not been captured.
+	VoidPayment(ctx context.Context, paymentID string) (Payment, error)
+	// RefundPayment returns everything not yet refunded of a captured
+	// payment. payment-service only lets support, admin and service callers
+	// refund.
+	RefundPayment(ctx context.Context, paymentID string) error
+}
+
+type CreatePaymentRequest struct {
+	UserID    string `json:"user_id"`
+	OrderID   string `json:"order_id"`
+	Amount    int64  `json:"amount"`
+	Currency  string `json:"currency"`
+	Desc      string `json:"desc,omitempty"`
+	CardToken string `json:"card_token"`
+	// CaptureMethod is automatic when empty, or CaptureManual.
+	CaptureMethod string `json:"capture_method,omitempty"`
+}
+
+type Payment struct {
+	ID       string `json:"id"`
+	UserID   string `json:"user_id"`
+	OrderID  string `json:"order_id"`
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+	Status   string `json:"status"`
+	// ClientSecret is set when the payment needs the customer to
+	// authenticate, for example with 3-D Secure.
+	ClientSecret string    `json:"client_secret,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+type HttpPaymentClient struct {
+	baseURL    string
+	timeout    time.Duration
+	httpClient *http.Client
+	metrics    metrics.Outbound
+}
+
+// NewHttpPaymentClient returns a client whose calls end at the caller's
+// deadline or after timeout, whichever comes first.
+func NewHttpPaymentClient(baseURL string, timeout time.Duration, outbound metrics.Outbound) *HttpPaymentClient {
+	return &HttpPaymentClient{
+		baseURL: baseURL,
+		timeout: timeout,
+		httpClient: &http.Client{
+			Transport: tracing.Transport(nil),
+		},
+		metrics: outbound,
+	}
+}
+
+// CreatePayment creates a payment as the identity in ctx, sending its bearer
+// token so payment-service applies its own access rules. Checkout steps run
+// with order-service's service token, which payment-service requires to link
+// a payment to an order.
+func (c *HttpPaymentClient) CreatePayment(ctx context.Context, request CreatePaymentRequest, idempotencyKey string) (Payment, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return Payment{}, fmt.Errorf("failed to encode payment request: %w", err)
+	}
+	started := time.Now()
+	payment, err := c.do(ctx, http.MethodPost, "/payments", body, idempotencyKey)
+	c.metrics.ObserveOutbound("payment-service", "create_payment", started, err)
+	return payment, err
+}
+
+func (c *HttpPaymentClient) GetPayment(ctx context.Context, paymentID string) (Payment, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	started := time.Now()
+	payment, err := c.do(ctx, http.MethodGet, "/payments/"+paymentID, nil, "")
+	c.metrics.ObserveOutbound("payment-service", "get_payment", started, err)
+	return payment, err
+}
+
+func (c *HttpPaymentClient) CapturePayment(ctx context.Context, paymentID string) (Payment, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	started := time.Now()
+	payment, err := c.do(ctx, http.MethodPost, "/payments/"+paymentID+"/capture", nil, "")
+	c.metrics.ObserveOutbound("payment-service", "capture_payment", started, err)
+	return payment, err
+}
+
+func (c *HttpPaymentClient) VoidPayment(ctx context.Context, paymentID string) (Payment, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	started := time.Now()
+	payment, err := c.do(ctx, http.MethodPost, "/payments/"+paymentID+"/void", nil, "")
+	c.metrics.ObserveOutbound("payment-service", "void_payment", started, err)
+	return payment, err
+}
+
+func (c *HttpPaymentClient) RefundPayment(ctx context.Context, paymentID string) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	started := time.Now()
+	// The response is a refund rather than a payment; only its status matters
+	_, err := c.do(ctx, http.MethodPost, "/payments/"+paymentID+"/refunds", nil, "")
+	c.metrics.ObserveOutbound("payment-service", "refund_payment", started, err)
+	return err
+}
+
+func (c *HttpPaymentClient) do(ctx context.Context, method, path string, body []byte, idempotencyKey string) (Payment, error) {
+	request, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return Payment{}, fmt.Errorf("failed to build payment service request: %w", err)
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if identity, ok := auth.IdentityFromContext(ctx); ok {
+		request.Header.Set("Authorization", "Bearer "+identity.Token)
+	}
+	if id := requestid.FromContext(ctx); id != "" {
+		request.Header.Set(requestid.Header, id)
+	}
+	if idempotencyKey != "" {
+		request.Header.Set(idempotency.Header, idempotencyKey)
+	}
+
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return Payment{}, apperrors.Upstream("failed to call payment service", err)
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+	case http.StatusNotFound:
+		return Payment{}, apperrors.NotFound("payment not found")
+	case http.StatusUnauthorized:
+		return Payment{}, apperrors.Unauthorized("payment service rejected the caller's token")
+	case http.StatusForbidden:
+		return Payment{}, apperrors.Forbidden("payment service denied access to the payment")
+	case http.StatusPaymentRequired:
+		return Payment{}, apperrors.New(apperrors.ErrPaymentRequired, problemDetail(response, "the payment was declined"))
+	case http.StatusConflict:
+		return Payment{}, apperrors.Conflict(problemDetail(response, "payment service rejected the payment"))
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return Payment{}, apperrors.Validation(problemDetail(response, "payment service rejected the request"))
+	default:
+		return Payment{}, apperrors.Upstream("payment service request failed", fmt.Errorf("status code %d", response.StatusCode))
+	}
+
+	var payment Payment
+	if err = json.NewDecoder(response.Body).Decode(&payment); err != nil {
+		return Payment{}, apperrors.Upstream("failed to parse payment service response", err)
+	}
+	return payment, nil
+}
+
+// problemDetail returns the detail of a problem response, which payment-service
+// writes for client errors, or fallback when there is none.
+func problemDetail(response *http.Response, fallback string) string {
+	var problem apperrors.Problem
+	if err := json.NewDecoder(response.Body).Decode(&problem); err != nil || problem.Detail == "" {
+		return fallback
+	}
+	return problem.Detail
+}
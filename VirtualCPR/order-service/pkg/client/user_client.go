@@ -1,14 +1,21 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"time"
+
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/apperrors"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/auth"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/metrics"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/requestid"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/tracing"
 )
 
 type UserClient interface {
-	ValidateUser(userID string) (User, error)
+	ValidateUser(ctx context.Context, userID string) (User, error)
 }
 
 type User struct {
@@ -21,37 +28,73 @@ type User struct {
 
 type HttpUserClient struct {
 	baseURL    string
+	timeout    time.Duration
 	httpClient *http.Client
+	metrics    metrics.Outbound
 }
 
-func NewHttpUserClient(baseURL string, timeout int) *HttpUserClient {
+// NewHttpUserClient returns a client whose calls end at the caller's deadline
+// or after timeout, whichever comes first.
+func NewHttpUserClient(baseURL string, timeout time.Duration, outbound metrics.Outbound) *HttpUserClient {
 	return &HttpUserClient{
 		baseURL: baseURL,
+		timeout: timeout,
 		httpClient: &http.Client{
-			Timeout: time.Duration(timeout) * time.Second,
+			Transport: tracing.Transport(nil),
 		},
+		metrics: outbound,
 	}
 }
 
-func (c *HttpUserClient) ValidateUser(userID string) (User, error) {
+// ValidateUser fetches the user as the identity in ctx, sending its bearer
+// token so user-service applies its own access rules, and the request ID so
+// both services log under the same ID. Checkout steps run with
+// order-service's service token.
+func (c *HttpUserClient) ValidateUser(ctx context.Context, userID string) (User, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	started := time.Now()
+	user, err := c.validateUser(ctx, userID)
+	c.metrics.ObserveOutbound("user-service", "validate_user", started, err)
+	return user, err
+}
+
+func (c *HttpUserClient) validateUser(ctx context.Context, userID string) (User, error) {
 	url := fmt.Sprintf("%s/api/users/%s", c.baseURL, userID)
-	response, err := c.httpClient.Get(url)
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return User{}, fmt.Errorf("failed to build user service request: %w", err)
+	}
+	if identity, ok := auth.IdentityFromContext(ctx); ok {
+		request.Header.Set("Authorization", "Bearer "+identity.Token)
+	}
+	if id := requestid.FromContext(ctx); id != "" {
+		request.Header.Set(requestid.Header, id)
+	}
+
+	response, err := c.httpClient.Do(request)
 
 	if err != nil {
-		return User{}, fmt.Errorf("failed to call user service: %w", err)
+		return User{}, apperrors.Upstream("failed to call user service", err)
 	}
 	defer response.Body.Close()
 
-	if response.StatusCode == http.StatusNotFound {
-		return User{}, fmt.Errorf("user not found")
-	}
-	if response.StatusCode != http.StatusOK {
-		return User{}, fmt.Errorf("user service returned status code %d", response.StatusCode)
+	switch response.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return User{}, apperrors.NotFound("user not found")
+	case http.StatusUnauthorized:
+		return User{}, apperrors.Unauthorized("user service rejected the caller's token")
+	case http.StatusForbidden:
+		return User{}, apperrors.Forbidden("user service denied access to the user")
+	default:
+		return User{}, apperrors.Upstream("user service request failed", fmt.Errorf("status code %d", response.StatusCode))
 	}
 
 	var user User
 	if err = json.NewDecoder(response.Body).Decode(&user); err != nil {
-		return User{}, fmt.Errorf("failed to parse response: %w", err)
+		return User{}, apperrors.Upstream("failed to parse user service response", err)
 	}
 	return user, nil
 }
@@ -1,75 +1,108 @@
 package main
 
 import (
-	"crypto/tls"
-	"fmt"
-	"log"
+	"cmp"
+	"context"
 	"net/http"
 	"os"
+	"time"
 
-	"github.com/gin-gonic/gin"
-	_ "github.com/lib/pq"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/payment-service/internal/gateway"
 	"github.com/robaa12/keploy-ContractTesting-MicroServices/payment-service/internal/handlers"
 	"github.com/robaa12/keploy-ContractTesting-MicroServices/payment-service/internal/repository"
 	"github.com/robaa12/keploy-ContractTesting-MicroServices/payment-service/internal/service"
-	"github.com/robaa12/keploy-ContractTesting-MicroServices/payment-service/pkg/database"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/payment-service/migrations"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/auth"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/config"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/database"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/health"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/httpserver"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/idempotency"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/lifecycle"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/logging"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/metrics"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/tracing"
 	"github.com/stripe/stripe-go/v81"
 )
 
 func main() {
-	// Initialize Stripe
-	stripeKey := os.Getenv("STRIPE_SECRET_KEY")
-	if stripeKey == "" {
-		stripeKey = "pk_test_51QzteqEN3C714OAmopACj4peCAlnLnU5o4LSQlaMg0m3q5XV0GwZ1vVbHTh2YBktcIVFN2us9vevw8lsPuCPz1dk00Eu1o6Rb7" // Default test key for development
+	env := config.FromEnv()
+	loggingConfig := logging.ConfigFromEnv(env)
+	dbConfig := database.ConfigFromEnv(env, "payment_service")
+	authConfig := auth.GetConfigFromEnv(env)
+	serverConfig := httpserver.ConfigFromEnv(env, "payment-service", "8082")
+	gatewayConfig := gateway.ConfigFromEnv(env)
+	authorizationConfig := service.AuthorizationConfigFromEnv(env)
+	idempotencyConfig := idempotency.ConfigFromEnv(env)
+	lifecycleConfig := lifecycle.ConfigFromEnv(env)
+	tracingConfig := tracing.ConfigFromEnv(env)
+	logging.Setup("payment-service", loggingConfig)
+	if err := env.Err(); err != nil {
+		logging.Fatal("Invalid configuration", err)
 	}
-	httpClient := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
-	}
-	stripe.SetHTTPClient(httpClient)
-	stripe.Key = stripeKey
 
-	dbConfig := database.GetConfigFromEnv()
+	// Tracing is stopped last so spans from the other shutdown hooks are flushed
+	app := lifecycle.New(lifecycleConfig)
+	shutdownTracing, err := tracing.Setup(context.Background(), serverConfig.Name, tracingConfig)
+	if err != nil {
+		logging.Fatal("Failed to setup tracing", err)
+	}
+	app.OnStop("tracing", shutdownTracing)
 
 	// Connect to database
 	db, err := database.NewPostgresDB(dbConfig)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		logging.Fatal("Failed to connect to database", err)
 	}
-	defer db.Close()
+	serviceMetrics := metrics.New(serverConfig.Name)
+	serviceMetrics.RegisterDB(db, dbConfig.DBName)
+	app.OnStop("database", func(context.Context) error {
+		return db.Close()
+	})
 
-	// Setup database schema
-	if err := database.SetupSchema(db); err != nil {
-		log.Fatalf("Failed to setup database schema: %v", err)
+	// Apply schema migrations, or run the migrate subcommand and exit
+	migrator, err := database.NewMigrator(db, migrations.Files)
+	if err != nil {
+		logging.Fatal("Failed to load migrations", err)
+	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := database.RunMigrateCommand(context.Background(), migrator, os.Args[2:], os.Stdout); err != nil {
+			logging.Fatal("Migration failed", err)
+		}
+		return
+	}
+	if err := database.EnsureSchema(context.Background(), migrator, dbConfig.AutoMigrate); err != nil {
+		logging.Fatal("Failed to prepare database schema", err)
 	}
 
-	paymentRepo := repository.NewPaymentRepository(db)
-	paymentService := service.NewPaymentService(paymentRepo)
-	paymentHandler := handlers.NewPaymentHandler(paymentService)
+	// Stripe requests are traced and carry traceparent
+	paymentGateway, err := gateway.New(gatewayConfig, &http.Client{Transport: tracing.Transport(nil)}, serviceMetrics)
+	if err != nil {
+		logging.Fatal("Failed to create payment gateway", err)
+	}
 
-	// Setup Gin router
-	router := gin.Default()
+	paymentRepo := repository.NewPaymentRepository(db)
+	statusUpdates := service.NewStatusUpdates(paymentRepo)
+	app.OnStop("payment status updates", statusUpdates.Flush)
+	paymentService := service.NewPaymentService(paymentRepo, statusUpdates, paymentGateway, authorizationConfig)
+	sweeper := service.NewAuthorizationSweeper(&paymentService, authorizationConfig)
+	app.OnStop("authorization sweeper", sweeper.Stop)
+	verifier := auth.NewVerifier(authConfig)
+	paymentHandler := handlers.NewPaymentHandler(paymentService, verifier, gateway.NewStripeWebhook(gatewayConfig.StripeWebhookSecret), idempotency.NewStore(db, idempotencyConfig))
 
-	// Add middleware
-	router.Use(gin.Logger())
-	router.Use(gin.Recovery())
+	checker := health.NewChecker()
+	checker.Add("database", health.Database(db), health.Options{Timeout: 2 * time.Second, CacheTTL: 2 * time.Second})
+	if gatewayConfig.Kind == gateway.KindStripe {
+		checker.Add("payment-gateway", health.HTTP(http.DefaultClient, cmp.Or(gatewayConfig.StripeAPIURL, stripe.APIURL)), health.Options{Timeout: 3 * time.Second, CacheTTL: 30 * time.Second})
+	}
 
-	// Register routes
+	router := httpserver.NewRouter(serverConfig, serviceMetrics)
+	checker.RegisterRoutes(router)
+	serviceMetrics.RegisterRoutes(router)
 	paymentHandler.RegisterRoutes(router)
+	logging.RegisterRoutes(router.Group("", auth.Enforce(verifier, handlers.RoutePolicy)))
 
-	// Start the server
-	port := GetEnvOrDefault("PORT", "8080")
-	log.Printf("Payment service starting on port %s", port)
-	if err := router.Run(fmt.Sprintf(":%s", port)); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
-	}
-}
-
-func GetEnvOrDefault(key, defaultValue string) string {
-	value := os.Getenv(key)
-	if value == "" {
-		return defaultValue
+	if err := app.Run(httpserver.New(serverConfig, router)); err != nil {
+		logging.Fatal("Server stopped with error", err)
 	}
-	return value
 }
@@ -0,0 +1,209 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Card tokens that script the fake gateway. Any other token succeeds.
+const (
+	// TokenDeclined declines with the generic card_declined code. Longer
+	// tokens name the decline code, for example tok_chargeDeclinedInsufficientFunds
+	// declines with insufficient_funds.
+	TokenDeclined = "tok_chargeDeclined"
+	// TokenTimeout never answers, so the call fails once its context expires.
+	TokenTimeout = "tok_timeout"
+	// TokenRequiresAction leaves the charge waiting for 3-D Secure.
+	TokenRequiresAction = "tok_threeDSecure2Required"
+	// TokenProcessing leaves the charge processing, as with a delayed
+	// settlement.
+	TokenProcessing = "tok_processing"
+	// TokenRequiresPaymentMethod confirms without error but leaves the charge
+	// needing another payment method, as Stripe does after some failures.
+	TokenRequiresPaymentMethod = "tok_requiresPaymentMethod"
+)
+
+// fakeTimeout bounds a TokenTimeout call whose context has no deadline.
+const fakeTimeout = 30 * time.Second
+
+// FakeGateway is an in-memory PaymentGateway for local development and
+// contract tests. Its charges are scripted by the card token and live only as
+// long as the process.
+type FakeGateway struct {
+	mu       sync.Mutex
+	charges  map[string]*Charge
+	refunded map[string]int64
+	// idempotent maps an idempotency key to the charge it created
+	idempotent map[string]string
+}
+
+func NewFakeGateway() *FakeGateway {
+	return &FakeGateway{
+		charges:    make(map[string]*Charge),
+		refunded:   make(map[string]int64),
+		idempotent: make(map[string]string),
+	}
+}
+
+func (g *FakeGateway) Authorize(ctx context.Context, request AuthorizeRequest) (Charge, error) {
+	if request.Amount <= 0 {
+		return Charge{}, fmt.Errorf("%w: amount must be positive", ErrInvalidRequest)
+	}
+	if request.IdempotencyKey != "" {
+		g.mu.Lock()
+		id, ok := g.idempotent[request.IdempotencyKey]
+		g.mu.Unlock()
+		if ok {
+			return g.Retrieve(ctx, id)
+		}
+	}
+
+	charge := Charge{
+		ID:     "pi_fake_" + uuid.New().String(),
+		Status: ChargeSucceeded,
+		Amount: request.Amount,
+	}
+	switch token := request.CardToken; {
+	case strings.HasPrefix(token, TokenDeclined):
+		return Charge{}, &DeclinedError{Code: declineCode(token), Message: "Your card was declined."}
+	case token == TokenTimeout:
+		ctx, cancel := context.WithTimeout(ctx, fakeTimeout)
+		defer cancel()
+		<-ctx.Done()
+		return Charge{}, fmt.Errorf("%w: %w", ErrTimeout, ctx.Err())
+	case token == TokenRequiresAction:
+		charge.Status = ChargeRequiresAction
+		charge.ClientSecret = charge.ID + "_secret_fake"
+	case token == TokenProcessing:
+		charge.Status = ChargeProcessing
+	case token == TokenRequiresPaymentMethod:
+		charge.Status = ChargeRequiresPaymentMethod
+	case !request.Capture:
+		charge.Status = ChargeRequiresCapture
+	default:
+		charge.AmountCaptured = request.Amount
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.charges[charge.ID] = &charge
+	if request.IdempotencyKey != "" {
+		g.idempotent[request.IdempotencyKey] = charge.ID
+	}
+	return charge, nil
+}
+
+func (g *FakeGateway) Capture(_ context.Context, _, chargeID string, amount int64) (Charge, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	charge, err := g.charge(chargeID)
+	if err != nil {
+		return Charge{}, err
+	}
+	if charge.Status != ChargeRequiresCapture {
+		return Charge{}, fmt.Errorf("%w: charge %s is %s", ErrInvalidRequest, chargeID, charge.Status)
+	}
+	if amount == 0 {
+		amount = charge.Amount
+	}
+	if amount < 0 || amount > charge.Amount {
+		return Charge{}, fmt.Errorf("%w: capture amount must be between 1 and %d", ErrInvalidRequest, charge.Amount)
+	}
+
+	charge.Status = ChargeSucceeded
+	charge.AmountCaptured = amount
+	return *charge, nil
+}
+
+func (g *FakeGateway) Void(_ context.Context, _, chargeID string) (Charge, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	charge, err := g.charge(chargeID)
+	if err != nil {
+		return Charge{}, err
+	}
+	switch charge.Status {
+	case ChargeRequiresCapture, ChargeRequiresAction, ChargeRequiresPaymentMethod, ChargeProcessing:
+	default:
+		return Charge{}, fmt.Errorf("%w: charge %s is %s", ErrInvalidRequest, chargeID, charge.Status)
+	}
+
+	charge.Status = ChargeCanceled
+	return *charge, nil
+}
+
+func (g *FakeGateway) Refund(_ context.Context, request RefundRequest) (Refund, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	charge, err := g.charge(request.ChargeID)
+	if err != nil {
+		return Refund{}, err
+	}
+	if charge.Status != ChargeSucceeded {
+		return Refund{}, fmt.Errorf("%w: charge %s is %s", ErrInvalidRequest, request.ChargeID, charge.Status)
+	}
+	remaining := charge.AmountCaptured - g.refunded[charge.ID]
+	amount := request.Amount
+	if amount == 0 {
+		amount = remaining
+	}
+	if amount <= 0 || amount > remaining {
+		return Refund{}, fmt.Errorf("%w: refund amount must be between 1 and %d", ErrInvalidRequest, remaining)
+	}
+
+	g.refunded[charge.ID] += amount
+	return Refund{
+		ID:       "re_fake_" + uuid.New().String(),
+		ChargeID: charge.ID,
+		Status:   RefundSucceeded,
+		Amount:   amount,
+	}, nil
+}
+
+func (g *FakeGateway) Retrieve(_ context.Context, chargeID string) (Charge, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	charge, err := g.charge(chargeID)
+	if err != nil {
+		return Charge{}, err
+	}
+	return *charge, nil
+}
+
+// charge must be called with g.mu held.
+func (g *FakeGateway) charge(id string) (*Charge, error) {
+	charge, ok := g.charges[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: no such charge %s", ErrInvalidRequest, id)
+	}
+	return charge, nil
+}
+
+// declineCode turns the suffix of a TokenDeclined token into a Stripe style
+// decline code: tok_chargeDeclinedExpiredCard becomes expired_card.
+func declineCode(token string) string {
+	suffix := strings.TrimPrefix(token, TokenDeclined)
+	if suffix == "" {
+		return "card_declined"
+	}
+	var code strings.Builder
+	for i, r := range suffix {
+		if r >= 'A' && r <= 'Z' {
+			if i > 0 {
+				code.WriteByte('_')
+			}
+			r += 'a' - 'A'
+		}
+		code.WriteRune(r)
+	}
+	return code.String()
+}
@@ -0,0 +1,160 @@
+// Package gateway abstracts the payment provider so payment-service can run
+// against Stripe in production and an in-memory fake in local development
+// and contract tests.
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/apperrors"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/config"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/metrics"
+)
+
+const (
+	KindStripe = "stripe"
+	KindFake   = "fake"
+)
+
+// ChargeStatus is the provider-neutral state of a charge. The values follow
+// Stripe's PaymentIntent statuses.
+type ChargeStatus string
+
+const (
+	ChargeSucceeded             ChargeStatus = "succeeded"
+	ChargeProcessing            ChargeStatus = "processing"
+	ChargeRequiresAction        ChargeStatus = "requires_action"
+	ChargeRequiresPaymentMethod ChargeStatus = "requires_payment_method"
+	ChargeRequiresCapture       ChargeStatus = "requires_capture"
+	ChargeCanceled              ChargeStatus = "canceled"
+)
+
+type RefundStatus string
+
+const (
+	RefundPending   RefundStatus = "pending"
+	RefundSucceeded RefundStatus = "succeeded"
+	RefundFailed    RefundStatus = "failed"
+	RefundCanceled  RefundStatus = "canceled"
+)
+
+var (
+	// ErrDeclined is matched by every DeclinedError.
+	ErrDeclined = errors.New("payment declined")
+	// ErrTimeout means the provider did not answer in time. The charge may or
+	// may not have been made, so it should be retrieved before retrying.
+	ErrTimeout = errors.New("payment provider timed out")
+	// ErrInvalidRequest means the provider rejected the request itself, such
+	// as capturing more than was authorized.
+	ErrInvalidRequest = errors.New("invalid payment request")
+)
+
+// DeclinedError reports a card the issuer refused. It counts as a client
+// error and maps to 402 Payment Required.
+type DeclinedError struct {
+	Code    string
+	Message string
+}
+
+func (e *DeclinedError) Error() string {
+	return fmt.Sprintf("payment declined (%s): %s", e.Code, e.Message)
+}
+
+func (e *DeclinedError) Is(target error) bool {
+	return target == ErrDeclined || target == apperrors.ErrPaymentRequired
+}
+
+type AuthorizeRequest struct {
+	PaymentID   string
+	UserID      string
+	OrderID     string
+	Amount      int64
+	Currency    string
+	Description string
+	CardToken   string
+	// Capture takes the money in the same call. Otherwise the charge is held
+	// in ChargeRequiresCapture until Capture is called.
+	Capture bool
+	// IdempotencyKey, when set, makes a repeated request return the first
+	// one's charge instead of charging again.
+	IdempotencyKey string
+}
+
+type RefundRequest struct {
+	// RefundID is this service's ID for the refund, kept in the provider's
+	// metadata so webhook events can be matched to it.
+	RefundID string
+	ChargeID string
+	// Amount is the part of the captured amount to return; zero refunds
+	// whatever has not been refunded yet.
+	Amount int64
+	// Reason is duplicate, fraudulent, requested_by_customer or empty.
+	Reason string
+}
+
+type Charge struct {
+	ID             string
+	Status         ChargeStatus
+	Amount         int64
+	AmountCaptured int64
+	// ClientSecret lets the client finish a charge in ChargeRequiresAction,
+	// for example with 3-D Secure in Stripe.js.
+	ClientSecret string
+}
+
+type Refund struct {
+	ID       string
+	ChargeID string
+	Status   RefundStatus
+	Amount   int64
+}
+
+// PaymentGateway charges and refunds cards through a payment provider.
+type PaymentGateway interface {
+	Authorize(ctx context.Context, request AuthorizeRequest) (Charge, error)
+	// Capture takes amount, or the whole authorization when zero, from a
+	// charge in ChargeRequiresCapture. paymentID keys the provider request,
+	// so a retried capture is not applied twice.
+	Capture(ctx context.Context, paymentID, chargeID string, amount int64) (Charge, error)
+	// Void cancels a charge that has not been captured, releasing the hold on
+	// the card. paymentID keys the provider request like Capture's.
+	Void(ctx context.Context, paymentID, chargeID string) (Charge, error)
+	// Refund is keyed by request.RefundID, so a retry returns the same refund.
+	Refund(ctx context.Context, request RefundRequest) (Refund, error)
+	Retrieve(ctx context.Context, chargeID string) (Charge, error)
+}
+
+type Config struct {
+	Kind      string
+	StripeKey string
+	// StripeAPIURL overrides the Stripe API base URL, for example to use
+	// stripe-mock.
+	StripeAPIURL string
+	// StripeWebhookSecret verifies Stripe webhook deliveries.
+	StripeWebhookSecret string
+}
+
+func ConfigFromEnv(env *config.Env) Config {
+	return Config{
+		Kind:                env.String("PAYMENT_GATEWAY", KindStripe),
+		StripeKey:           env.String("STRIPE_SECRET_KEY", "pk_test_51QzteqEN3C714OAmopACj4peCAlnLnU5o4LSQlaMg0m3q5XV0GwZ1vVbHTh2YBktcIVFN2us9vevw8lsPuCPz1dk00Eu1o6Rb7"), // Default test key for development
+		StripeAPIURL:        env.String("STRIPE_API_URL", ""),
+		StripeWebhookSecret: env.String("STRIPE_WEBHOOK_SECRET", ""),
+	}
+}
+
+// New returns the gateway selected by config. httpClient and outbound are
+// only used by the Stripe gateway.
+func New(config Config, httpClient *http.Client, outbound metrics.Outbound) (PaymentGateway, error) {
+	switch config.Kind {
+	case KindStripe:
+		return NewStripeGateway(config.StripeKey, config.StripeAPIURL, httpClient, outbound), nil
+	case KindFake:
+		return NewFakeGateway(), nil
+	default:
+		return nil, fmt.Errorf("unsupported payment gateway %q", config.Kind)
+	}
+}
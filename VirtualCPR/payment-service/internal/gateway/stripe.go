@@ -0,0 +1,233 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/metrics"
+	"github.com/stripe/stripe-go/v81"
+	"github.com/stripe/stripe-go/v81/client"
+)
+
+// StripeGateway charges cards with Stripe PaymentIntents. It uses its own API
+// client rather than the package-level stripe.Key, so several can coexist.
+type StripeGateway struct {
+	api     *client.API
+	metrics metrics.Outbound
+}
+
+// NewStripeGateway talks to apiURL, or to Stripe itself when it is empty.
+// Pointing apiURL at stripe-mock exercises the real client offline.
+func NewStripeGateway(key, apiURL string, httpClient *http.Client, outbound metrics.Outbound) *StripeGateway {
+	backendConfig := &stripe.BackendConfig{HTTPClient: httpClient}
+	if apiURL != "" {
+		backendConfig.URL = stripe.String(apiURL)
+	}
+	return &StripeGateway{
+		api:     client.New(key, stripe.NewBackendsWithConfig(backendConfig)),
+		metrics: outbound,
+	}
+}
+
+// Authorize turns the card token into a PaymentMethod and confirms a
+// PaymentIntent with it.
+func (g *StripeGateway) Authorize(ctx context.Context, request AuthorizeRequest) (Charge, error) {
+	paymentMethod, err := g.paymentMethod(ctx, request.CardToken, request.IdempotencyKey)
+	if err != nil {
+		return Charge{}, err
+	}
+
+	captureMethod := stripe.PaymentIntentCaptureMethodAutomatic
+	if !request.Capture {
+		captureMethod = stripe.PaymentIntentCaptureMethodManual
+	}
+	params := &stripe.PaymentIntentParams{
+		Amount:      stripe.Int64(request.Amount),
+		Currency:    stripe.String(request.Currency),
+		Description: stripe.String(request.Description),
+		PaymentMethodTypes: stripe.StringSlice([]string{
+			"card",
+		}),
+		PaymentMethod: stripe.String(paymentMethod),
+		CaptureMethod: stripe.String(string(captureMethod)),
+		Confirm:       stripe.Bool(true),
+		Metadata: map[string]string{
+			"payment_id": request.PaymentID,
+			"user_id":    request.UserID,
+		},
+	}
+	if request.OrderID != "" {
+		params.Metadata["order_id"] = request.OrderID
+	}
+	params.Context = ctx
+	if request.IdempotencyKey != "" {
+		params.SetIdempotencyKey(request.IdempotencyKey + "-payment-intent")
+	}
+
+	started := time.Now()
+	intent, err := g.api.PaymentIntents.New(params)
+	err = stripeError(err)
+	g.metrics.ObserveOutbound("stripe", "create_payment_intent", started, err)
+	if err != nil {
+		return Charge{}, err
+	}
+	return chargeFromIntent(intent), nil
+}
+
+func (g *StripeGateway) paymentMethod(ctx context.Context, cardToken, idempotencyKey string) (string, error) {
+	params := &stripe.PaymentMethodParams{
+		Type: stripe.String(string(stripe.PaymentMethodTypeCard)),
+		Card: &stripe.PaymentMethodCardParams{Token: stripe.String(cardToken)},
+	}
+	params.Context = ctx
+	// Each Stripe request needs its own key, and a retry must reuse the
+	// payment method so the PaymentIntent parameters match the first attempt
+	if idempotencyKey != "" {
+		params.SetIdempotencyKey(idempotencyKey + "-payment-method")
+	}
+
+	started := time.Now()
+	method, err := g.api.PaymentMethods.New(params)
+	err = stripeError(err)
+	g.metrics.ObserveOutbound("stripe", "create_payment_method", started, err)
+	if err != nil {
+		return "", err
+	}
+	return method.ID, nil
+}
+
+func (g *StripeGateway) Capture(ctx context.Context, paymentID, chargeID string, amount int64) (Charge, error) {
+	params := &stripe.PaymentIntentCaptureParams{}
+	if amount > 0 {
+		params.AmountToCapture = stripe.Int64(amount)
+	}
+	params.Context = ctx
+	params.SetIdempotencyKey(paymentID + "-capture")
+
+	started := time.Now()
+	intent, err := g.api.PaymentIntents.Capture(chargeID, params)
+	err = stripeError(err)
+	g.metrics.ObserveOutbound("stripe", "capture_payment_intent", started, err)
+	if err != nil {
+		return Charge{}, err
+	}
+	return chargeFromIntent(intent), nil
+}
+
+func (g *StripeGateway) Void(ctx context.Context, paymentID, chargeID string) (Charge, error) {
+	params := &stripe.PaymentIntentCancelParams{}
+	params.Context = ctx
+	params.SetIdempotencyKey(paymentID + "-void")
+
+	started := time.Now()
+	intent, err := g.api.PaymentIntents.Cancel(chargeID, params)
+	err = stripeError(err)
+	g.metrics.ObserveOutbound("stripe", "cancel_payment_intent", started, err)
+	if err != nil {
+		return Charge{}, err
+	}
+	return chargeFromIntent(intent), nil
+}
+
+func (g *StripeGateway) Refund(ctx context.Context, request RefundRequest) (Refund, error) {
+	params := &stripe.RefundParams{
+		PaymentIntent: stripe.String(request.ChargeID),
+		Metadata: map[string]string{
+			"refund_id": request.RefundID,
+		},
+	}
+	if request.Amount > 0 {
+		params.Amount = stripe.Int64(request.Amount)
+	}
+	if request.Reason != "" {
+		params.Reason = stripe.String(request.Reason)
+	}
+	params.Context = ctx
+	params.SetIdempotencyKey(request.RefundID)
+
+	started := time.Now()
+	refund, err := g.api.Refunds.New(params)
+	err = stripeError(err)
+	g.metrics.ObserveOutbound("stripe", "create_refund", started, err)
+	if err != nil {
+		return Refund{}, err
+	}
+	return refundFromStripe(refund), nil
+}
+
+func (g *StripeGateway) Retrieve(ctx context.Context, chargeID string) (Charge, error) {
+	params := &stripe.PaymentIntentParams{}
+	params.Context = ctx
+
+	started := time.Now()
+	intent, err := g.api.PaymentIntents.Get(chargeID, params)
+	err = stripeError(err)
+	g.metrics.ObserveOutbound("stripe", "retrieve_payment_intent", started, err)
+	if err != nil {
+		return Charge{}, err
+	}
+	return chargeFromIntent(intent), nil
+}
+
+func chargeFromIntent(intent *stripe.PaymentIntent) Charge {
+	return Charge{
+		ID:             intent.ID,
+		Status:         ChargeStatus(intent.Status),
+		Amount:         intent.Amount,
+		AmountCaptured: intent.AmountReceived,
+		ClientSecret:   intent.ClientSecret,
+	}
+}
+
+func refundFromStripe(refund *stripe.Refund) Refund {
+	converted := Refund{
+		ID:     refund.ID,
+		Status: refundStatus(refund.Status),
+		Amount: refund.Amount,
+	}
+	if refund.PaymentIntent != nil {
+		converted.ChargeID = refund.PaymentIntent.ID
+	}
+	return converted
+}
+
+func refundStatus(status stripe.RefundStatus) RefundStatus {
+	switch status {
+	case stripe.RefundStatusSucceeded:
+		return RefundSucceeded
+	case stripe.RefundStatusFailed:
+		return RefundFailed
+	case stripe.RefundStatusCanceled:
+		return RefundCanceled
+	default:
+		return RefundPending
+	}
+}
+
+// stripeError translates Stripe's card and request errors into this
+// package's errors so callers do not depend on the Stripe SDK.
+func stripeError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var stripeErr *stripe.Error
+	if errors.As(err, &stripeErr) {
+		switch stripeErr.Type {
+		case stripe.ErrorTypeCard:
+			code := string(stripeErr.DeclineCode)
+			if code == "" {
+				code = string(stripeErr.Code)
+			}
+			return &DeclinedError{Code: code, Message: stripeErr.Msg}
+		case stripe.ErrorTypeInvalidRequest:
+			return fmt.Errorf("%w: %s", ErrInvalidRequest, stripeErr.Msg)
+		}
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+	return err
+}
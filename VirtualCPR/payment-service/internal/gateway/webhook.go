@@ -0,0 +1,121 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+	"github.com/stripe/stripe-go/v81/webhook"
+)
+
+// ErrInvalidSignature means a webhook did not come from the provider, was
+// altered, or is too old to be replayed.
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// EventKind says how an event affects a payment. Events of any other kind are
+// acknowledged and ignored.
+type EventKind string
+
+const (
+	// EventCharge carries the charge's new status.
+	EventCharge EventKind = "charge"
+	// EventDisputeOpened means the cardholder disputed the charge.
+	EventDisputeOpened EventKind = "dispute_opened"
+	// EventDisputeWon means a dispute was settled in the merchant's favour.
+	EventDisputeWon EventKind = "dispute_won"
+	// EventRefund carries a refund's new status.
+	EventRefund EventKind = "refund"
+)
+
+// Event is a provider notification about a charge.
+type Event struct {
+	ID      string
+	Type    string
+	Kind    EventKind
+	Created time.Time
+	// PaymentID is the payment named in the charge's metadata, when the
+	// event includes it.
+	PaymentID string
+	Charge    Charge
+	// RefundID is the refund named in the refund's metadata, when the event
+	// includes it. Refund is only set for EventRefund.
+	RefundID string
+	Refund   Refund
+}
+
+// StripeWebhook verifies and decodes Stripe webhook deliveries.
+type StripeWebhook struct {
+	secret string
+}
+
+// NewStripeWebhook verifies deliveries signed with secret, the endpoint's
+// signing secret from the Stripe dashboard. With an empty secret every
+// delivery is rejected.
+func NewStripeWebhook(secret string) *StripeWebhook {
+	return &StripeWebhook{secret: secret}
+}
+
+// Parse checks the Stripe-Signature header against payload and decodes the
+// event.
+func (w *StripeWebhook) Parse(payload []byte, signature string) (Event, error) {
+	if w.secret == "" {
+		return Event{}, fmt.Errorf("%w: no webhook secret is configured", ErrInvalidSignature)
+	}
+	event, err := webhook.ConstructEventWithOptions(payload, signature, w.secret, webhook.ConstructEventOptions{
+		// Only fields that are stable across API versions are read
+		IgnoreAPIVersionMismatch: true,
+	})
+	if err != nil {
+		return Event{}, fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+	}
+
+	parsed := Event{
+		ID:      event.ID,
+		Type:    string(event.Type),
+		Created: time.Unix(event.Created, 0),
+	}
+	switch event.Type {
+	case stripe.EventTypePaymentIntentSucceeded,
+		stripe.EventTypePaymentIntentProcessing,
+		stripe.EventTypePaymentIntentRequiresAction,
+		stripe.EventTypePaymentIntentPaymentFailed,
+		stripe.EventTypePaymentIntentCanceled,
+		stripe.EventTypePaymentIntentAmountCapturableUpdated:
+		var intent stripe.PaymentIntent
+		if err := json.Unmarshal(event.Data.Raw, &intent); err != nil {
+			return Event{}, fmt.Errorf("failed to decode %s event: %w", event.Type, err)
+		}
+		parsed.Kind = EventCharge
+		parsed.PaymentID = intent.Metadata["payment_id"]
+		parsed.Charge = chargeFromIntent(&intent)
+
+	case stripe.EventTypeRefundUpdated, stripe.EventTypeRefundFailed, stripe.EventTypeChargeRefundUpdated:
+		var refund stripe.Refund
+		if err := json.Unmarshal(event.Data.Raw, &refund); err != nil {
+			return Event{}, fmt.Errorf("failed to decode %s event: %w", event.Type, err)
+		}
+		parsed.Kind = EventRefund
+		parsed.RefundID = refund.Metadata["refund_id"]
+		parsed.Refund = refundFromStripe(&refund)
+		parsed.Charge.ID = parsed.Refund.ChargeID
+
+	case stripe.EventTypeChargeDisputeCreated, stripe.EventTypeChargeDisputeClosed:
+		var dispute stripe.Dispute
+		if err := json.Unmarshal(event.Data.Raw, &dispute); err != nil {
+			return Event{}, fmt.Errorf("failed to decode %s event: %w", event.Type, err)
+		}
+		if dispute.PaymentIntent == nil {
+			break
+		}
+		parsed.Charge.ID = dispute.PaymentIntent.ID
+		switch {
+		case event.Type == stripe.EventTypeChargeDisputeCreated:
+			parsed.Kind = EventDisputeOpened
+		case dispute.Status == stripe.DisputeStatusWon:
+			parsed.Kind = EventDisputeWon
+		}
+	}
+	return parsed, nil
+}
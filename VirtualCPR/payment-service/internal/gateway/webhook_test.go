@@ -0,0 +1,71 @@
+package gateway
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v81/webhook"
+)
+
+const testWebhookSecret = "whsec_webhook_test"
+
+const succeededEvent = `{
+  "id": "evt_1",
+  "object": "event",
+  "type": "payment_intent.succeeded",
+  "created": 1760000000,
+  "data": {"object": {
+    "id": "pi_1",
+    "object": "payment_intent",
+    "status": "succeeded",
+    "amount": 1250,
+    "amount_received": 1250,
+    "metadata": {"payment_id": "payment-1"}
+  }}
+}`
+
+func TestStripeWebhookParse(t *testing.T) {
+	sign := func(secret string, at time.Time) string {
+		return webhook.GenerateTestSignedPayload(&webhook.UnsignedPayload{
+			Payload:   []byte(succeededEvent),
+			Secret:    secret,
+			Timestamp: at,
+		}).Header
+	}
+	tests := []struct {
+		name      string
+		secret    string
+		signature string
+		wantErr   error
+	}{
+		{"signed", testWebhookSecret, sign(testWebhookSecret, time.Now()), nil},
+		{"missing signature", testWebhookSecret, "", ErrInvalidSignature},
+		{"signed with another secret", testWebhookSecret, sign("whsec_someone_else", time.Now()), ErrInvalidSignature},
+		{"malformed signature", testWebhookSecret, "t=1760000000,v1=not-hex", ErrInvalidSignature},
+		// A captured delivery cannot be replayed once it is older than
+		// Stripe's tolerance
+		{"outside tolerance", testWebhookSecret, sign(testWebhookSecret, time.Now().Add(-webhook.DefaultTolerance-time.Minute)), ErrInvalidSignature},
+		{"no secret configured", "", sign("", time.Now()), ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := NewStripeWebhook(tt.secret).Parse([]byte(succeededEvent), tt.signature)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Parse() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if event.ID != "evt_1" || event.Kind != EventCharge || event.PaymentID != "payment-1" {
+				t.Errorf("Parse() = %+v, want charge event evt_1 for payment-1", event)
+			}
+			if event.Charge.ID != "pi_1" || event.Charge.Status != ChargeSucceeded || event.Charge.AmountCaptured != 1250 {
+				t.Errorf("Parse() charge = %+v, want pi_1 succeeded with 1250 captured", event.Charge)
+			}
+			if !event.Created.Equal(time.Unix(1760000000, 0)) {
+				t.Errorf("Parse() created = %s, want the event's creation time", event.Created)
+			}
+		})
+	}
+}
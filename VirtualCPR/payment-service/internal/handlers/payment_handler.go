@@ -1,47 +1,114 @@
 package handlers
 
 import (
+	"errors"
+	"io"
+	"net/http"
+
 	"github.com/gin-gonic/gin"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/payment-service/internal/gateway"
 	"github.com/robaa12/keploy-ContractTesting-MicroServices/payment-service/internal/models"
 	"github.com/robaa12/keploy-ContractTesting-MicroServices/payment-service/internal/service"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/apperrors"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/auth"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/idempotency"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/logging"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/pagination"
 )
 
+// maxWebhookBytes bounds a webhook payload. Stripe's events are far smaller.
+const maxWebhookBytes = 1 << 20
+
 type PaymentHandler struct {
 	paymentService service.PaymentService
+	verifier       *auth.Verifier
+	webhook        *gateway.StripeWebhook
+	idempotency    *idempotency.Store
 }
 
-func NewPaymentHandler(paymentService service.PaymentService) *PaymentHandler {
+func NewPaymentHandler(paymentService service.PaymentService, verifier *auth.Verifier, webhook *gateway.StripeWebhook, keys *idempotency.Store) *PaymentHandler {
 	return &PaymentHandler{
 		paymentService: paymentService,
+		verifier:       verifier,
+		webhook:        webhook,
+		idempotency:    keys,
 	}
 }
 
+// RoutePolicy declares who may call each payment route.
+var RoutePolicy = auth.Policy{
+	{Method: http.MethodPost, Path: "/payments", Roles: []auth.Role{auth.RoleCustomer, auth.RoleAdmin, auth.RoleService}},
+	// order-service refunds the payment of a checkout it could not complete
+	{Method: http.MethodPost, Path: "/payments/:id/refunds", Roles: []auth.Role{auth.RoleSupport, auth.RoleAdmin, auth.RoleService}},
+	{Method: http.MethodPost, Path: "/payments/:id/capture", Roles: []auth.Role{auth.RoleCustomer, auth.RoleSupport, auth.RoleAdmin, auth.RoleService}},
+	{Method: http.MethodPost, Path: "/payments/:id/void", Roles: []auth.Role{auth.RoleCustomer, auth.RoleSupport, auth.RoleAdmin, auth.RoleService}},
+	// Stripe authenticates with the Stripe-Signature header instead of a token
+	{Method: http.MethodPost, Path: "/payments/webhooks/stripe", Public: true},
+	{Method: http.MethodGet, Path: "/payments/:id", Roles: []auth.Role{auth.RoleCustomer, auth.RoleSupport, auth.RoleAdmin, auth.RoleService}},
+	{Method: http.MethodGet, Path: "/payments/user/:user_id", Roles: []auth.Role{auth.RoleSupport, auth.RoleAdmin}, SelfParam: "user_id"},
+	{Method: http.MethodGet, Path: logging.LevelsPath, Roles: []auth.Role{auth.RoleAdmin}},
+	{Method: http.MethodPut, Path: logging.LoggerLevelPath, Roles: []auth.Role{auth.RoleAdmin}},
+	{Method: http.MethodDelete, Path: logging.LoggerLevelPath, Roles: []auth.Role{auth.RoleAdmin}},
+}
+
 func (h *PaymentHandler) RegisterRoutes(router *gin.Engine) {
-	router.POST("/payments", h.CreatePayment)
-	router.GET("/payments/:id", h.GetPaymentByID)
-	router.GET("/payments/user/:user_id", h.ListPaymentsByUserID)
+	payments := router.Group("/payments")
+	payments.Use(auth.Enforce(h.verifier, RoutePolicy))
+	payments.POST("", h.idempotency.Middleware(auth.CallerID), h.CreatePayment)
+	payments.GET("/:id", h.GetPaymentByID)
+	payments.GET("/user/:user_id", h.ListPaymentsByUserID)
+	payments.POST("/:id/refunds", h.CreateRefund)
+	payments.POST("/:id/capture", h.CapturePayment)
+	payments.POST("/:id/void", h.VoidPayment)
+	payments.POST("/webhooks/stripe", h.StripeWebhook)
 }
 
 func (h *PaymentHandler) CreatePayment(c *gin.Context) {
 	var request models.CreatePaymentRequest
 	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(400, gin.H{"error": err.Error()})
+		c.Error(apperrors.InvalidRequest(err))
 		return
 	}
 
-	payment, err := h.paymentService.CreatePayment(request)
+	identity, _ := auth.IdentityFrom(c)
+	if err := authorizeCreate(identity, request); err != nil {
+		c.Error(err)
+		return
+	}
+
+	payment, err := h.paymentService.CreatePayment(c.Request.Context(), request)
 	if err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	c.JSON(201, payment)
 }
 
+// authorizeCreate checks that the caller may create the payment: one for
+// themselves, or for anyone as an admin or another service. Only order-service
+// may link a payment to an order, since payment-service cannot tell who owns
+// the order or what it costs; order-service checks both at checkout.
+func authorizeCreate(identity auth.Identity, request models.CreatePaymentRequest) error {
+	if !identity.CanWriteUser(request.UserID) {
+		return apperrors.Forbidden("cannot create payments for another user")
+	}
+	if request.OrderID != "" && identity.Role != auth.RoleService {
+		return apperrors.Forbidden("orders are paid for through order-service checkout")
+	}
+	return nil
+}
+
 func (h *PaymentHandler) GetPaymentByID(c *gin.Context) {
 	id := c.Param("id")
-	payment, err := h.paymentService.GetPaymentByID(id)
+	payment, err := h.paymentService.GetPaymentByID(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
+		c.Error(err)
+		return
+	}
+
+	identity, _ := auth.IdentityFrom(c)
+	if !identity.CanReadUser(payment.UserID) {
+		c.Error(apperrors.Forbidden("cannot access another user's payment"))
 		return
 	}
 	c.JSON(200, payment)
@@ -49,10 +116,117 @@ func (h *PaymentHandler) GetPaymentByID(c *gin.Context) {
 
 func (h *PaymentHandler) ListPaymentsByUserID(c *gin.Context) {
 	userID := c.Param("user_id")
-	payments, err := h.paymentService.ListPaymentsByUserID(userID)
+	params, err := pagination.ParseParams(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	filter := models.PaymentFilter{
+		Currency: c.Query("currency"),
+		Status:   models.PaymentStatus(c.Query("status")),
+	}
+	if filter.Status != "" && !filter.Status.IsValid() {
+		c.Error(apperrors.Validation("status must be one of: pending requires_action processing authorized capturing succeeded captured failed voiding voided partially_refunded refunded disputed"))
+		return
+	}
+
+	payments, next, err := h.paymentService.ListPaymentsByUserID(c.Request.Context(), userID, filter, params)
 	if err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
+		c.Error(err)
+		return
+	}
+	c.JSON(200, pagination.NewPage(c, payments, params, next))
+}
+
+// CreateRefund refunds part of a payment. An empty body refunds everything not
+// yet refunded.
+func (h *PaymentHandler) CreateRefund(c *gin.Context) {
+	var request models.CreateRefundRequest
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		c.Error(apperrors.InvalidRequest(err))
+		return
+	}
+
+	refund, err := h.paymentService.CreateRefund(c.Request.Context(), c.Param("id"), request)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(201, refund)
+}
+
+// CapturePayment takes the money held by an authorized payment. An empty body
+// captures the whole authorized amount.
+func (h *PaymentHandler) CapturePayment(c *gin.Context) {
+	var request models.CapturePaymentRequest
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		c.Error(apperrors.InvalidRequest(err))
+		return
+	}
+	if err := h.authorizeSettlement(c); err != nil {
+		c.Error(err)
+		return
+	}
+
+	payment, err := h.paymentService.CapturePayment(c.Request.Context(), c.Param("id"), request)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(200, payment)
+}
+
+// VoidPayment releases the money held by an authorized payment, or cancels
+// one still waiting for 3-D Secure.
+func (h *PaymentHandler) VoidPayment(c *gin.Context) {
+	if err := h.authorizeSettlement(c); err != nil {
+		c.Error(err)
+		return
+	}
+
+	payment, err := h.paymentService.VoidPayment(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(200, payment)
+}
+
+// authorizeSettlement checks that the caller may capture or void the payment
+// named in the path: its owner, support or an admin.
+func (h *PaymentHandler) authorizeSettlement(c *gin.Context) error {
+	payment, err := h.paymentService.GetPaymentByID(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+	identity, _ := auth.IdentityFrom(c)
+	if !identity.CanReadUser(payment.UserID) {
+		return apperrors.Forbidden("cannot change another user's payment")
+	}
+	return nil
+}
+
+// StripeWebhook applies a Stripe event to its payment. Any response other than
+// 2xx makes Stripe redeliver the event later.
+func (h *PaymentHandler) StripeWebhook(c *gin.Context) {
+	payload, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxWebhookBytes))
+	if err != nil {
+		c.Error(apperrors.Wrap(apperrors.ErrValidation, "failed to read webhook payload", err))
+		return
+	}
+	event, err := h.webhook.Parse(payload, c.GetHeader("Stripe-Signature"))
+	if errors.Is(err, gateway.ErrInvalidSignature) {
+		c.Error(apperrors.Wrap(apperrors.ErrUnauthorized, "invalid Stripe signature", err))
+		return
+	}
+	if err != nil {
+		c.Error(apperrors.Wrap(apperrors.ErrValidation, "invalid webhook payload", err))
+		return
+	}
+
+	if err := h.paymentService.HandleEvent(c.Request.Context(), event); err != nil {
+		c.Error(err)
 		return
 	}
-	c.JSON(200, payments)
+	c.JSON(http.StatusOK, gin.H{"received": true})
 }
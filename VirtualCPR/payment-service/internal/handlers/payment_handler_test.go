@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/payment-service/internal/gateway"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/payment-service/internal/models"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/payment-service/internal/repository"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/payment-service/internal/service"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/apperrors"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/auth"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/httpserver"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/metrics"
+)
+
+const (
+	handlerTestSecret  = "handler-test-secret-at-least-32-bytes"
+	handlerTestWebhook = "whsec_handler_test"
+)
+
+func TestAuthorizeCreate(t *testing.T) {
+	customer := auth.Identity{UserID: "user-1", Role: auth.RoleCustomer}
+	admin := auth.Identity{UserID: "admin-1", Role: auth.RoleAdmin}
+	orderService := auth.Identity{UserID: "order-service", Role: auth.RoleService}
+	tests := []struct {
+		name     string
+		identity auth.Identity
+		request  models.CreatePaymentRequest
+		wantErr  error
+	}{
+		{"customer pays for themselves", customer, models.CreatePaymentRequest{UserID: "user-1"}, nil},
+		{"customer pays for another user", customer, models.CreatePaymentRequest{UserID: "user-2"}, apperrors.ErrForbidden},
+		// An order's owner and amount are only known to order-service
+		{"customer pays for an order", customer, models.CreatePaymentRequest{UserID: "user-1", OrderID: "order-1"}, apperrors.ErrForbidden},
+		{"admin pays for an order", admin, models.CreatePaymentRequest{UserID: "user-1", OrderID: "order-1"}, apperrors.ErrForbidden},
+		{"admin pays for a user", admin, models.CreatePaymentRequest{UserID: "user-1"}, nil},
+		{"order-service pays for an order", orderService, models.CreatePaymentRequest{UserID: "user-1", OrderID: "order-1"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := authorizeCreate(tt.identity, tt.request)
+			if tt.wantErr == nil && err != nil || tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("authorizeCreate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// newTestRouter serves the payment routes from repo through the real service
+// and the fake gateway.
+func newTestRouter(t *testing.T, repo repository.PaymentRepository) (*gin.Engine, *auth.KeyManager) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	keys, err := auth.NewKeyManager(auth.KeyConfig{Algorithm: auth.AlgorithmHS256, Secret: handlerTestSecret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses := service.NewStatusUpdates(repo)
+	t.Cleanup(func() { statuses.Flush(context.Background()) })
+	payments := service.NewPaymentService(repo, statuses, gateway.NewFakeGateway(), service.AuthorizationConfig{TTL: time.Hour})
+
+	router := httpserver.NewRouter(httpserver.Config{Name: "payment-service"}, metrics.New("payment-service"))
+	NewPaymentHandler(payments, auth.NewVerifier(auth.Config{Secret: handlerTestSecret}), gateway.NewStripeWebhook(handlerTestWebhook), nil).RegisterRoutes(router)
+	return router, keys
+}
+
+// serve sends a JSON request as userID in role, or unauthenticated when role
+// is empty.
+func serve(t *testing.T, router *gin.Engine, keys *auth.KeyManager, role auth.Role, userID, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	if role != "" {
+		token, _, err := keys.Issue(userID, "", role)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestHandlersMapErrors(t *testing.T) {
+	cause := errors.New("dial tcp 10.0.0.7:5432: connection refused")
+	create := `{"user_id":"user-1","amount":1250,"currency":"usd","card_token":"tok_visa"}`
+	tests := []struct {
+		name   string
+		as     auth.Role
+		method string
+		path   string
+		body   string
+		errs   map[string]error
+		status int
+		fields []string
+	}{
+		{"found", auth.RoleCustomer, http.MethodGet, "/payments/payment-1", "", nil, http.StatusOK, nil},
+		{"missing row", auth.RoleCustomer, http.MethodGet, "/payments/payment-9", "", map[string]error{"GetPaymentByID": fmt.Errorf("scan payment: %w", sql.ErrNoRows)}, http.StatusNotFound, nil},
+		{"another user's payment", auth.RoleCustomer, http.MethodGet, "/payments/payment-2", "", nil, http.StatusForbidden, nil},
+		{"create", auth.RoleCustomer, http.MethodPost, "/payments", create, nil, http.StatusCreated, nil},
+		{"invalid body", auth.RoleCustomer, http.MethodPost, "/payments", `{"user_id":"user-1","amount":-5}`, nil, http.StatusBadRequest, []string{"amount", "currency", "card_token"}},
+		// The unique index on order_id caught a second payment for the order
+		{"order already paid", auth.RoleService, http.MethodPost, "/payments", `{"user_id":"user-1","order_id":"order-1","amount":1250,"currency":"usd","card_token":"tok_visa"}`, map[string]error{"CreatePayment": repository.ErrOrderAlreadyPaid}, http.StatusConflict, nil},
+		{"card declined", auth.RoleCustomer, http.MethodPost, "/payments", `{"user_id":"user-1","amount":1250,"currency":"usd","card_token":"tok_chargeDeclined"}`, nil, http.StatusPaymentRequired, nil},
+		{"refund missing payment", auth.RoleSupport, http.MethodPost, "/payments/payment-9/refunds", "", nil, http.StatusNotFound, nil},
+		{"unknown refund reason", auth.RoleSupport, http.MethodPost, "/payments/payment-1/refunds", `{"reason":"changed_my_mind"}`, nil, http.StatusBadRequest, []string{"reason"}},
+		{"capture voided payment", auth.RoleCustomer, http.MethodPost, "/payments/payment-3/capture", "", nil, http.StatusConflict, nil},
+		{"unsigned webhook", "", http.MethodPost, "/payments/webhooks/stripe", `{"id":"evt_1"}`, nil, http.StatusUnauthorized, nil},
+		{"database down", auth.RoleCustomer, http.MethodPost, "/payments", create, map[string]error{"CreatePayment": cause}, http.StatusInternalServerError, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newStubRepository(tt.errs,
+				models.Payment{ID: "payment-1", UserID: "user-1", Amount: 1250, AmountCaptured: 1250, Currency: "usd", Status: models.PaymentStatusSucceeded, StripeChargeID: "pi_1", CaptureMethod: models.CaptureAutomatic},
+				models.Payment{ID: "payment-2", UserID: "user-2", Amount: 900, Currency: "usd", Status: models.PaymentStatusSucceeded, CaptureMethod: models.CaptureAutomatic},
+				models.Payment{ID: "payment-3", UserID: "user-1", Amount: 400, Currency: "usd", Status: models.PaymentStatusVoided, StripeChargeID: "pi_3", CaptureMethod: models.CaptureManual},
+			)
+			router, keys := newTestRouter(t, repo)
+			recorder := serve(t, router, keys, tt.as, "user-1", tt.method, tt.path, tt.body)
+
+			if recorder.Code != tt.status {
+				t.Fatalf("status = %d, want %d; body = %s", recorder.Code, tt.status, recorder.Body)
+			}
+			if tt.status < http.StatusBadRequest {
+				return
+			}
+			if got := recorder.Header().Get("Content-Type"); got != apperrors.ProblemContentType {
+				t.Errorf("Content-Type = %q, want %q", got, apperrors.ProblemContentType)
+			}
+			var problem apperrors.Problem
+			if err := json.Unmarshal(recorder.Body.Bytes(), &problem); err != nil {
+				t.Fatalf("decoding problem: %v", err)
+			}
+			var fields []string
+			for _, field := range problem.Errors {
+				fields = append(fields, field.Field)
+			}
+			if fmt.Sprint(fields) != fmt.Sprint(tt.fields) {
+				t.Errorf("invalid fields = %v, want %v", fields, tt.fields)
+			}
+			if strings.Contains(recorder.Body.String(), "connection refused") {
+				t.Errorf("response leaks the cause: %s", recorder.Body)
+			}
+		})
+	}
+}
+
+func TestRefundsThroughHandlers(t *testing.T) {
+	router, keys := newTestRouter(t, newStubRepository(nil))
+	created := serve(t, router, keys, auth.RoleCustomer, "user-1", http.MethodPost, "/payments", `{"user_id":"user-1","amount":2500,"currency":"usd","card_token":"tok_visa"}`)
+	if created.Code != http.StatusCreated {
+		t.Fatalf("create status = %d; body = %s", created.Code, created.Body)
+	}
+	var payment models.PaymentResponse
+	if err := json.Unmarshal(created.Body.Bytes(), &payment); err != nil {
+		t.Fatal(err)
+	}
+	refunds := "/payments/" + payment.ID + "/refunds"
+
+	for _, step := range []struct {
+		body   string
+		status int
+	}{
+		{`{"amount":1000,"reason":"requested_by_customer"}`, http.StatusCreated},
+		{`{"amount":2000}`, http.StatusBadRequest},
+		// An empty body refunds the rest
+		{"", http.StatusCreated},
+		{"", http.StatusConflict},
+	} {
+		recorder := serve(t, router, keys, auth.RoleSupport, "support-1", http.MethodPost, refunds, step.body)
+		if recorder.Code != step.status {
+			t.Fatalf("refund %q status = %d, want %d; body = %s", step.body, recorder.Code, step.status, recorder.Body)
+		}
+	}
+
+	recorder := serve(t, router, keys, auth.RoleCustomer, "user-1", http.MethodGet, "/payments/"+payment.ID, "")
+	if err := json.Unmarshal(recorder.Body.Bytes(), &payment); err != nil {
+		t.Fatal(err)
+	}
+	var refunded int64
+	for _, refund := range payment.Refunds {
+		if refund.Status != models.RefundStatusSucceeded {
+			t.Errorf("refund %s status = %q, want %q", refund.ID, refund.Status, models.RefundStatusSucceeded)
+		}
+		refunded += refund.Amount
+	}
+	if payment.Status != models.PaymentStatusRefunded || len(payment.Refunds) != 2 || refunded != 2500 {
+		t.Errorf("payment = %s with %d refunds of %d in all, want refunded by two refunds of 2500", payment.Status, len(payment.Refunds), refunded)
+	}
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/payment-service/internal/models"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/payment-service/internal/repository"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/apperrors"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/pagination"
+)
+
+// stubRepository keeps payments and refunds in maps. A method with an error
+// set in errs fails with it instead, the way the Postgres repository reports a
+// missing row, a unique violation or a lost connection. Methods the handlers
+// never reach are left to the embedded nil interface.
+type stubRepository struct {
+	repository.PaymentRepository
+
+	mu       sync.Mutex
+	payments map[string]models.Payment
+	refunds  map[string]models.Refund
+	events   map[string]bool
+	errs     map[string]error
+}
+
+func newStubRepository(errs map[string]error, payments ...models.Payment) *stubRepository {
+	r := &stubRepository{
+		payments: make(map[string]models.Payment),
+		refunds:  make(map[string]models.Refund),
+		events:   make(map[string]bool),
+		errs:     errs,
+	}
+	for _, payment := range payments {
+		r.payments[payment.ID] = payment
+	}
+	return r
+}
+
+func (r *stubRepository) CreatePayment(ctx context.Context, payment models.Payment) (models.Payment, error) {
+	if err := r.errs["CreatePayment"]; err != nil {
+		return models.Payment{}, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.payments[payment.ID] = payment
+	return payment, nil
+}
+
+func (r *stubRepository) GetPaymentByID(ctx context.Context, id string) (models.Payment, error) {
+	if err := r.errs["GetPaymentByID"]; err != nil {
+		return models.Payment{}, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	payment, ok := r.payments[id]
+	if !ok {
+		return models.Payment{}, apperrors.NotFound("payment not found")
+	}
+	return payment, nil
+}
+
+func (r *stubRepository) GetPaymentByStripeChargeID(ctx context.Context, chargeID string) (models.Payment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, payment := range r.payments {
+		if payment.StripeChargeID == chargeID {
+			return payment, nil
+		}
+	}
+	return models.Payment{}, apperrors.NotFound("payment not found")
+}
+
+func (r *stubRepository) ListPaymentsByUserID(ctx context.Context, userID string, filter models.PaymentFilter, params pagination.Params) ([]models.Payment, error) {
+	if err := r.errs["ListPaymentsByUserID"]; err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (r *stubRepository) LockPayment(ctx context.Context, id string) (models.Payment, error) {
+	if err := r.errs["LockPayment"]; err != nil {
+		return models.Payment{}, err
+	}
+	return r.GetPaymentByID(ctx, id)
+}
+
+func (r *stubRepository) UpdatePayment(ctx context.Context, payment models.Payment) error {
+	if err := r.errs["UpdatePayment"]; err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.payments[payment.ID]; !ok {
+		return apperrors.NotFound("payment not found")
+	}
+	r.payments[payment.ID] = payment
+	return nil
+}
+
+func (r *stubRepository) CreateRefund(ctx context.Context, refund models.Refund) (models.Refund, error) {
+	if err := r.errs["CreateRefund"]; err != nil {
+		return models.Refund{}, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.refunds[refund.ID] = refund
+	return refund, nil
+}
+
+func (r *stubRepository) GetRefundByID(ctx context.Context, id string) (models.Refund, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	refund, ok := r.refunds[id]
+	if !ok {
+		return models.Refund{}, apperrors.NotFound("refund not found")
+	}
+	return refund, nil
+}
+
+func (r *stubRepository) GetRefundByStripeRefundID(ctx context.Context, stripeRefundID string) (models.Refund, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, refund := range r.refunds {
+		if refund.StripeRefundID == stripeRefundID {
+			return refund, nil
+		}
+	}
+	return models.Refund{}, apperrors.NotFound("refund not found")
+}
+
+func (r *stubRepository) ListRefundsByPaymentID(ctx context.Context, paymentID string) ([]models.Refund, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var refunds []models.Refund
+	for _, refund := range r.refunds {
+		if refund.PaymentID == paymentID {
+			refunds = append(refunds, refund)
+		}
+	}
+	return refunds, nil
+}
+
+func (r *stubRepository) UpdateRefund(ctx context.Context, refund models.Refund) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.refunds[refund.ID]; !ok {
+		return apperrors.NotFound("refund not found")
+	}
+	r.refunds[refund.ID] = refund
+	return nil
+}
+
+func (r *stubRepository) RecordEvent(ctx context.Context, eventID, eventType string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.events[eventID] {
+		return false, nil
+	}
+	r.events[eventID] = true
+	return true, nil
+}
+
+func (r *stubRepository) InTx(ctx context.Context, fn func(repo repository.PaymentRepository) error) error {
+	return fn(r)
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/auth"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/logging"
+)
+
+func TestRoutePolicy(t *testing.T) {
+	const self, other = "user-1", "user-2"
+	callers := map[string]*auth.Identity{
+		"anonymous": nil,
+		"customer":  {UserID: self, Role: auth.RoleCustomer},
+		"support":   {UserID: "support-1", Role: auth.RoleSupport},
+		"admin":     {UserID: "admin-1", Role: auth.RoleAdmin},
+		"service":   {UserID: "order-service", Role: auth.RoleService},
+	}
+	everyone := []string{"anonymous", "customer", "support", "admin", "service"}
+	tests := []struct {
+		method  string
+		path    string
+		params  gin.Params
+		allowed []string
+	}{
+		{http.MethodPost, "/payments", nil, []string{"customer", "admin", "service"}},
+		{http.MethodGet, "/payments/:id", nil, []string{"customer", "support", "admin", "service"}},
+		{http.MethodGet, "/payments/user/:user_id", gin.Params{{Key: "user_id", Value: self}}, []string{"customer", "support", "admin"}},
+		{http.MethodGet, "/payments/user/:user_id", gin.Params{{Key: "user_id", Value: other}}, []string{"support", "admin"}},
+		// Customers cannot refund their own payments
+		{http.MethodPost, "/payments/:id/refunds", nil, []string{"support", "admin", "service"}},
+		{http.MethodPost, "/payments/:id/capture", nil, []string{"customer", "support", "admin", "service"}},
+		{http.MethodPost, "/payments/:id/void", nil, []string{"customer", "support", "admin", "service"}},
+		{http.MethodPost, "/payments/webhooks/stripe", nil, everyone},
+		{http.MethodGet, logging.LevelsPath, nil, []string{"admin"}},
+		{http.MethodPut, logging.LoggerLevelPath, nil, []string{"admin"}},
+		{http.MethodDelete, logging.LoggerLevelPath, nil, []string{"admin"}},
+		// Routes without a rule are denied to everyone
+		{http.MethodDelete, "/payments/:id", nil, nil},
+	}
+
+	covered := map[string]bool{}
+	for _, tt := range tests {
+		covered[tt.method+" "+tt.path] = true
+		for name, identity := range callers {
+			want := false
+			for _, allowed := range tt.allowed {
+				want = want || allowed == name
+			}
+			err := RoutePolicy.Authorize(tt.method, tt.path, identity, tt.params)
+			if (err == nil) != want {
+				t.Errorf("%s %s %v as %s: error = %v, want allowed = %t", tt.method, tt.path, tt.params, name, err, want)
+			}
+		}
+	}
+	for _, rule := range RoutePolicy {
+		if !covered[rule.Method+" "+rule.Path] {
+			t.Errorf("route %s %s has no test case", rule.Method, rule.Path)
+		}
+	}
+}
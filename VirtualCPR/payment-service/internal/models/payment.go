@@ -5,51 +5,193 @@ import "time"
 type PaymentStatus string
 
 const (
-	PaymentStatusPending   PaymentStatus = "pending"
-	PaymentStatusSucceeded PaymentStatus = "succeeded"
-	PaymentStatusFailed    PaymentStatus = "failed"
+	PaymentStatusPending PaymentStatus = "pending"
+	// PaymentStatusRequiresAction waits for the customer to authenticate the
+	// card, using the client secret returned when the payment was created.
+	PaymentStatusRequiresAction PaymentStatus = "requires_action"
+	// PaymentStatusProcessing waits for the provider to settle the charge.
+	PaymentStatusProcessing PaymentStatus = "processing"
+	PaymentStatusSucceeded  PaymentStatus = "succeeded"
+	PaymentStatusFailed     PaymentStatus = "failed"
+	// PaymentStatusAuthorized holds the amount on the card of a payment made
+	// with CaptureManual until it is captured or voided.
+	PaymentStatusAuthorized PaymentStatus = "authorized"
+	// PaymentStatusCaptured is a manually captured payment's succeeded.
+	PaymentStatusCaptured PaymentStatus = "captured"
+	// PaymentStatusCapturing and PaymentStatusVoiding mark an authorization
+	// whose capture or void has been sent to the provider but not recorded
+	// yet, so the other cannot start meanwhile.
+	PaymentStatusCapturing PaymentStatus = "capturing"
+	PaymentStatusVoiding   PaymentStatus = "voiding"
+	// PaymentStatusVoided released an authorization without taking money.
+	PaymentStatusVoided PaymentStatus = "voided"
+	// PaymentStatusPartiallyRefunded and PaymentStatusRefunded follow
+	// succeeded or captured once refunds have returned part or all of the
+	// money.
+	PaymentStatusPartiallyRefunded PaymentStatus = "partially_refunded"
+	PaymentStatusRefunded          PaymentStatus = "refunded"
+	// PaymentStatusDisputed means the cardholder disputed a succeeded
+	// payment with their bank.
+	PaymentStatusDisputed PaymentStatus = "disputed"
 )
 
+// IsValid reports whether s is a known payment status.
+func (s PaymentStatus) IsValid() bool {
+	switch s {
+	case PaymentStatusPending, PaymentStatusRequiresAction, PaymentStatusProcessing, PaymentStatusSucceeded, PaymentStatusFailed,
+		PaymentStatusAuthorized, PaymentStatusCapturing, PaymentStatusCaptured, PaymentStatusVoiding, PaymentStatusVoided,
+		PaymentStatusPartiallyRefunded, PaymentStatusRefunded, PaymentStatusDisputed:
+		return true
+	}
+	return false
+}
+
+// CanTransition reports whether a payment in s may move to next. Updates that
+// arrive late or out of order are dropped rather than undo a later outcome: a
+// succeeded payment never goes back to processing, for example, while a failed
+// one may still succeed when the customer retries.
+func (s PaymentStatus) CanTransition(next PaymentStatus) bool {
+	if s == next {
+		return true
+	}
+	switch s {
+	case PaymentStatusPending:
+		return true
+	case PaymentStatusRequiresAction, PaymentStatusProcessing:
+		return next == PaymentStatusProcessing || next == PaymentStatusSucceeded || next == PaymentStatusFailed ||
+			next == PaymentStatusAuthorized || next == PaymentStatusVoiding || next == PaymentStatusVoided
+	case PaymentStatusFailed:
+		return next == PaymentStatusRequiresAction || next == PaymentStatusProcessing || next == PaymentStatusSucceeded || next == PaymentStatusAuthorized
+	case PaymentStatusAuthorized:
+		return next == PaymentStatusCapturing || next == PaymentStatusCaptured || next == PaymentStatusVoiding || next == PaymentStatusVoided
+	// A refused capture or void goes back to where it started
+	case PaymentStatusCapturing:
+		return next == PaymentStatusAuthorized || next == PaymentStatusCaptured || next == PaymentStatusVoided
+	case PaymentStatusVoiding:
+		return next == PaymentStatusRequiresAction || next == PaymentStatusProcessing || next == PaymentStatusSucceeded || next == PaymentStatusFailed ||
+			next == PaymentStatusAuthorized || next == PaymentStatusVoided
+	case PaymentStatusSucceeded, PaymentStatusCaptured, PaymentStatusPartiallyRefunded, PaymentStatusRefunded:
+		return next == PaymentStatusDisputed
+	}
+	return false
+}
+
+// Refundable reports whether money can be returned for a payment in s.
+func (s PaymentStatus) Refundable() bool {
+	return s == PaymentStatusSucceeded || s == PaymentStatusCaptured || s == PaymentStatusPartiallyRefunded
+}
+
+// CaptureMethod says when a payment's money is taken.
+type CaptureMethod string
+
+const (
+	// CaptureAutomatic charges the card as soon as the payment is created.
+	CaptureAutomatic CaptureMethod = "automatic"
+	// CaptureManual only authorizes the amount; it is taken by a capture.
+	CaptureManual CaptureMethod = "manual"
+)
+
+// PaymentFilter narrows a user's payment history by currency and status.
+type PaymentFilter struct {
+	Currency string
+	Status   PaymentStatus
+}
+
 type Payment struct {
 	ID             string        `json:"id"`
 	UserID         string        `json:"user_id"`
+	OrderID        string        `json:"order_id,omitempty"`
 	Amount         int64         `json:"amount"`
 	Currency       string        `json:"currency"`
 	Desc           string        `json:"desc,omitempty"`
 	Status         PaymentStatus `json:"status"`
 	StripeChargeID string        `json:"stripe_charge_id,omitempty"`
-	CreatedAt      time.Time     `json:"created_at"`
-	UpdatedAt      time.Time     `json:"updated_at"`
+	CaptureMethod  CaptureMethod `json:"capture_method"`
+	// AmountCaptured is the money actually taken, which refunds may return.
+	AmountCaptured int64 `json:"amount_captured"`
+	// AuthorizationExpiresAt is when an authorized payment left uncaptured is
+	// voided. It is zero for other payments.
+	AuthorizationExpiresAt time.Time `json:"authorization_expires_at,omitempty"`
+	// LastEventAt is the creation time of the newest provider event applied
+	// to the payment, used to drop older events delivered late.
+	LastEventAt time.Time `json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// SettledStatus is the status of a payment whose money has been taken, given
+// how much of it has since been refunded.
+func (p *Payment) SettledStatus(refunded int64) PaymentStatus {
+	switch {
+	case refunded >= p.AmountCaptured && refunded > 0:
+		return PaymentStatusRefunded
+	case refunded > 0:
+		return PaymentStatusPartiallyRefunded
+	case p.CaptureMethod == CaptureManual:
+		return PaymentStatusCaptured
+	default:
+		return PaymentStatusSucceeded
+	}
 }
 
 type CreatePaymentRequest struct {
 	UserID    string `json:"user_id" binding:"required"`
-	Amount    int64  `json:"amount" binding:"required"`
+	Amount    int64  `json:"amount" binding:"required,gt=0"`
 	Currency  string `json:"currency" binding:"required"`
 	Desc      string `json:"desc,omitempty"`
 	CardToken string `json:"card_token" binding:"required"`
+	// OrderID links the payment to an order. Only order-service may set it.
+	// A second payment for an order that already has one in progress or
+	// succeeded is rejected with 409.
+	OrderID string `json:"order_id,omitempty" binding:"omitempty,max=36"`
+	// CaptureMethod defaults to automatic. With manual the payment is only
+	// authorized, and must be captured or voided later.
+	CaptureMethod CaptureMethod `json:"capture_method,omitempty" binding:"omitempty,oneof=automatic manual"`
+}
+
+// CapturePaymentRequest captures Amount, or the whole authorized amount when
+// it is zero.
+type CapturePaymentRequest struct {
+	Amount int64 `json:"amount" binding:"omitempty,gt=0"`
 }
 
 type PaymentResponse struct {
-	ID        string        `json:"id"`
-	UserID    string        `json:"user_id"`
-	Amount    int64         `json:"amount"`
-	Currency  string        `json:"currency"`
-	Desc      string        `json:"desc,omitempty"`
-	Status    PaymentStatus `json:"status"`
-	CreatedAt time.Time     `json:"created_at"`
-	UpdatedAt time.Time     `json:"updated_at"`
+	ID                     string        `json:"id"`
+	UserID                 string        `json:"user_id"`
+	OrderID                string        `json:"order_id,omitempty"`
+	Amount                 int64         `json:"amount"`
+	Currency               string        `json:"currency"`
+	Desc                   string        `json:"desc,omitempty"`
+	Status                 PaymentStatus `json:"status"`
+	CaptureMethod          CaptureMethod `json:"capture_method"`
+	AmountCaptured         int64         `json:"amount_captured"`
+	AuthorizationExpiresAt *time.Time    `json:"authorization_expires_at,omitempty"`
+	// ClientSecret is only returned when the payment is created in
+	// PaymentStatusRequiresAction.
+	ClientSecret string `json:"client_secret,omitempty"`
+	// Refunds is only included when a single payment is fetched.
+	Refunds   []RefundResponse `json:"refunds,omitempty"`
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
 }
 
 func (p *Payment) ToPaymentResponse() PaymentResponse {
-	return PaymentResponse{
-		ID:        p.ID,
-		UserID:    p.UserID,
-		Amount:    p.Amount,
-		Currency:  p.Currency,
-		Desc:      p.Desc,
-		Status:    p.Status,
-		CreatedAt: p.CreatedAt,
-		UpdatedAt: p.UpdatedAt,
+	response := PaymentResponse{
+		ID:             p.ID,
+		UserID:         p.UserID,
+		OrderID:        p.OrderID,
+		Amount:         p.Amount,
+		Currency:       p.Currency,
+		Desc:           p.Desc,
+		Status:         p.Status,
+		CaptureMethod:  p.CaptureMethod,
+		AmountCaptured: p.AmountCaptured,
+		CreatedAt:      p.CreatedAt,
+		UpdatedAt:      p.UpdatedAt,
+	}
+	if p.Status == PaymentStatusAuthorized && !p.AuthorizationExpiresAt.IsZero() {
+		expiresAt := p.AuthorizationExpiresAt
+		response.AuthorizationExpiresAt = &expiresAt
 	}
+	return response
 }
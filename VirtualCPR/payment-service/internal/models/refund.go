@@ -0,0 +1,75 @@
+package models
+
+import "time"
+
+type RefundStatus string
+
+const (
+	// RefundStatusPending is a refund sent to, or still being processed by,
+	// the provider. Its amount is already reserved against the payment.
+	RefundStatusPending   RefundStatus = "pending"
+	RefundStatusSucceeded RefundStatus = "succeeded"
+	RefundStatusFailed    RefundStatus = "failed"
+	RefundStatusCanceled  RefundStatus = "canceled"
+)
+
+// CanTransition reports whether a refund in s may move to next. A pending
+// refund may settle either way and a succeeded one can still fail later, as
+// when the card has been closed; failed and canceled refunds are final.
+func (s RefundStatus) CanTransition(next RefundStatus) bool {
+	if s == next {
+		return true
+	}
+	switch s {
+	case RefundStatusPending:
+		return true
+	case RefundStatusSucceeded:
+		return next == RefundStatusFailed
+	}
+	return false
+}
+
+// Reserved reports whether the refund's amount counts against what is left
+// to refund.
+func (s RefundStatus) Reserved() bool {
+	return s == RefundStatusPending || s == RefundStatusSucceeded
+}
+
+type Refund struct {
+	ID             string       `json:"id"`
+	PaymentID      string       `json:"payment_id"`
+	Amount         int64        `json:"amount"`
+	Reason         string       `json:"reason,omitempty"`
+	Status         RefundStatus `json:"status"`
+	StripeRefundID string       `json:"stripe_refund_id,omitempty"`
+	CreatedAt      time.Time    `json:"created_at"`
+	UpdatedAt      time.Time    `json:"updated_at"`
+}
+
+type CreateRefundRequest struct {
+	// Amount defaults to everything not yet refunded.
+	Amount int64  `json:"amount" binding:"omitempty,gt=0"`
+	Reason string `json:"reason,omitempty" binding:"omitempty,oneof=duplicate fraudulent requested_by_customer"`
+}
+
+type RefundResponse struct {
+	ID        string       `json:"id"`
+	PaymentID string       `json:"payment_id"`
+	Amount    int64        `json:"amount"`
+	Reason    string       `json:"reason,omitempty"`
+	Status    RefundStatus `json:"status"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+}
+
+func (r *Refund) ToRefundResponse() RefundResponse {
+	return RefundResponse{
+		ID:        r.ID,
+		PaymentID: r.PaymentID,
+		Amount:    r.Amount,
+		Reason:    r.Reason,
+		Status:    r.Status,
+		CreatedAt: r.CreatedAt,
+		UpdatedAt: r.UpdatedAt,
+	}
+}
@@ -1,97 +1,202 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"github.com/robaa12/keploy-ContractTesting-MicroServices/payment-service/internal/models"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/apperrors"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/database"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/pagination"
 )
 
+// ErrOrderAlreadyPaid is returned when an order already has a payment that has
+// not failed or been voided.
+var ErrOrderAlreadyPaid = apperrors.Conflict("order already has a payment")
+
 type PaymentRepository interface {
-	CreatePayment(payment models.Payment) (models.Payment, error)
-	GetPaymentByID(id string) (models.Payment, error)
-	ListPaymentsByUserID(userID string) ([]models.Payment, error)
-	UpdatePayment(payment models.Payment) error
+	CreatePayment(ctx context.Context, payment models.Payment) (models.Payment, error)
+	GetPaymentByID(ctx context.Context, id string) (models.Payment, error)
+	GetPaymentByStripeChargeID(ctx context.Context, chargeID string) (models.Payment, error)
+	ListPaymentsByUserID(ctx context.Context, userID string, filter models.PaymentFilter, params pagination.Params) ([]models.Payment, error)
+	UpdatePayment(ctx context.Context, payment models.Payment) error
+	// ListExpiredAuthorizations returns up to limit authorized payments whose
+	// authorization expired before the given time, oldest first.
+	ListExpiredAuthorizations(ctx context.Context, before time.Time, limit int) ([]models.Payment, error)
+	// ListAbandonedActions returns up to limit manual capture payments still
+	// waiting for the customer to authenticate that were created before the
+	// given time, oldest first.
+	ListAbandonedActions(ctx context.Context, before time.Time, limit int) ([]models.Payment, error)
+	CreateRefund(ctx context.Context, refund models.Refund) (models.Refund, error)
+	GetRefundByID(ctx context.Context, id string) (models.Refund, error)
+	GetRefundByStripeRefundID(ctx context.Context, stripeRefundID string) (models.Refund, error)
+	ListRefundsByPaymentID(ctx context.Context, paymentID string) ([]models.Refund, error)
+	UpdateRefund(ctx context.Context, refund models.Refund) error
+	// LockPayment reads a payment and locks its row until the surrounding
+	// transaction ends. It must be called inside InTx.
+	LockPayment(ctx context.Context, id string) (models.Payment, error)
+	// RecordEvent stores a provider event ID and reports false if it was
+	// already stored.
+	RecordEvent(ctx context.Context, eventID, eventType string) (bool, error)
+	// InTx runs fn with a repository whose queries share one transaction.
+	InTx(ctx context.Context, fn func(repo PaymentRepository) error) error
 }
 
 type PostgresPaymentRepository struct {
 	db *sql.DB
+	// q runs the queries: db itself, or the transaction started by InTx
+	q database.Querier
 }
 
 func NewPaymentRepository(db *sql.DB) *PostgresPaymentRepository {
 	return &PostgresPaymentRepository{
 		db: db,
+		q:  db,
 	}
 }
 
-func (r *PostgresPaymentRepository) CreatePayment(payment models.Payment) (models.Payment, error) {
-	query := `INSERT INTO payments (id, user_id, amount, currency, description, status, stripe_charge_id, created_at, updated_at)
-              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-              RETURNING id, user_id, amount, currency, description, status, stripe_charge_id, created_at, updated_at`
+const paymentColumns = `id, user_id, COALESCE(order_id, ''), amount, currency, description, status, stripe_charge_id, capture_method, amount_captured,
+	authorization_expires_at, last_event_at, created_at, updated_at`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanPayment(row scanner) (models.Payment, error) {
+	var payment models.Payment
+	var authorizationExpiresAt, lastEventAt sql.NullTime
+	err := row.Scan(
+		&payment.ID,
+		&payment.UserID,
+		&payment.OrderID,
+		&payment.Amount,
+		&payment.Currency,
+		&payment.Desc,
+		&payment.Status,
+		&payment.StripeChargeID,
+		&payment.CaptureMethod,
+		&payment.AmountCaptured,
+		&authorizationExpiresAt,
+		&lastEventAt,
+		&payment.CreatedAt,
+		&payment.UpdatedAt,
+	)
+	payment.AuthorizationExpiresAt = authorizationExpiresAt.Time
+	payment.LastEventAt = lastEventAt.Time
+	return payment, err
+}
+
+func (r *PostgresPaymentRepository) CreatePayment(ctx context.Context, payment models.Payment) (models.Payment, error) {
+	query := `INSERT INTO payments (id, user_id, order_id, amount, currency, description, status, stripe_charge_id, capture_method, created_at, updated_at)
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+              RETURNING ` + paymentColumns
 	if payment.ID == "" {
 		payment.ID = uuid.New().String()
 	}
+	if payment.CaptureMethod == "" {
+		payment.CaptureMethod = models.CaptureAutomatic
+	}
 	now := time.Now()
 	payment.CreatedAt = now
 	payment.UpdatedAt = now
 
-	err := r.db.QueryRow(
+	created, err := scanPayment(r.q.QueryRowContext(ctx,
 		query,
 		payment.ID,
 		payment.UserID,
+		sql.NullString{String: payment.OrderID, Valid: payment.OrderID != ""},
 		payment.Amount,
 		payment.Currency,
 		payment.Desc,
 		payment.Status,
 		payment.StripeChargeID,
+		payment.CaptureMethod,
 		payment.CreatedAt,
 		payment.UpdatedAt,
-	).Scan(
-		&payment.ID,
-		&payment.UserID,
-		&payment.Amount,
-		&payment.Currency,
-		&payment.Desc,
-		&payment.Status,
-		&payment.StripeChargeID,
-		&payment.CreatedAt,
-		&payment.UpdatedAt,
-	)
+	))
 	if err != nil {
+		if isUniqueViolation(err) {
+			return models.Payment{}, ErrOrderAlreadyPaid
+		}
 		return models.Payment{}, err
 	}
-	return payment, nil
+	return created, nil
 }
 
-func (r *PostgresPaymentRepository) GetPaymentByID(id string) (models.Payment, error) {
-	query := `SELECT id, user_id, amount, currency, description, status, stripe_charge_id, created_at, updated_at
+func (r *PostgresPaymentRepository) GetPaymentByID(ctx context.Context, id string) (models.Payment, error) {
+	query := `SELECT ` + paymentColumns + `
 			  FROM payments
 			  WHERE id = $1`
-	var payment models.Payment
-	err := r.db.QueryRow(query, id).Scan(
-		&payment.ID,
-		&payment.UserID,
-		&payment.Amount,
-		&payment.Currency,
-		&payment.Desc,
-		&payment.Status,
-		&payment.StripeChargeID,
-		&payment.CreatedAt,
-		&payment.UpdatedAt,
-	)
+	return r.getPayment(ctx, query, id)
+}
+
+func (r *PostgresPaymentRepository) GetPaymentByStripeChargeID(ctx context.Context, chargeID string) (models.Payment, error) {
+	query := `SELECT ` + paymentColumns + `
+			  FROM payments
+			  WHERE stripe_charge_id = $1`
+	return r.getPayment(ctx, query, chargeID)
+}
+
+func (r *PostgresPaymentRepository) LockPayment(ctx context.Context, id string) (models.Payment, error) {
+	query := `SELECT ` + paymentColumns + `
+			  FROM payments
+			  WHERE id = $1
+			  FOR UPDATE`
+	return r.getPayment(ctx, query, id)
+}
+
+func (r *PostgresPaymentRepository) getPayment(ctx context.Context, query string, args ...any) (models.Payment, error) {
+	payment, err := scanPayment(r.q.QueryRowContext(ctx, query, args...))
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Payment{}, apperrors.NotFound("payment not found")
+		}
 		return models.Payment{}, err
 	}
 	return payment, nil
 }
 
-func (r *PostgresPaymentRepository) ListPaymentsByUserID(userID string) ([]models.Payment, error) {
-	query := `SELECT id, user_id, amount, currency, description, status, stripe_charge_id, created_at, updated_at
+// ListPaymentsByUserID returns one page of the user's payments, newest first.
+// It fetches one row more than params.Limit so the caller can tell whether
+// there is a next page.
+func (r *PostgresPaymentRepository) ListPaymentsByUserID(ctx context.Context, userID string, filter models.PaymentFilter, params pagination.Params) ([]models.Payment, error) {
+	var builder pagination.Query
+	builder.Where("user_id = ?", userID)
+	if filter.Currency != "" {
+		builder.Where("currency = ?", filter.Currency)
+	}
+	if filter.Status != "" {
+		builder.Where("status = ?", filter.Status)
+	}
+	query := builder.Build(`SELECT `+paymentColumns+`
+			  FROM payments`, params)
+	return r.listPayments(ctx, query, builder.Args...)
+}
+
+func (r *PostgresPaymentRepository) ListExpiredAuthorizations(ctx context.Context, before time.Time, limit int) ([]models.Payment, error) {
+	query := `SELECT ` + paymentColumns + `
 			  FROM payments
-			  WHERE user_id = $1 ORDER BY created_at DESC`
-	rows, err := r.db.Query(query, userID)
+			  WHERE status = $1 AND authorization_expires_at < $2
+			  ORDER BY authorization_expires_at
+			  LIMIT $3`
+	return r.listPayments(ctx, query, models.PaymentStatusAuthorized, before, limit)
+}
+
+func (r *PostgresPaymentRepository) ListAbandonedActions(ctx context.Context, before time.Time, limit int) ([]models.Payment, error) {
+	query := `SELECT ` + paymentColumns + `
+			  FROM payments
+			  WHERE status = $1 AND capture_method = $2 AND created_at < $3
+			  ORDER BY created_at
+			  LIMIT $4`
+	return r.listPayments(ctx, query, models.PaymentStatusRequiresAction, models.CaptureManual, before, limit)
+}
+
+func (r *PostgresPaymentRepository) listPayments(ctx context.Context, query string, args ...any) ([]models.Payment, error) {
+	rows, err := r.q.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -99,18 +204,7 @@ func (r *PostgresPaymentRepository) ListPaymentsByUserID(userID string) ([]model
 
 	var payments []models.Payment
 	for rows.Next() {
-		var payment models.Payment
-		err := rows.Scan(
-			&payment.ID,
-			&payment.UserID,
-			&payment.Amount,
-			&payment.Currency,
-			&payment.Desc,
-			&payment.Status,
-			&payment.StripeChargeID,
-			&payment.CreatedAt,
-			&payment.UpdatedAt,
-		)
+		payment, err := scanPayment(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -122,12 +216,20 @@ func (r *PostgresPaymentRepository) ListPaymentsByUserID(userID string) ([]model
 	return payments, nil
 }
 
-func (r *PostgresPaymentRepository) UpdatePayment(payment models.Payment) error {
-	query := `UPDATE payments SET status = $1, stripe_charge_id = $2, updated_at = $3 WHERE id = $4`
+func (r *PostgresPaymentRepository) UpdatePayment(ctx context.Context, payment models.Payment) error {
+	query := `UPDATE payments SET status = $1, stripe_charge_id = $2, amount_captured = $3, authorization_expires_at = $4,
+			  last_event_at = $5, updated_at = $6
+			  WHERE id = $7`
 
 	payment.UpdatedAt = time.Now()
-	result, err := r.db.Exec(query, payment.Status, payment.StripeChargeID, payment.UpdatedAt, payment.ID)
+	result, err := r.q.ExecContext(ctx, query, payment.Status, payment.StripeChargeID, payment.AmountCaptured,
+		nullTime(payment.AuthorizationExpiresAt), nullTime(payment.LastEventAt), payment.UpdatedAt, payment.ID)
 	if err != nil {
+		// A failed payment that succeeds late while its order has been paid
+		// again
+		if isUniqueViolation(err) {
+			return ErrOrderAlreadyPaid
+		}
 		return err
 	}
 	rowsAffected, err := result.RowsAffected()
@@ -135,7 +237,40 @@ func (r *PostgresPaymentRepository) UpdatePayment(payment models.Payment) error
 		return err
 	}
 	if rowsAffected == 0 {
-		return errors.New("payment not found")
+		return apperrors.NotFound("payment not found")
 	}
 	return nil
 }
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// nullTime stores a zero time as NULL.
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+func (r *PostgresPaymentRepository) RecordEvent(ctx context.Context, eventID, eventType string) (bool, error) {
+	query := `INSERT INTO processed_events (id, type, processed_at) VALUES ($1, $2, $3)
+			  ON CONFLICT (id) DO NOTHING`
+	result, err := r.q.ExecContext(ctx, query, eventID, eventType, time.Now())
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+func (r *PostgresPaymentRepository) InTx(ctx context.Context, fn func(repo PaymentRepository) error) error {
+	if _, ok := r.q.(*sql.Tx); ok {
+		return fn(r)
+	}
+	return database.InTx(ctx, r.db, func(tx *sql.Tx) error {
+		return fn(&PostgresPaymentRepository{db: r.db, q: tx})
+	})
+}
@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/payment-service/internal/models"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/apperrors"
+)
+
+const refundColumns = `id, payment_id, amount, COALESCE(reason, ''), status, COALESCE(stripe_refund_id, ''), created_at, updated_at`
+
+func scanRefund(row scanner) (models.Refund, error) {
+	var refund models.Refund
+	err := row.Scan(
+		&refund.ID,
+		&refund.PaymentID,
+		&refund.Amount,
+		&refund.Reason,
+		&refund.Status,
+		&refund.StripeRefundID,
+		&refund.CreatedAt,
+		&refund.UpdatedAt,
+	)
+	return refund, err
+}
+
+func (r *PostgresPaymentRepository) CreateRefund(ctx context.Context, refund models.Refund) (models.Refund, error) {
+	query := `INSERT INTO refunds (id, payment_id, amount, reason, status, stripe_refund_id, created_at, updated_at)
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+              RETURNING ` + refundColumns
+	if refund.ID == "" {
+		refund.ID = uuid.New().String()
+	}
+	now := time.Now()
+	refund.CreatedAt = now
+	refund.UpdatedAt = now
+
+	return scanRefund(r.q.QueryRowContext(ctx,
+		query,
+		refund.ID,
+		refund.PaymentID,
+		refund.Amount,
+		refund.Reason,
+		refund.Status,
+		refund.StripeRefundID,
+		refund.CreatedAt,
+		refund.UpdatedAt,
+	))
+}
+
+func (r *PostgresPaymentRepository) GetRefundByID(ctx context.Context, id string) (models.Refund, error) {
+	query := `SELECT ` + refundColumns + `
+			  FROM refunds
+			  WHERE id = $1`
+	return r.getRefund(ctx, query, id)
+}
+
+func (r *PostgresPaymentRepository) GetRefundByStripeRefundID(ctx context.Context, stripeRefundID string) (models.Refund, error) {
+	query := `SELECT ` + refundColumns + `
+			  FROM refunds
+			  WHERE stripe_refund_id = $1`
+	return r.getRefund(ctx, query, stripeRefundID)
+}
+
+func (r *PostgresPaymentRepository) getRefund(ctx context.Context, query string, args ...any) (models.Refund, error) {
+	refund, err := scanRefund(r.q.QueryRowContext(ctx, query, args...))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Refund{}, apperrors.NotFound("refund not found")
+		}
+		return models.Refund{}, err
+	}
+	return refund, nil
+}
+
+// ListRefundsByPaymentID returns the payment's refunds, oldest first.
+func (r *PostgresPaymentRepository) ListRefundsByPaymentID(ctx context.Context, paymentID string) ([]models.Refund, error) {
+	query := `SELECT ` + refundColumns + `
+			  FROM refunds
+			  WHERE payment_id = $1
+			  ORDER BY created_at, id`
+	rows, err := r.q.QueryContext(ctx, query, paymentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var refunds []models.Refund
+	for rows.Next() {
+		refund, err := scanRefund(rows)
+		if err != nil {
+			return nil, err
+		}
+		refunds = append(refunds, refund)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return refunds, nil
+}
+
+func (r *PostgresPaymentRepository) UpdateRefund(ctx context.Context, refund models.Refund) error {
+	query := `UPDATE refunds SET status = $1, stripe_refund_id = $2, updated_at = $3 WHERE id = $4`
+
+	refund.UpdatedAt = time.Now()
+	result, err := r.q.ExecContext(ctx, query, refund.Status, refund.StripeRefundID, refund.UpdatedAt, refund.ID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return apperrors.NotFound("refund not found")
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/apperrors"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/config"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/logging"
+)
+
+// sweepBatchSize bounds how many authorizations one sweep voids.
+const sweepBatchSize = 100
+
+type AuthorizationConfig struct {
+	// TTL is how long an authorized payment may wait for capture before the
+	// sweeper voids it. Card networks release holds after about 7 days, so it
+	// should stay below that.
+	TTL time.Duration
+	// SweepInterval is how often expired authorizations are looked for.
+	SweepInterval time.Duration
+	// ActionTTL is how long a manual capture payment may wait for the
+	// customer to authenticate before the sweeper voids it.
+	ActionTTL time.Duration
+}
+
+// AuthorizationConfigFromEnv reads PAYMENT_AUTHORIZATION_TTL,
+// PAYMENT_AUTHORIZATION_SWEEP_INTERVAL and PAYMENT_REQUIRES_ACTION_TTL.
+func AuthorizationConfigFromEnv(env *config.Env) AuthorizationConfig {
+	return AuthorizationConfig{
+		TTL:           env.Duration("PAYMENT_AUTHORIZATION_TTL", 6*24*time.Hour),
+		SweepInterval: env.Duration("PAYMENT_AUTHORIZATION_SWEEP_INTERVAL", time.Minute),
+		ActionTTL:     env.Duration("PAYMENT_REQUIRES_ACTION_TTL", time.Hour),
+	}
+}
+
+// AuthorizationSweeper voids authorized payments left uncaptured past their
+// expiry, so holds on customers' cards are released rather than left to lapse,
+// and manual capture payments whose customer never finished authenticating.
+type AuthorizationSweeper struct {
+	payments  *PaymentService
+	interval  time.Duration
+	actionTTL time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewAuthorizationSweeper(payments *PaymentService, config AuthorizationConfig) *AuthorizationSweeper {
+	ctx, cancel := context.WithCancel(context.Background())
+	sweeper := &AuthorizationSweeper{
+		payments:  payments,
+		interval:  config.SweepInterval,
+		actionTTL: config.ActionTTL,
+		ctx:       ctx,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+	go sweeper.run()
+	return sweeper
+}
+
+// Stop cancels the current sweep and waits for it to end or for ctx to
+// expire.
+func (s *AuthorizationSweeper) Stop(ctx context.Context) error {
+	s.cancel()
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *AuthorizationSweeper) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			s.sweep(s.ctx)
+		}
+	}
+}
+
+// sweep voids one batch of expired authorizations and one of abandoned
+// authentications. A payment that moved on since it was listed is skipped;
+// other failures are retried on the next sweep.
+func (s *AuthorizationSweeper) sweep(ctx context.Context) {
+	log := logging.For("authorization-sweeper")
+	now := time.Now()
+	expired, err := s.payments.repo.ListExpiredAuthorizations(ctx, now, sweepBatchSize)
+	if err != nil {
+		log.ErrorContext(ctx, "Failed to list expired authorizations", "error", err)
+	}
+	abandoned, err := s.payments.repo.ListAbandonedActions(ctx, now.Add(-s.actionTTL), sweepBatchSize)
+	if err != nil {
+		log.ErrorContext(ctx, "Failed to list abandoned authentications", "error", err)
+	}
+	for _, payment := range append(expired, abandoned...) {
+		if _, err := s.payments.VoidPayment(ctx, payment.ID); err != nil {
+			if errors.Is(err, apperrors.ErrConflict) {
+				log.InfoContext(ctx, "Skipping authorization that is no longer voidable", "payment_id", payment.ID, "error", err)
+				continue
+			}
+			log.WarnContext(ctx, "Failed to void expired authorization", "payment_id", payment.ID, "error", err)
+			continue
+		}
+		log.InfoContext(ctx, "Voided expired authorization", "payment_id", payment.ID, "status", payment.Status, "created_at", payment.CreatedAt)
+	}
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/payment-service/internal/gateway"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/payment-service/internal/models"
+)
+
+func TestSweepVoidsExpiredAuthorizationsAndAbandonedActions(t *testing.T) {
+	ctx := context.Background()
+	repo := newMemoryRepository()
+	statuses := NewStatusUpdates(repo)
+	defer statuses.Flush(ctx)
+	config := AuthorizationConfig{TTL: time.Hour, SweepInterval: time.Hour, ActionTTL: 30 * time.Minute}
+	payments := NewPaymentService(repo, statuses, gateway.NewFakeGateway(), config)
+	sweeper := NewAuthorizationSweeper(&payments, config)
+	defer sweeper.Stop(ctx)
+
+	create := func(cardToken string, capture models.CaptureMethod, age time.Duration) string {
+		t.Helper()
+		response, err := payments.CreatePayment(ctx, models.CreatePaymentRequest{
+			UserID: "user-1", Amount: 1000, Currency: "usd", CardToken: cardToken, CaptureMethod: capture,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		payment := repo.payments[response.ID]
+		payment.CreatedAt = payment.CreatedAt.Add(-age)
+		if !payment.AuthorizationExpiresAt.IsZero() {
+			payment.AuthorizationExpiresAt = payment.AuthorizationExpiresAt.Add(-age)
+		}
+		repo.payments[response.ID] = payment
+		return response.ID
+	}
+	expired := create("tok_visa", models.CaptureManual, 2*time.Hour)
+	current := create("tok_visa", models.CaptureManual, 0)
+	abandoned := create("tok_threeDSecure2Required", models.CaptureManual, time.Hour)
+	authenticating := create("tok_threeDSecure2Required", models.CaptureManual, time.Minute)
+	automatic := create("tok_threeDSecure2Required", models.CaptureAutomatic, time.Hour)
+
+	sweeper.sweep(ctx)
+
+	tests := []struct {
+		name string
+		id   string
+		want models.PaymentStatus
+	}{
+		{"expired authorization", expired, models.PaymentStatusVoided},
+		{"current authorization", current, models.PaymentStatusAuthorized},
+		{"abandoned authentication", abandoned, models.PaymentStatusVoided},
+		{"recent authentication", authenticating, models.PaymentStatusRequiresAction},
+		{"automatic capture authentication", automatic, models.PaymentStatusRequiresAction},
+	}
+	for _, tt := range tests {
+		if got := repo.payments[tt.id].Status; got != tt.want {
+			t.Errorf("%s: status = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/payment-service/internal/gateway"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/payment-service/internal/models"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/payment-service/internal/repository"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/apperrors"
+)
+
+// CapturePayment takes request.Amount, or the whole authorized amount, from
+// an authorized payment. Whatever is not captured is released to the card.
+func (s *PaymentService) CapturePayment(ctx context.Context, id string, request models.CapturePaymentRequest) (models.PaymentResponse, error) {
+	return s.settleAuthorization(ctx, id, settlement{
+		action:  "captured",
+		allowed: []models.PaymentStatus{models.PaymentStatusAuthorized},
+		marker:  models.PaymentStatusCapturing,
+		check: func(payment models.Payment) error {
+			if request.Amount > payment.Amount {
+				return apperrors.Validation(fmt.Sprintf("capture amount must be between 1 and %d", payment.Amount))
+			}
+			return nil
+		},
+		call: func(payment models.Payment) (gateway.Charge, error) {
+			return s.gateway.Capture(ctx, payment.ID, payment.StripeChargeID, request.Amount)
+		},
+	})
+}
+
+// VoidPayment cancels an authorized payment, releasing the whole hold on the
+// card, or one still waiting for the customer to authenticate.
+func (s *PaymentService) VoidPayment(ctx context.Context, id string) (models.PaymentResponse, error) {
+	return s.settleAuthorization(ctx, id, settlement{
+		action:  "voided",
+		allowed: []models.PaymentStatus{models.PaymentStatusAuthorized, models.PaymentStatusRequiresAction},
+		marker:  models.PaymentStatusVoiding,
+		call: func(payment models.Payment) (gateway.Charge, error) {
+			return s.gateway.Void(ctx, payment.ID, payment.StripeChargeID)
+		},
+	})
+}
+
+// settlement is a capture or a void of a payment.
+type settlement struct {
+	// action is the payment's state once settled, as used in errors.
+	action string
+	// allowed lists the statuses the payment may be settled from.
+	allowed []models.PaymentStatus
+	// marker is the payment's status while the provider call runs.
+	marker models.PaymentStatus
+	// check, if set, validates the request against the payment.
+	check func(payment models.Payment) error
+	call  func(payment models.Payment) (gateway.Charge, error)
+}
+
+// settleAuthorization moves a payment in one of the allowed statuses to the
+// settlement's marker, makes the provider call and stores the charge it
+// returns. The row is only locked while the marker is set: the marker keeps a
+// capture and a void of the same payment apart without holding a transaction
+// open across the call. A payment already carrying the marker was left by an
+// interrupted attempt and is settled again, which the call's idempotency key
+// makes safe; otherwise the provider's webhook brings it up to date.
+func (s *PaymentService) settleAuthorization(ctx context.Context, id string, settle settlement) (models.PaymentResponse, error) {
+	var payment models.Payment
+	err := s.repo.InTx(ctx, func(repo repository.PaymentRepository) error {
+		var err error
+		payment, err = repo.LockPayment(ctx, id)
+		if err != nil {
+			return err
+		}
+		if payment.Status != settle.marker && !slices.Contains(settle.allowed, payment.Status) {
+			return apperrors.Conflict(fmt.Sprintf("a %s payment cannot be %s", payment.Status, settle.action))
+		}
+		if settle.check != nil {
+			if err := settle.check(payment); err != nil {
+				return err
+			}
+		}
+		marked := payment
+		marked.Status = settle.marker
+		marked.UpdatedAt = time.Now()
+		return repo.UpdatePayment(ctx, marked)
+	})
+	if err != nil {
+		return models.PaymentResponse{}, err
+	}
+
+	charge, err := settle.call(payment)
+	if err != nil {
+		var appErr *apperrors.Error
+		switch {
+		case errors.As(err, &appErr):
+		case errors.Is(err, gateway.ErrInvalidRequest):
+			err = apperrors.Wrap(apperrors.ErrConflict, fmt.Sprintf("the payment provider refused to mark the payment %s", settle.action), err)
+		default:
+			// The call may still have gone through, so the payment keeps its
+			// marker until a retry or the webhook settles it
+			return models.PaymentResponse{}, apperrors.Upstream("payment provider request failed", err)
+		}
+		// The provider refused, so the payment can be settled another way
+		s.statuses.Write(ctx, payment)
+		return models.PaymentResponse{}, err
+	}
+
+	// The provider call happened, so report its outcome even if recording it
+	// has to be retried in the background
+	s.applyCharge(&payment, charge)
+	payment.UpdatedAt = time.Now()
+	s.statuses.Write(ctx, payment)
+	return payment.ToPaymentResponse(), nil
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/payment-service/internal/gateway"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/payment-service/internal/models"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/apperrors"
+)
+
+// settlingGateway calls during at the start of every capture and void, then
+// fails them with fail when it is set.
+type settlingGateway struct {
+	*gateway.FakeGateway
+	during func()
+	fail   error
+}
+
+func (g *settlingGateway) Capture(ctx context.Context, paymentID, chargeID string, amount int64) (gateway.Charge, error) {
+	if g.during != nil {
+		g.during()
+	}
+	if g.fail != nil {
+		return gateway.Charge{}, g.fail
+	}
+	return g.FakeGateway.Capture(ctx, paymentID, chargeID, amount)
+}
+
+func (g *settlingGateway) Void(ctx context.Context, paymentID, chargeID string) (gateway.Charge, error) {
+	if g.during != nil {
+		g.during()
+	}
+	if g.fail != nil {
+		return gateway.Charge{}, g.fail
+	}
+	return g.FakeGateway.Void(ctx, paymentID, chargeID)
+}
+
+func newSettlingService(t *testing.T) (*PaymentService, *memoryRepository, *settlingGateway, string) {
+	t.Helper()
+	repo := newMemoryRepository()
+	statuses := NewStatusUpdates(repo)
+	t.Cleanup(func() { statuses.Flush(context.Background()) })
+	provider := &settlingGateway{FakeGateway: gateway.NewFakeGateway()}
+	payments := NewPaymentService(repo, statuses, provider, AuthorizationConfig{TTL: time.Hour})
+
+	payment, err := payments.CreatePayment(context.Background(), models.CreatePaymentRequest{
+		UserID: "user-1", Amount: 2500, Currency: "usd", CardToken: "tok_visa", CaptureMethod: models.CaptureManual,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &payments, repo, provider, payment.ID
+}
+
+func TestSettlementMarksPaymentDuringProviderCall(t *testing.T) {
+	ctx := context.Background()
+	payments, repo, provider, id := newSettlingService(t)
+	provider.during = func() {
+		provider.during = nil
+		if got := repo.payments[id].Status; got != models.PaymentStatusCapturing {
+			t.Errorf("status during capture = %q, want %q", got, models.PaymentStatusCapturing)
+		}
+		if _, err := payments.VoidPayment(ctx, id); !errors.Is(err, apperrors.ErrConflict) {
+			t.Errorf("VoidPayment() during capture error = %v, want %v", err, apperrors.ErrConflict)
+		}
+	}
+
+	captured, err := payments.CapturePayment(ctx, id, models.CapturePaymentRequest{Amount: 2000})
+	if err != nil {
+		t.Fatalf("CapturePayment() error = %v", err)
+	}
+	if captured.Status != models.PaymentStatusCaptured || captured.AmountCaptured != 2000 {
+		t.Errorf("CapturePayment() = %s with %d captured, want captured with 2000", captured.Status, captured.AmountCaptured)
+	}
+	if got := repo.payments[id].Status; got != models.PaymentStatusCaptured {
+		t.Errorf("stored status = %q, want %q", got, models.PaymentStatusCaptured)
+	}
+}
+
+func TestSettlementFailures(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name    string
+		fail    error
+		wantErr error
+		// want is the payment's status after the failed capture
+		want models.PaymentStatus
+	}{
+		// The hold is intact, so the payment can still be captured or voided
+		{"refused", fmt.Errorf("%w: charge is canceled", gateway.ErrInvalidRequest), apperrors.ErrConflict, models.PaymentStatusAuthorized},
+		// The capture may have happened, so nothing else may start until it
+		// is retried or the webhook arrives
+		{"timed out", fmt.Errorf("%w: %w", gateway.ErrTimeout, context.DeadlineExceeded), apperrors.ErrUpstream, models.PaymentStatusCapturing},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payments, repo, provider, id := newSettlingService(t)
+			provider.fail = tt.fail
+			if _, err := payments.CapturePayment(ctx, id, models.CapturePaymentRequest{}); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CapturePayment() error = %v, want %v", err, tt.wantErr)
+			}
+			if got := repo.payments[id].Status; got != tt.want {
+				t.Fatalf("status = %q, want %q", got, tt.want)
+			}
+
+			// Retrying sends the same idempotency key and settles the payment
+			provider.fail = nil
+			captured, err := payments.CapturePayment(ctx, id, models.CapturePaymentRequest{})
+			if err != nil {
+				t.Fatalf("retried CapturePayment() error = %v", err)
+			}
+			if captured.Status != models.PaymentStatusCaptured {
+				t.Errorf("retried CapturePayment() status = %q, want %q", captured.Status, models.PaymentStatusCaptured)
+			}
+		})
+	}
+}
@@ -1,99 +1,200 @@
 package service
 
 import (
+	"cmp"
+	"context"
 	"errors"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/payment-service/internal/gateway"
 	"github.com/robaa12/keploy-ContractTesting-MicroServices/payment-service/internal/models"
 	"github.com/robaa12/keploy-ContractTesting-MicroServices/payment-service/internal/repository"
-	"github.com/stripe/stripe-go/v81"
-	"github.com/stripe/stripe-go/v81/paymentintent"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/apperrors"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/idempotency"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/pagination"
 )
 
 type PaymentService struct {
-	repo repository.PaymentRepository
+	repo          repository.PaymentRepository
+	statuses      *StatusUpdates
+	gateway       gateway.PaymentGateway
+	authorization AuthorizationConfig
 }
 
-func NewPaymentService(repo repository.PaymentRepository) PaymentService {
+func NewPaymentService(repo repository.PaymentRepository, statuses *StatusUpdates, gateway gateway.PaymentGateway, authorization AuthorizationConfig) PaymentService {
 	return PaymentService{
-		repo: repo,
+		repo:          repo,
+		statuses:      statuses,
+		gateway:       gateway,
+		authorization: authorization,
 	}
 }
 
-func (s *PaymentService) CreatePayment(request models.CreatePaymentRequest) (models.PaymentResponse, error) {
-	payment := models.Payment{
-		ID:        uuid.New().String(),
-		UserID:    request.UserID,
-		Amount:    request.Amount,
-		Currency:  request.Currency,
-		Desc:      request.Desc,
-		Status:    models.PaymentStatusPending,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
-	}
-
-	createdPayment, err := s.repo.CreatePayment(payment)
+func (s *PaymentService) CreatePayment(ctx context.Context, request models.CreatePaymentRequest) (models.PaymentResponse, error) {
+	key := idempotency.FromContext(ctx)
+	createdPayment, err := s.startPayment(ctx, request, key)
 	if err != nil {
 		return models.PaymentResponse{}, err
 	}
 
-	// Create a Stripe charge
-	params := &stripe.PaymentIntentParams{
-		Amount:      stripe.Int64(request.Amount),
-		Currency:    stripe.String(request.Currency),
-		Description: stripe.String(request.Desc),
-		PaymentMethodTypes: stripe.StringSlice([]string{
-			"card",
-		}),
-		Confirm: stripe.Bool(true),
-		Metadata: map[string]string{
-			"payment_id": createdPayment.ID,
-			"user_id":    request.UserID,
-		},
-	}
-	pi, err := paymentintent.New(params)
+	charge, err := s.gateway.Authorize(ctx, gateway.AuthorizeRequest{
+		PaymentID:      createdPayment.ID,
+		UserID:         createdPayment.UserID,
+		OrderID:        createdPayment.OrderID,
+		Amount:         createdPayment.Amount,
+		Currency:       createdPayment.Currency,
+		Description:    createdPayment.Desc,
+		CardToken:      request.CardToken,
+		Capture:        createdPayment.CaptureMethod != models.CaptureManual,
+		IdempotencyKey: key,
+	})
 	if err != nil {
 		createdPayment.Status = models.PaymentStatusFailed
-		_ = s.repo.UpdatePayment(createdPayment)
-		return models.PaymentResponse{}, err
+		createdPayment.UpdatedAt = time.Now()
+		s.statuses.Write(ctx, createdPayment)
+		if errors.Is(err, gateway.ErrDeclined) {
+			return models.PaymentResponse{}, apperrors.Wrap(apperrors.ErrPaymentRequired, "the card was declined", err)
+		}
+		return models.PaymentResponse{}, apperrors.Upstream("payment provider request failed", err)
 	}
 
-	createdPayment.Status = models.PaymentStatusSucceeded
-	createdPayment.StripeChargeID = pi.ID // Store PaymentIntent ID instead of Charge ID
-	err = s.repo.UpdatePayment(createdPayment)
-	if err != nil {
-		return models.PaymentResponse{}, err
+	// The provider call happened, so report its outcome even if recording it
+	// has to be retried in the background
+	s.applyCharge(&createdPayment, charge)
+	createdPayment.UpdatedAt = time.Now()
+	s.statuses.Write(ctx, createdPayment)
+	if createdPayment.Status == models.PaymentStatusFailed {
+		return models.PaymentResponse{}, apperrors.New(apperrors.ErrPaymentRequired, "the card was declined")
 	}
 
-	updatedPayment, err := s.repo.GetPaymentByID(createdPayment.ID)
-	if err != nil {
-		return models.PaymentResponse{}, err
+	response := createdPayment.ToPaymentResponse()
+	if createdPayment.Status == models.PaymentStatusRequiresAction {
+		response.ClientSecret = charge.ClientSecret
+	}
+	return response, nil
+}
+
+// startPayment records a new pending payment. With an idempotency key the
+// payment's ID is derived from the key, so a retry after a failed attempt
+// picks up the same payment and sends the provider an identical request
+// rather than charging again. A retry that asks for a different payment is
+// rejected with 422.
+func (s *PaymentService) startPayment(ctx context.Context, request models.CreatePaymentRequest, key string) (models.Payment, error) {
+	payment := models.Payment{
+		ID:            uuid.New().String(),
+		UserID:        request.UserID,
+		OrderID:       request.OrderID,
+		Amount:        request.Amount,
+		Currency:      request.Currency,
+		Desc:          request.Desc,
+		Status:        models.PaymentStatusPending,
+		CaptureMethod: cmp.Or(request.CaptureMethod, models.CaptureAutomatic),
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
+	if key != "" {
+		payment.ID = uuid.NewSHA1(uuid.NameSpaceOID, []byte(key)).String()
+		existing, err := s.repo.GetPaymentByID(ctx, payment.ID)
+		if err == nil {
+			if !samePayment(existing, payment) {
+				return models.Payment{}, apperrors.New(apperrors.ErrUnprocessable, idempotency.Header+" was already used with a different request")
+			}
+			return existing, nil
+		}
+		if !errors.Is(err, apperrors.ErrNotFound) {
+			return models.Payment{}, err
+		}
+	}
+	return s.repo.CreatePayment(ctx, payment)
+}
+
+// samePayment reports whether a retried request asks for the payment stored by
+// the first attempt.
+func samePayment(stored, retried models.Payment) bool {
+	return stored.UserID == retried.UserID &&
+		stored.OrderID == retried.OrderID &&
+		stored.Amount == retried.Amount &&
+		stored.Currency == retried.Currency &&
+		stored.Desc == retried.Desc &&
+		stored.CaptureMethod == retried.CaptureMethod
+}
+
+// applyCharge copies a charge's outcome onto payment. An authorization's
+// expiry is set the first time it is seen.
+func (s *PaymentService) applyCharge(payment *models.Payment, charge gateway.Charge) {
+	payment.Status = paymentStatus(charge.Status, payment.CaptureMethod)
+	if charge.ID != "" {
+		payment.StripeChargeID = charge.ID
+	}
+	payment.AmountCaptured = charge.AmountCaptured
+	if payment.Status == models.PaymentStatusAuthorized && payment.AuthorizationExpiresAt.IsZero() {
+		payment.AuthorizationExpiresAt = time.Now().Add(s.authorization.TTL)
+	}
+}
+
+// paymentStatus maps a charge's provider status to the status of a payment
+// captured with method.
+func paymentStatus(status gateway.ChargeStatus, method models.CaptureMethod) models.PaymentStatus {
+	manual := method == models.CaptureManual
+	switch status {
+	case gateway.ChargeSucceeded:
+		if manual {
+			return models.PaymentStatusCaptured
+		}
+		return models.PaymentStatusSucceeded
+	case gateway.ChargeProcessing:
+		return models.PaymentStatusProcessing
+	case gateway.ChargeRequiresAction:
+		return models.PaymentStatusRequiresAction
+	case gateway.ChargeRequiresCapture:
+		return models.PaymentStatusAuthorized
+	case gateway.ChargeCanceled:
+		if manual {
+			return models.PaymentStatusVoided
+		}
+		return models.PaymentStatusFailed
+	case gateway.ChargeRequiresPaymentMethod:
+		return models.PaymentStatusFailed
+	default:
+		return models.PaymentStatusPending
 	}
-	return updatedPayment.ToPaymentResponse(), nil
 }
 
-func (s *PaymentService) GetPaymentByID(id string) (models.PaymentResponse, error) {
-	payment, err := s.repo.GetPaymentByID(id)
+func (s *PaymentService) GetPaymentByID(ctx context.Context, id string) (models.PaymentResponse, error) {
+	payment, err := s.repo.GetPaymentByID(ctx, id)
+	if err != nil {
+		return models.PaymentResponse{}, err
+	}
+	refunds, err := s.repo.ListRefundsByPaymentID(ctx, id)
 	if err != nil {
 		return models.PaymentResponse{}, err
 	}
-	return payment.ToPaymentResponse(), nil
+
+	response := payment.ToPaymentResponse()
+	for _, refund := range refunds {
+		response.Refunds = append(response.Refunds, refund.ToRefundResponse())
+	}
+	return response, nil
 }
 
-func (s *PaymentService) ListPaymentsByUserID(userID string) ([]models.PaymentResponse, error) {
+func (s *PaymentService) ListPaymentsByUserID(ctx context.Context, userID string, filter models.PaymentFilter, params pagination.Params) ([]models.PaymentResponse, *pagination.Cursor, error) {
 	if userID == "" {
-		return nil, errors.New("user ID is required")
+		return nil, nil, apperrors.Validation("user ID is required")
 	}
 
-	payments, err := s.repo.ListPaymentsByUserID(userID)
+	payments, err := s.repo.ListPaymentsByUserID(ctx, userID, filter, params)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
+	payments, next := pagination.Trim(payments, params, func(payment models.Payment) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: payment.CreatedAt, ID: payment.ID}
+	})
+
 	var paymentResponses []models.PaymentResponse
 	for _, payment := range payments {
 		paymentResponses = append(paymentResponses, payment.ToPaymentResponse())
 	}
-	return paymentResponses, nil
+	return paymentResponses, next, nil
 }
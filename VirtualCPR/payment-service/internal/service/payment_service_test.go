@@ -0,0 +1,279 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/payment-service/internal/gateway"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/payment-service/internal/models"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/apperrors"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/idempotency"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/metrics"
+)
+
+// stripeStandIn answers the Stripe API calls the gateway makes with recorded
+// response shapes. Every PaymentIntent it confirms ends in status.
+type stripeStandIn struct {
+	mu       sync.Mutex
+	status   string
+	requests []stripeRequest
+}
+
+func (s *stripeStandIn) setStatus(status string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+}
+
+type stripeRequest struct {
+	path           string
+	form           url.Values
+	idempotencyKey string
+}
+
+func (s *stripeStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	s.mu.Lock()
+	s.requests = append(s.requests, stripeRequest{path: r.URL.Path, form: r.PostForm, idempotencyKey: r.Header.Get("Idempotency-Key")})
+	status := s.status
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case "/v1/payment_methods":
+		json.NewEncoder(w).Encode(map[string]any{
+			"id":     "pm_standin",
+			"object": "payment_method",
+			"type":   "card",
+		})
+	case "/v1/payment_intents":
+		amount, _ := strconv.ParseInt(r.PostForm.Get("amount"), 10, 64)
+		received := int64(0)
+		if status == "succeeded" {
+			received = amount
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"id":              "pi_standin",
+			"object":          "payment_intent",
+			"amount":          amount,
+			"amount_received": received,
+			"currency":        r.PostForm.Get("currency"),
+			"status":          status,
+			"capture_method":  r.PostForm.Get("capture_method"),
+			"payment_method":  r.PostForm.Get("payment_method"),
+			"client_secret":   "pi_standin_secret_x",
+		})
+	case "/v1/payment_intents/pi_standin/capture":
+		amount, _ := strconv.ParseInt(r.PostForm.Get("amount_to_capture"), 10, 64)
+		json.NewEncoder(w).Encode(map[string]any{
+			"id":              "pi_standin",
+			"object":          "payment_intent",
+			"amount_received": amount,
+			"status":          "succeeded",
+		})
+	case "/v1/payment_intents/pi_standin/cancel":
+		json.NewEncoder(w).Encode(map[string]any{
+			"id":     "pi_standin",
+			"object": "payment_intent",
+			"status": "canceled",
+		})
+	case "/v1/refunds":
+		amount, _ := strconv.ParseInt(r.PostForm.Get("amount"), 10, 64)
+		json.NewEncoder(w).Encode(map[string]any{
+			"id":             "re_standin",
+			"object":         "refund",
+			"amount":         amount,
+			"status":         "succeeded",
+			"payment_intent": r.PostForm.Get("payment_intent"),
+		})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]any{
+			"error": map[string]any{"type": "invalid_request_error", "message": "unrecognized request URL " + r.URL.Path},
+		})
+	}
+}
+
+// calls returns the requests made to path, in order.
+func (s *stripeStandIn) calls(path string) []stripeRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var calls []stripeRequest
+	for _, request := range s.requests {
+		if request.path == path {
+			calls = append(calls, request)
+		}
+	}
+	return calls
+}
+
+func newStripeService(t *testing.T, standIn http.Handler) (*PaymentService, *memoryRepository) {
+	t.Helper()
+	stripe := httptest.NewServer(standIn)
+	t.Cleanup(stripe.Close)
+
+	repo := newMemoryRepository()
+	statuses := NewStatusUpdates(repo)
+	t.Cleanup(func() { statuses.Flush(context.Background()) })
+	payments := NewPaymentService(repo, statuses, gateway.NewStripeGateway("sk_test_standin", stripe.URL, stripe.Client(), metrics.New("payment-service")), AuthorizationConfig{TTL: time.Hour})
+	return &payments, repo
+}
+
+func TestCreatePaymentMapsStripeOutcomes(t *testing.T) {
+	tests := []struct {
+		intentStatus string
+		capture      models.CaptureMethod
+		want         models.PaymentStatus
+		wantErr      error
+	}{
+		{"succeeded", models.CaptureAutomatic, models.PaymentStatusSucceeded, nil},
+		{"succeeded", models.CaptureManual, models.PaymentStatusCaptured, nil},
+		{"requires_capture", models.CaptureManual, models.PaymentStatusAuthorized, nil},
+		{"requires_action", models.CaptureAutomatic, models.PaymentStatusRequiresAction, nil},
+		{"processing", models.CaptureAutomatic, models.PaymentStatusProcessing, nil},
+		// Stripe leaves a declined card's PaymentIntent asking for another one
+		{"requires_payment_method", models.CaptureAutomatic, models.PaymentStatusFailed, apperrors.ErrPaymentRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.intentStatus+"/"+string(tt.capture), func(t *testing.T) {
+			standIn := &stripeStandIn{status: tt.intentStatus}
+			payments, repo := newStripeService(t, standIn)
+
+			response, err := payments.CreatePayment(context.Background(), models.CreatePaymentRequest{
+				UserID:        "user-1",
+				Amount:        2500,
+				Currency:      "usd",
+				CardToken:     "tok_visa",
+				CaptureMethod: tt.capture,
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CreatePayment() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && response.Status != tt.want {
+				t.Errorf("response status = %q, want %q", response.Status, tt.want)
+			}
+			if err == nil && tt.want == models.PaymentStatusRequiresAction && response.ClientSecret == "" {
+				t.Error("requires_action response has no client secret")
+			}
+			if len(repo.payments) != 1 {
+				t.Fatalf("stored %d payments, want 1", len(repo.payments))
+			}
+			for _, stored := range repo.payments {
+				if stored.Status != tt.want {
+					t.Errorf("stored status = %q, want %q", stored.Status, tt.want)
+				}
+				if stored.StripeChargeID != "pi_standin" {
+					t.Errorf("stored charge ID = %q, want pi_standin", stored.StripeChargeID)
+				}
+			}
+
+			methods := standIn.calls("/v1/payment_methods")
+			if len(methods) != 1 || methods[0].form.Get("card[token]") != "tok_visa" {
+				t.Fatalf("payment method requests = %+v, want one for tok_visa", methods)
+			}
+			intents := standIn.calls("/v1/payment_intents")
+			if len(intents) != 1 {
+				t.Fatalf("made %d PaymentIntent requests, want 1", len(intents))
+			}
+			if got := intents[0].form.Get("payment_method"); got != "pm_standin" {
+				t.Errorf("PaymentIntent payment_method = %q, want the created pm_standin", got)
+			}
+			if got := intents[0].form.Get("confirm"); got != "true" {
+				t.Errorf("PaymentIntent confirm = %q, want true", got)
+			}
+		})
+	}
+}
+
+func TestSettlementRequestsCarryIdempotencyKeys(t *testing.T) {
+	ctx := context.Background()
+	request := models.CreatePaymentRequest{UserID: "user-1", Amount: 2500, Currency: "usd", CardToken: "tok_visa", CaptureMethod: models.CaptureManual}
+
+	t.Run("capture and refund", func(t *testing.T) {
+		standIn := &stripeStandIn{status: "requires_capture"}
+		payments, _ := newStripeService(t, standIn)
+		payment, err := payments.CreatePayment(ctx, request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := payments.CapturePayment(ctx, payment.ID, models.CapturePaymentRequest{Amount: 2000}); err != nil {
+			t.Fatalf("CapturePayment() error = %v", err)
+		}
+		refund, err := payments.CreateRefund(ctx, payment.ID, models.CreateRefundRequest{Amount: 500})
+		if err != nil {
+			t.Fatalf("CreateRefund() error = %v", err)
+		}
+
+		captures := standIn.calls("/v1/payment_intents/pi_standin/capture")
+		if len(captures) != 1 || captures[0].idempotencyKey != payment.ID+"-capture" {
+			t.Errorf("capture requests = %+v, want one keyed %s-capture", captures, payment.ID)
+		}
+		refunds := standIn.calls("/v1/refunds")
+		if len(refunds) != 1 || refunds[0].idempotencyKey != refund.ID {
+			t.Errorf("refund requests = %+v, want one keyed by refund ID %s", refunds, refund.ID)
+		}
+	})
+
+	t.Run("void", func(t *testing.T) {
+		standIn := &stripeStandIn{status: "requires_capture"}
+		payments, _ := newStripeService(t, standIn)
+		payment, err := payments.CreatePayment(ctx, request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		voided, err := payments.VoidPayment(ctx, payment.ID)
+		if err != nil {
+			t.Fatalf("VoidPayment() error = %v", err)
+		}
+		if voided.Status != models.PaymentStatusVoided {
+			t.Errorf("status = %q, want %q", voided.Status, models.PaymentStatusVoided)
+		}
+
+		cancels := standIn.calls("/v1/payment_intents/pi_standin/cancel")
+		if len(cancels) != 1 || cancels[0].idempotencyKey != payment.ID+"-void" {
+			t.Errorf("cancel requests = %+v, want one keyed %s-void", cancels, payment.ID)
+		}
+	})
+}
+
+func TestCreatePaymentRetryReusesStoredPayment(t *testing.T) {
+	standIn := &stripeStandIn{status: "requires_payment_method"}
+	payments, repo := newStripeService(t, standIn)
+	ctx := idempotency.WithKey(context.Background(), "retry-key")
+	request := models.CreatePaymentRequest{UserID: "user-1", Amount: 2500, Currency: "usd", CardToken: "tok_visa"}
+
+	if _, err := payments.CreatePayment(ctx, request); !errors.Is(err, apperrors.ErrPaymentRequired) {
+		t.Fatalf("first attempt error = %v, want a decline", err)
+	}
+
+	changed := request
+	changed.Amount = 9900
+	if _, err := payments.CreatePayment(ctx, changed); !errors.Is(err, apperrors.ErrUnprocessable) {
+		t.Fatalf("retry with a different amount: error = %v, want 422", err)
+	}
+
+	standIn.setStatus("succeeded")
+	response, err := payments.CreatePayment(ctx, request)
+	if err != nil {
+		t.Fatalf("retry error = %v", err)
+	}
+	if response.Status != models.PaymentStatusSucceeded || response.Amount != 2500 {
+		t.Errorf("retry = %s for %d, want succeeded for 2500", response.Status, response.Amount)
+	}
+	if len(repo.payments) != 1 {
+		t.Errorf("stored %d payments, want the first attempt's only", len(repo.payments))
+	}
+	for _, intent := range standIn.calls("/v1/payment_intents") {
+		if got := intent.form.Get("amount"); got != "2500" {
+			t.Errorf("PaymentIntent amount = %s, want the stored 2500", got)
+		}
+	}
+}
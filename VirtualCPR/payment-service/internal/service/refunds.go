@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/payment-service/internal/gateway"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/payment-service/internal/models"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/payment-service/internal/repository"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/apperrors"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/logging"
+)
+
+// CreateRefund returns request.Amount, or everything not yet refunded, of a
+// succeeded or captured payment. The refund is recorded as pending before the provider is
+// called, with the payment row locked, so concurrent refunds can never add up
+// to more than was captured.
+func (s *PaymentService) CreateRefund(ctx context.Context, paymentID string, request models.CreateRefundRequest) (models.RefundResponse, error) {
+	var payment models.Payment
+	var refund models.Refund
+	err := s.repo.InTx(ctx, func(repo repository.PaymentRepository) error {
+		var err error
+		payment, err = repo.LockPayment(ctx, paymentID)
+		if err != nil {
+			return err
+		}
+		if !payment.Status.Refundable() {
+			return apperrors.Conflict(fmt.Sprintf("a %s payment cannot be refunded", payment.Status))
+		}
+		refunds, err := repo.ListRefundsByPaymentID(ctx, paymentID)
+		if err != nil {
+			return err
+		}
+
+		remaining := payment.AmountCaptured - reservedAmount(refunds)
+		amount := request.Amount
+		if amount == 0 {
+			amount = remaining
+		}
+		if amount <= 0 || amount > remaining {
+			return apperrors.Validation(fmt.Sprintf("refund amount must be between 1 and %d", remaining))
+		}
+
+		refund, err = repo.CreateRefund(ctx, models.Refund{
+			ID:        uuid.New().String(),
+			PaymentID: paymentID,
+			Amount:    amount,
+			Reason:    request.Reason,
+			Status:    models.RefundStatusPending,
+		})
+		return err
+	})
+	if err != nil {
+		return models.RefundResponse{}, err
+	}
+
+	result, err := s.gateway.Refund(ctx, gateway.RefundRequest{
+		RefundID: refund.ID,
+		ChargeID: payment.StripeChargeID,
+		Amount:   refund.Amount,
+		Reason:   refund.Reason,
+	})
+	if err != nil {
+		// After a timeout or cancellation the refund may still have been made,
+		// so it stays pending until a webhook reports its outcome
+		if !errors.Is(err, gateway.ErrTimeout) && ctx.Err() == nil {
+			refund.Status = models.RefundStatusFailed
+			if updateErr := s.updateRefund(context.WithoutCancel(ctx), refund); updateErr != nil {
+				logging.For("refunds").ErrorContext(ctx, "Failed to record failed refund", "refund_id", refund.ID, "error", updateErr)
+			}
+		}
+		return models.RefundResponse{}, apperrors.Upstream("payment provider refund failed", err)
+	}
+
+	refund.Status = refundStatus(result.Status)
+	refund.StripeRefundID = result.ID
+	// The money has moved, so record it even if the client has gone away
+	if err := s.updateRefund(context.WithoutCancel(ctx), refund); err != nil {
+		return models.RefundResponse{}, err
+	}
+	refund.UpdatedAt = time.Now()
+	return refund.ToRefundResponse(), nil
+}
+
+// updateRefund stores refund's status and provider ID in its own transaction.
+func (s *PaymentService) updateRefund(ctx context.Context, refund models.Refund) error {
+	return s.repo.InTx(ctx, func(repo repository.PaymentRepository) error {
+		return applyRefund(ctx, repo, refund)
+	})
+}
+
+// applyRefund stores refund's status and provider ID, unless the refund has
+// already moved past it, and brings its payment's status in line with the
+// refunds that have succeeded. It must be called inside InTx.
+func applyRefund(ctx context.Context, repo repository.PaymentRepository, refund models.Refund) error {
+	payment, err := repo.LockPayment(ctx, refund.PaymentID)
+	if err != nil {
+		return err
+	}
+	current, err := repo.GetRefundByID(ctx, refund.ID)
+	if err != nil {
+		return err
+	}
+	if !current.Status.CanTransition(refund.Status) {
+		logging.For("refunds").InfoContext(ctx, "Keeping newer refund status", "refund_id", refund.ID, "status", current.Status, "dropped_status", refund.Status)
+		return nil
+	}
+	current.Status = refund.Status
+	if refund.StripeRefundID != "" {
+		current.StripeRefundID = refund.StripeRefundID
+	}
+	if err := repo.UpdateRefund(ctx, current); err != nil {
+		return err
+	}
+	return syncRefundedStatus(ctx, repo, payment)
+}
+
+// syncRefundedStatus sets a refundable payment's status from the total of its
+// succeeded refunds. Disputed payments are left alone.
+func syncRefundedStatus(ctx context.Context, repo repository.PaymentRepository, payment models.Payment) error {
+	switch payment.Status {
+	case models.PaymentStatusSucceeded, models.PaymentStatusCaptured, models.PaymentStatusPartiallyRefunded, models.PaymentStatusRefunded:
+	default:
+		return nil
+	}
+
+	refunds, err := repo.ListRefundsByPaymentID(ctx, payment.ID)
+	if err != nil {
+		return err
+	}
+	var refunded int64
+	for _, refund := range refunds {
+		if refund.Status == models.RefundStatusSucceeded {
+			refunded += refund.Amount
+		}
+	}
+	status := payment.SettledStatus(refunded)
+	if status == payment.Status {
+		return nil
+	}
+	payment.Status = status
+	return repo.UpdatePayment(ctx, payment)
+}
+
+// reservedAmount is the total of refunds that have succeeded or may still.
+func reservedAmount(refunds []models.Refund) int64 {
+	var total int64
+	for _, refund := range refunds {
+		if refund.Status.Reserved() {
+			total += refund.Amount
+		}
+	}
+	return total
+}
+
+func refundStatus(status gateway.RefundStatus) models.RefundStatus {
+	switch status {
+	case gateway.RefundSucceeded:
+		return models.RefundStatusSucceeded
+	case gateway.RefundFailed:
+		return models.RefundStatusFailed
+	case gateway.RefundCanceled:
+		return models.RefundStatusCanceled
+	default:
+		return models.RefundStatusPending
+	}
+}
@@ -0,0 +1,208 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/payment-service/internal/gateway"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/payment-service/internal/models"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/apperrors"
+)
+
+// refundingGateway answers refunds with status, as Stripe does for refunds it
+// settles later, or fails them with fail when it is set.
+type refundingGateway struct {
+	*gateway.FakeGateway
+	status gateway.RefundStatus
+	fail   error
+}
+
+func (g *refundingGateway) Refund(ctx context.Context, request gateway.RefundRequest) (gateway.Refund, error) {
+	if g.fail != nil {
+		return gateway.Refund{}, g.fail
+	}
+	refund, err := g.FakeGateway.Refund(ctx, request)
+	if err == nil && g.status != "" {
+		refund.Status = g.status
+	}
+	return refund, err
+}
+
+func newRefundService(t *testing.T, cardToken string, capture models.CaptureMethod) (*PaymentService, *memoryRepository, *refundingGateway, string) {
+	t.Helper()
+	repo := newMemoryRepository()
+	statuses := NewStatusUpdates(repo)
+	t.Cleanup(func() { statuses.Flush(context.Background()) })
+	provider := &refundingGateway{FakeGateway: gateway.NewFakeGateway()}
+	payments := NewPaymentService(repo, statuses, provider, AuthorizationConfig{TTL: time.Hour})
+
+	payment, err := payments.CreatePayment(context.Background(), models.CreatePaymentRequest{
+		UserID: "user-1", Amount: 2500, Currency: "usd", CardToken: cardToken, CaptureMethod: capture,
+	})
+	if err != nil && !errors.Is(err, apperrors.ErrPaymentRequired) {
+		t.Fatal(err)
+	}
+	// A declined payment is still recorded, as failed
+	if payment.ID == "" {
+		for id := range repo.payments {
+			payment.ID = id
+		}
+	}
+	return &payments, repo, provider, payment.ID
+}
+
+func TestCreateRefund(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name      string
+		cardToken string
+		capture   models.CaptureMethod
+		// amounts are refunded in turn; the last one is checked against
+		// wantErr and the others must succeed
+		amounts []int64
+		wantErr error
+		want    models.PaymentStatus
+	}{
+		{"full", "tok_visa", models.CaptureAutomatic, []int64{0}, nil, models.PaymentStatusRefunded},
+		{"partial", "tok_visa", models.CaptureAutomatic, []int64{1000}, nil, models.PaymentStatusPartiallyRefunded},
+		{"partials adding up to the amount", "tok_visa", models.CaptureAutomatic, []int64{1000, 1500}, nil, models.PaymentStatusRefunded},
+		{"rest after a partial", "tok_visa", models.CaptureAutomatic, []int64{1000, 0}, nil, models.PaymentStatusRefunded},
+		{"more than was captured", "tok_visa", models.CaptureAutomatic, []int64{2501}, apperrors.ErrValidation, models.PaymentStatusSucceeded},
+		{"more than is left", "tok_visa", models.CaptureAutomatic, []int64{2000, 501}, apperrors.ErrValidation, models.PaymentStatusPartiallyRefunded},
+		{"already refunded", "tok_visa", models.CaptureAutomatic, []int64{0, 0}, apperrors.ErrConflict, models.PaymentStatusRefunded},
+		{"authorized only", "tok_visa", models.CaptureManual, []int64{0}, apperrors.ErrConflict, models.PaymentStatusAuthorized},
+		{"declined", "tok_chargeDeclined", models.CaptureAutomatic, []int64{0}, apperrors.ErrConflict, models.PaymentStatusFailed},
+		{"waiting for 3-D Secure", "tok_threeDSecure2Required", models.CaptureAutomatic, []int64{0}, apperrors.ErrConflict, models.PaymentStatusRequiresAction},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payments, repo, _, id := newRefundService(t, tt.cardToken, tt.capture)
+			var refunded int64
+			for i, amount := range tt.amounts {
+				refund, err := payments.CreateRefund(ctx, id, models.CreateRefundRequest{Amount: amount, Reason: "requested_by_customer"})
+				if i < len(tt.amounts)-1 || tt.wantErr == nil {
+					if err != nil {
+						t.Fatalf("CreateRefund(%d) error = %v", amount, err)
+					}
+					if refund.Status != models.RefundStatusSucceeded || amount != 0 && refund.Amount != amount {
+						t.Errorf("CreateRefund(%d) = %s refund of %d, want a succeeded one", amount, refund.Status, refund.Amount)
+					}
+					refunded += refund.Amount
+					continue
+				}
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("CreateRefund(%d) error = %v, want %v", amount, err, tt.wantErr)
+				}
+			}
+
+			payment := repo.payments[id]
+			if payment.Status != tt.want {
+				t.Errorf("payment status = %q, want %q", payment.Status, tt.want)
+			}
+			var stored int64
+			for _, refund := range repo.refunds {
+				stored += refund.Amount
+			}
+			// A rejected refund is never recorded
+			if stored != refunded {
+				t.Errorf("recorded refunds total %d, want %d", stored, refunded)
+			}
+		})
+	}
+}
+
+func TestRefundLifecycle(t *testing.T) {
+	ctx := context.Background()
+	payments, repo, provider, id := newRefundService(t, "tok_visa", models.CaptureAutomatic)
+	provider.status = gateway.RefundPending
+
+	refund, err := payments.CreateRefund(ctx, id, models.CreateRefundRequest{Amount: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refund.Status != models.RefundStatusPending {
+		t.Fatalf("refund status = %q, want %q", refund.Status, models.RefundStatusPending)
+	}
+	stripeRefundID := repo.refunds[refund.ID].StripeRefundID
+	check := func(step string, wantRefund models.RefundStatus, wantPayment models.PaymentStatus) {
+		t.Helper()
+		if got := repo.refunds[refund.ID].Status; got != wantRefund {
+			t.Errorf("%s: refund status = %q, want %q", step, got, wantRefund)
+		}
+		if got := repo.payments[id].Status; got != wantPayment {
+			t.Errorf("%s: payment status = %q, want %q", step, got, wantPayment)
+		}
+	}
+	check("created", models.RefundStatusPending, models.PaymentStatusSucceeded)
+
+	// The pending refund already holds its share of the payment
+	if _, err := payments.CreateRefund(ctx, id, models.CreateRefundRequest{Amount: 2000}); !errors.Is(err, apperrors.ErrValidation) {
+		t.Errorf("CreateRefund() past a pending refund error = %v, want %v", err, apperrors.ErrValidation)
+	}
+
+	event := func(eventID string, status gateway.RefundStatus) gateway.Event {
+		return gateway.Event{
+			ID:       eventID,
+			Type:     "refund.updated",
+			Kind:     gateway.EventRefund,
+			Created:  time.Now(),
+			RefundID: refund.ID,
+			Refund:   gateway.Refund{ID: stripeRefundID, Status: status, Amount: 1000},
+		}
+	}
+	for _, step := range []struct {
+		event       gateway.Event
+		wantRefund  models.RefundStatus
+		wantPayment models.PaymentStatus
+	}{
+		{event("evt_1", gateway.RefundSucceeded), models.RefundStatusSucceeded, models.PaymentStatusPartiallyRefunded},
+		// A late pending cannot undo the success
+		{event("evt_2", gateway.RefundPending), models.RefundStatusSucceeded, models.PaymentStatusPartiallyRefunded},
+		// Refunds to a closed card fail after succeeding, returning the money
+		// to the payment
+		{event("evt_3", gateway.RefundFailed), models.RefundStatusFailed, models.PaymentStatusSucceeded},
+		// A failed refund is final
+		{event("evt_4", gateway.RefundSucceeded), models.RefundStatusFailed, models.PaymentStatusSucceeded},
+	} {
+		if err := payments.HandleEvent(ctx, step.event); err != nil {
+			t.Fatal(err)
+		}
+		check(fmt.Sprintf("%s %s", step.event.ID, step.event.Refund.Status), step.wantRefund, step.wantPayment)
+	}
+}
+
+func TestCreateRefundProviderFailures(t *testing.T) {
+	tests := []struct {
+		name string
+		fail error
+		// want is the refund's status afterwards; a pending refund keeps its
+		// amount reserved until a webhook settles it
+		want models.RefundStatus
+	}{
+		{"refused", fmt.Errorf("%w: charge has been disputed", gateway.ErrInvalidRequest), models.RefundStatusFailed},
+		{"timed out", fmt.Errorf("%w: %w", gateway.ErrTimeout, context.DeadlineExceeded), models.RefundStatusPending},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payments, repo, provider, id := newRefundService(t, "tok_visa", models.CaptureAutomatic)
+			provider.fail = tt.fail
+			if _, err := payments.CreateRefund(context.Background(), id, models.CreateRefundRequest{}); !errors.Is(err, apperrors.ErrUpstream) {
+				t.Fatalf("CreateRefund() error = %v, want %v", err, apperrors.ErrUpstream)
+			}
+			if len(repo.refunds) != 1 {
+				t.Fatalf("recorded %d refunds, want 1", len(repo.refunds))
+			}
+			for _, refund := range repo.refunds {
+				if refund.Status != tt.want {
+					t.Errorf("refund status = %q, want %q", refund.Status, tt.want)
+				}
+			}
+			if got := repo.payments[id].Status; got != models.PaymentStatusSucceeded {
+				t.Errorf("payment status = %q, want %q", got, models.PaymentStatusSucceeded)
+			}
+		})
+	}
+}
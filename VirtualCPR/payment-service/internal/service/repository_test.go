@@ -0,0 +1,192 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/payment-service/internal/models"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/payment-service/internal/repository"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/apperrors"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/pagination"
+)
+
+// memoryRepository keeps payments and refunds in maps so the service can be
+// tested without Postgres. Transactions are not isolated.
+type memoryRepository struct {
+	mu       sync.Mutex
+	payments map[string]models.Payment
+	refunds  map[string]models.Refund
+	events   map[string]bool
+}
+
+var _ repository.PaymentRepository = (*memoryRepository)(nil)
+
+func newMemoryRepository() *memoryRepository {
+	return &memoryRepository{
+		payments: make(map[string]models.Payment),
+		refunds:  make(map[string]models.Refund),
+		events:   make(map[string]bool),
+	}
+}
+
+func (r *memoryRepository) CreatePayment(ctx context.Context, payment models.Payment) (models.Payment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.payments[payment.ID]; ok {
+		return models.Payment{}, apperrors.Conflict("payment already exists")
+	}
+	r.payments[payment.ID] = payment
+	return payment, nil
+}
+
+func (r *memoryRepository) GetPaymentByID(ctx context.Context, id string) (models.Payment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	payment, ok := r.payments[id]
+	if !ok {
+		return models.Payment{}, apperrors.NotFound("payment not found")
+	}
+	return payment, nil
+}
+
+func (r *memoryRepository) GetPaymentByStripeChargeID(ctx context.Context, chargeID string) (models.Payment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, payment := range r.payments {
+		if payment.StripeChargeID == chargeID {
+			return payment, nil
+		}
+	}
+	return models.Payment{}, apperrors.NotFound("payment not found")
+}
+
+func (r *memoryRepository) ListPaymentsByUserID(ctx context.Context, userID string, filter models.PaymentFilter, params pagination.Params) ([]models.Payment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var payments []models.Payment
+	for _, payment := range r.payments {
+		if payment.UserID == userID {
+			payments = append(payments, payment)
+		}
+	}
+	return payments, nil
+}
+
+func (r *memoryRepository) UpdatePayment(ctx context.Context, payment models.Payment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.payments[payment.ID]; !ok {
+		return apperrors.NotFound("payment not found")
+	}
+	r.payments[payment.ID] = payment
+	return nil
+}
+
+func (r *memoryRepository) ListExpiredAuthorizations(ctx context.Context, before time.Time, limit int) ([]models.Payment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var expired []models.Payment
+	for _, payment := range r.payments {
+		if payment.Status == models.PaymentStatusAuthorized && payment.AuthorizationExpiresAt.Before(before) {
+			expired = append(expired, payment)
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool {
+		return expired[i].AuthorizationExpiresAt.Before(expired[j].AuthorizationExpiresAt)
+	})
+	if len(expired) > limit {
+		expired = expired[:limit]
+	}
+	return expired, nil
+}
+
+func (r *memoryRepository) ListAbandonedActions(ctx context.Context, before time.Time, limit int) ([]models.Payment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var abandoned []models.Payment
+	for _, payment := range r.payments {
+		if payment.Status == models.PaymentStatusRequiresAction && payment.CaptureMethod == models.CaptureManual && payment.CreatedAt.Before(before) {
+			abandoned = append(abandoned, payment)
+		}
+	}
+	sort.Slice(abandoned, func(i, j int) bool {
+		return abandoned[i].CreatedAt.Before(abandoned[j].CreatedAt)
+	})
+	if len(abandoned) > limit {
+		abandoned = abandoned[:limit]
+	}
+	return abandoned, nil
+}
+
+func (r *memoryRepository) CreateRefund(ctx context.Context, refund models.Refund) (models.Refund, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.refunds[refund.ID]; ok {
+		return models.Refund{}, apperrors.Conflict("refund already exists")
+	}
+	r.refunds[refund.ID] = refund
+	return refund, nil
+}
+
+func (r *memoryRepository) GetRefundByID(ctx context.Context, id string) (models.Refund, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	refund, ok := r.refunds[id]
+	if !ok {
+		return models.Refund{}, apperrors.NotFound("refund not found")
+	}
+	return refund, nil
+}
+
+func (r *memoryRepository) GetRefundByStripeRefundID(ctx context.Context, stripeRefundID string) (models.Refund, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, refund := range r.refunds {
+		if refund.StripeRefundID == stripeRefundID {
+			return refund, nil
+		}
+	}
+	return models.Refund{}, apperrors.NotFound("refund not found")
+}
+
+func (r *memoryRepository) ListRefundsByPaymentID(ctx context.Context, paymentID string) ([]models.Refund, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var refunds []models.Refund
+	for _, refund := range r.refunds {
+		if refund.PaymentID == paymentID {
+			refunds = append(refunds, refund)
+		}
+	}
+	return refunds, nil
+}
+
+func (r *memoryRepository) UpdateRefund(ctx context.Context, refund models.Refund) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.refunds[refund.ID]; !ok {
+		return apperrors.NotFound("refund not found")
+	}
+	r.refunds[refund.ID] = refund
+	return nil
+}
+
+func (r *memoryRepository) LockPayment(ctx context.Context, id string) (models.Payment, error) {
+	return r.GetPaymentByID(ctx, id)
+}
+
+func (r *memoryRepository) RecordEvent(ctx context.Context, eventID, eventType string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.events[eventID] {
+		return false, nil
+	}
+	r.events[eventID] = true
+	return true, nil
+}
+
+func (r *memoryRepository) InTx(ctx context.Context, fn func(repo repository.PaymentRepository) error) error {
+	return fn(r)
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/payment-service/internal/models"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/payment-service/internal/repository"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/apperrors"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/logging"
+)
+
+const statusRetryInterval = 2 * time.Second
+
+// StatusUpdates retries payment status writes that failed after the provider
+// call, so a transient database error does not leave a charged payment pending.
+// Only the latest status per payment is kept.
+type StatusUpdates struct {
+	repo     repository.PaymentRepository
+	interval time.Duration
+
+	mu      sync.Mutex
+	pending map[string]models.Payment
+	closed  bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewStatusUpdates(repo repository.PaymentRepository) *StatusUpdates {
+	updates := &StatusUpdates{
+		repo:     repo,
+		interval: statusRetryInterval,
+		pending:  make(map[string]models.Payment),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go updates.run()
+	return updates
+}
+
+// Write stores the payment's status, queueing it for retry if the write fails.
+// The write outlives the caller's cancellation because the provider call it
+// records has already happened.
+func (u *StatusUpdates) Write(ctx context.Context, payment models.Payment) {
+	err := u.write(context.WithoutCancel(ctx), payment)
+	if err == nil || errors.Is(err, apperrors.ErrNotFound) {
+		return
+	}
+	logging.For("status-updates").WarnContext(ctx, "Failed to update payment status, will retry", "payment_id", payment.ID, "status", payment.Status, "error", err)
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.closed {
+		logging.For("status-updates").ErrorContext(ctx, "Dropping payment status update while shutting down", "payment_id", payment.ID, "status", payment.Status)
+		return
+	}
+	u.pending[payment.ID] = payment
+}
+
+// Flush stops the retry loop and keeps retrying queued updates until they are
+// all written or ctx expires.
+func (u *StatusUpdates) Flush(ctx context.Context) error {
+	u.mu.Lock()
+	u.closed = true
+	u.mu.Unlock()
+	close(u.stop)
+	<-u.done
+
+	for {
+		remaining := u.retry(ctx)
+		if remaining == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d payment status update(s) not written: %w", remaining, ctx.Err())
+		case <-time.After(u.interval):
+		}
+	}
+}
+
+func (u *StatusUpdates) run() {
+	defer close(u.done)
+	ticker := time.NewTicker(u.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-u.stop:
+			return
+		case <-ticker.C:
+			u.retry(context.Background())
+		}
+	}
+}
+
+// retry attempts every queued update once and returns how many remain.
+func (u *StatusUpdates) retry(ctx context.Context) int {
+	u.mu.Lock()
+	batch := make([]models.Payment, 0, len(u.pending))
+	for _, payment := range u.pending {
+		batch = append(batch, payment)
+	}
+	u.mu.Unlock()
+
+	for _, payment := range batch {
+		if err := u.write(ctx, payment); err != nil && !errors.Is(err, apperrors.ErrNotFound) {
+			continue
+		}
+		u.mu.Lock()
+		// A newer status may have been queued while this one was written
+		if latest, ok := u.pending[payment.ID]; ok && latest.Status == payment.Status {
+			delete(u.pending, payment.ID)
+		}
+		u.mu.Unlock()
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return len(u.pending)
+}
+
+// write applies payment's status, charge ID and captured amount unless a webhook has already
+// moved the payment past it.
+func (u *StatusUpdates) write(ctx context.Context, payment models.Payment) error {
+	return u.repo.InTx(ctx, func(repo repository.PaymentRepository) error {
+		current, err := repo.LockPayment(ctx, payment.ID)
+		if err != nil {
+			return err
+		}
+		if !current.Status.CanTransition(payment.Status) {
+			logging.For("status-updates").InfoContext(ctx, "Keeping newer payment status", "payment_id", payment.ID, "status", current.Status, "dropped_status", payment.Status)
+			return nil
+		}
+		current.Status = payment.Status
+		if payment.StripeChargeID != "" {
+			current.StripeChargeID = payment.StripeChargeID
+		}
+		current.AmountCaptured = payment.AmountCaptured
+		if !payment.AuthorizationExpiresAt.IsZero() {
+			current.AuthorizationExpiresAt = payment.AuthorizationExpiresAt
+		}
+		return repo.UpdatePayment(ctx, current)
+	})
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/payment-service/internal/gateway"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/payment-service/internal/models"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/payment-service/internal/repository"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/apperrors"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/logging"
+)
+
+// HandleEvent applies a provider webhook event to its payment. Each event is
+// applied at most once: its ID is recorded in the same transaction as the
+// update, so a redelivery is acknowledged without effect. Events older than
+// the last one applied, or that would undo a later outcome, are recorded but
+// change nothing.
+func (s *PaymentService) HandleEvent(ctx context.Context, event gateway.Event) error {
+	log := logging.For("webhooks")
+	return s.repo.InTx(ctx, func(repo repository.PaymentRepository) error {
+		recorded, err := repo.RecordEvent(ctx, event.ID, event.Type)
+		if err != nil {
+			return err
+		}
+		if !recorded {
+			log.InfoContext(ctx, "Skipping duplicate event", "event_id", event.ID, "type", event.Type)
+			return nil
+		}
+		switch event.Kind {
+		case "":
+			return nil
+		case gateway.EventRefund:
+			return applyRefundEvent(ctx, repo, event)
+		}
+
+		payment, err := lockEventPayment(ctx, repo, event)
+		if errors.Is(err, apperrors.ErrNotFound) {
+			log.InfoContext(ctx, "Ignoring event for an unknown payment", "event_id", event.ID, "type", event.Type, "charge_id", event.Charge.ID)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if event.Created.Before(payment.LastEventAt) {
+			log.InfoContext(ctx, "Ignoring stale event", "event_id", event.ID, "type", event.Type, "payment_id", payment.ID)
+			return nil
+		}
+
+		status := eventStatus(event, payment)
+		allowed := payment.Status.CanTransition(status)
+		if event.Kind == gateway.EventDisputeWon {
+			// Only a won dispute takes a payment out of disputed
+			allowed = payment.Status == models.PaymentStatusDisputed
+		}
+		if !allowed {
+			log.InfoContext(ctx, "Ignoring event that would undo a later status", "event_id", event.ID, "type", event.Type, "payment_id", payment.ID, "status", payment.Status, "event_status", status)
+			return nil
+		}
+		if event.Kind == gateway.EventCharge {
+			s.applyCharge(&payment, event.Charge)
+		} else {
+			payment.Status = status
+		}
+		payment.LastEventAt = event.Created
+		if err := repo.UpdatePayment(ctx, payment); err != nil {
+			return err
+		}
+		log.InfoContext(ctx, "Applied event", "event_id", event.ID, "type", event.Type, "payment_id", payment.ID, "status", status)
+		return nil
+	})
+}
+
+// applyRefundEvent updates the refund an event is about, found by the refund
+// ID in its metadata when present and otherwise by the provider's refund ID.
+// Refunds made outside this service are ignored.
+func applyRefundEvent(ctx context.Context, repo repository.PaymentRepository, event gateway.Event) error {
+	var refund models.Refund
+	var err error
+	if event.RefundID != "" {
+		refund, err = repo.GetRefundByID(ctx, event.RefundID)
+	} else {
+		refund, err = repo.GetRefundByStripeRefundID(ctx, event.Refund.ID)
+	}
+	if errors.Is(err, apperrors.ErrNotFound) {
+		logging.For("webhooks").InfoContext(ctx, "Ignoring event for an unknown refund", "event_id", event.ID, "type", event.Type, "stripe_refund_id", event.Refund.ID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	refund.Status = refundStatus(event.Refund.Status)
+	refund.StripeRefundID = event.Refund.ID
+	return applyRefund(ctx, repo, refund)
+}
+
+// lockEventPayment finds the payment an event is about, by the payment ID in
+// the charge's metadata when present and otherwise by charge ID.
+func lockEventPayment(ctx context.Context, repo repository.PaymentRepository, event gateway.Event) (models.Payment, error) {
+	id := event.PaymentID
+	if id == "" {
+		payment, err := repo.GetPaymentByStripeChargeID(ctx, event.Charge.ID)
+		if err != nil {
+			return models.Payment{}, err
+		}
+		id = payment.ID
+	}
+	return repo.LockPayment(ctx, id)
+}
+
+func eventStatus(event gateway.Event, payment models.Payment) models.PaymentStatus {
+	switch event.Kind {
+	case gateway.EventDisputeOpened:
+		return models.PaymentStatusDisputed
+	case gateway.EventDisputeWon:
+		return payment.SettledStatus(0)
+	default:
+		return paymentStatus(event.Charge.Status, payment.CaptureMethod)
+	}
+}
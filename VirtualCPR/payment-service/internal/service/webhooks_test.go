@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/payment-service/internal/gateway"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/payment-service/internal/models"
+)
+
+func newWebhookService(t *testing.T, payment models.Payment) (*PaymentService, *memoryRepository) {
+	t.Helper()
+	repo := newMemoryRepository()
+	repo.payments[payment.ID] = payment
+	statuses := NewStatusUpdates(repo)
+	t.Cleanup(func() { statuses.Flush(context.Background()) })
+	payments := NewPaymentService(repo, statuses, gateway.NewFakeGateway(), AuthorizationConfig{TTL: time.Hour})
+	return &payments, repo
+}
+
+func chargeEvent(id string, created time.Time, status gateway.ChargeStatus) gateway.Event {
+	return gateway.Event{
+		ID:        id,
+		Type:      "payment_intent." + string(status),
+		Kind:      gateway.EventCharge,
+		Created:   created,
+		PaymentID: "payment-1",
+		Charge:    gateway.Charge{ID: "pi_1", Status: status, Amount: 1250, AmountCaptured: 1250},
+	}
+}
+
+func TestHandleEventAppliesOnlyNewerOutcomes(t *testing.T) {
+	start := time.Unix(1760000000, 0)
+	tests := []struct {
+		name   string
+		events []gateway.Event
+		want   models.PaymentStatus
+	}{
+		{"succeeded", []gateway.Event{
+			chargeEvent("evt_1", start, gateway.ChargeSucceeded),
+		}, models.PaymentStatusSucceeded},
+		{"processing then succeeded", []gateway.Event{
+			chargeEvent("evt_1", start, gateway.ChargeProcessing),
+			chargeEvent("evt_2", start.Add(time.Second), gateway.ChargeSucceeded),
+		}, models.PaymentStatusSucceeded},
+		// Stripe does not promise delivery order; the older event arrives last
+		{"delivered out of order", []gateway.Event{
+			chargeEvent("evt_2", start.Add(time.Second), gateway.ChargeSucceeded),
+			chargeEvent("evt_1", start, gateway.ChargeProcessing),
+		}, models.PaymentStatusSucceeded},
+		// Newer by timestamp, but a succeeded payment cannot go back
+		{"would move backwards", []gateway.Event{
+			chargeEvent("evt_1", start, gateway.ChargeSucceeded),
+			chargeEvent("evt_2", start.Add(time.Second), gateway.ChargeProcessing),
+		}, models.PaymentStatusSucceeded},
+		{"failed then retried", []gateway.Event{
+			chargeEvent("evt_1", start, gateway.ChargeRequiresPaymentMethod),
+			chargeEvent("evt_2", start.Add(time.Second), gateway.ChargeSucceeded),
+		}, models.PaymentStatusSucceeded},
+		{"dispute opened", []gateway.Event{
+			chargeEvent("evt_1", start, gateway.ChargeSucceeded),
+			{ID: "evt_2", Kind: gateway.EventDisputeOpened, Created: start.Add(time.Second), Charge: gateway.Charge{ID: "pi_1"}},
+		}, models.PaymentStatusDisputed},
+		{"dispute won", []gateway.Event{
+			{ID: "evt_1", Kind: gateway.EventDisputeOpened, Created: start, Charge: gateway.Charge{ID: "pi_1"}},
+			{ID: "evt_2", Kind: gateway.EventDisputeWon, Created: start.Add(time.Second), Charge: gateway.Charge{ID: "pi_1"}},
+		}, models.PaymentStatusSucceeded},
+		// Both events carry the same second, so only the recorded event ID
+		// keeps the redelivery from reopening the dispute
+		{"redelivered", []gateway.Event{
+			{ID: "evt_1", Kind: gateway.EventDisputeOpened, Created: start, Charge: gateway.Charge{ID: "pi_1"}},
+			{ID: "evt_2", Kind: gateway.EventDisputeWon, Created: start, Charge: gateway.Charge{ID: "pi_1"}},
+			{ID: "evt_1", Kind: gateway.EventDisputeOpened, Created: start, Charge: gateway.Charge{ID: "pi_1"}},
+		}, models.PaymentStatusSucceeded},
+		{"unknown payment", []gateway.Event{
+			{ID: "evt_1", Kind: gateway.EventCharge, Created: start, PaymentID: "payment-9", Charge: gateway.Charge{ID: "pi_9", Status: gateway.ChargeSucceeded}},
+		}, models.PaymentStatusProcessing},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Disputes are only opened against payments that succeeded
+			status := models.PaymentStatusProcessing
+			if tt.events[0].Kind == gateway.EventDisputeOpened {
+				status = models.PaymentStatusSucceeded
+			}
+			payments, repo := newWebhookService(t, models.Payment{
+				ID: "payment-1", Amount: 1250, Currency: "usd", Status: status,
+				StripeChargeID: "pi_1", CaptureMethod: models.CaptureAutomatic,
+			})
+			for _, event := range tt.events {
+				if err := payments.HandleEvent(context.Background(), event); err != nil {
+					t.Fatalf("HandleEvent(%s) error = %v", event.ID, err)
+				}
+			}
+			if got := repo.payments["payment-1"].Status; got != tt.want {
+				t.Errorf("status = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
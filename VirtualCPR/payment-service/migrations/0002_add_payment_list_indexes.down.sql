@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_payments_user_id_status_created_at_id;
+DROP INDEX IF EXISTS idx_payments_user_id_created_at_id;
@@ -0,0 +1,3 @@
+-- Keyset pagination and the payment history filters
+CREATE INDEX IF NOT EXISTS idx_payments_user_id_created_at_id ON payments (user_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_payments_user_id_status_created_at_id ON payments (user_id, status, created_at DESC, id DESC);
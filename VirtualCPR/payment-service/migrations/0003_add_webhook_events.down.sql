@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_payments_stripe_charge_id;
+ALTER TABLE payments DROP COLUMN IF EXISTS last_event_at;
+DROP TABLE IF EXISTS processed_events;
@@ -0,0 +1,9 @@
+-- Provider webhook events already applied, so redeliveries are ignored
+CREATE TABLE IF NOT EXISTS processed_events (
+    id VARCHAR(255) PRIMARY KEY,
+    type VARCHAR(100) NOT NULL,
+    processed_at TIMESTAMP NOT NULL
+);
+-- Creation time of the newest provider event applied to each payment
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS last_event_at TIMESTAMP;
+CREATE INDEX IF NOT EXISTS idx_payments_stripe_charge_id ON payments (stripe_charge_id);
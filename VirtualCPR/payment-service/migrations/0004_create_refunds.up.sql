@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS refunds (
+    id VARCHAR(36) PRIMARY KEY,
+    payment_id VARCHAR(36) NOT NULL REFERENCES payments (id),
+    amount BIGINT NOT NULL,
+    reason VARCHAR(30),
+    status VARCHAR(20) NOT NULL,
+    stripe_refund_id VARCHAR(255),
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_refunds_payment_id_created_at ON refunds (payment_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_refunds_stripe_refund_id ON refunds (stripe_refund_id);
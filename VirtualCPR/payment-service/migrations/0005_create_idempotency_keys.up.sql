@@ -0,0 +1,11 @@
+-- Responses to requests sent with an Idempotency-Key, replayed on retries
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    key VARCHAR(255) NOT NULL,
+    caller VARCHAR(255) NOT NULL,
+    fingerprint CHAR(64) NOT NULL,
+    status_code INT NOT NULL,
+    content_type VARCHAR(255) NOT NULL,
+    response_body BYTEA,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (key, caller)
+);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_payments_status_authorization_expires_at;
+ALTER TABLE payments DROP COLUMN IF EXISTS authorization_expires_at;
+ALTER TABLE payments DROP COLUMN IF EXISTS amount_captured;
+ALTER TABLE payments DROP COLUMN IF EXISTS capture_method;
@@ -0,0 +1,8 @@
+-- Manual capture: a payment can be authorized first and captured or voided later
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS capture_method VARCHAR(10) NOT NULL DEFAULT 'automatic';
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS amount_captured BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS authorization_expires_at TIMESTAMP;
+UPDATE payments SET amount_captured = amount
+    WHERE status IN ('succeeded', 'partially_refunded', 'refunded', 'disputed');
+-- The expiry sweeper looks for authorizations past their deadline
+CREATE INDEX IF NOT EXISTS idx_payments_status_authorization_expires_at ON payments (status, authorization_expires_at);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_payments_live_order_id;
+ALTER TABLE payments DROP COLUMN IF EXISTS order_id;
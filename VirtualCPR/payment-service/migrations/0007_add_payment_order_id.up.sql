@@ -0,0 +1,6 @@
+-- The order a payment pays for, when it was made through order checkout
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS order_id VARCHAR(36);
+-- An order has at most one payment that has not failed or been voided, so it
+-- cannot be paid twice
+CREATE UNIQUE INDEX IF NOT EXISTS idx_payments_live_order_id ON payments (order_id)
+    WHERE order_id IS NOT NULL AND status NOT IN ('failed', 'voided');
@@ -0,0 +1,3 @@
+-- Identifies the request that claimed a key, so only that request can store
+-- its response or release the key
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS claim_token VARCHAR(36) NOT NULL DEFAULT '';
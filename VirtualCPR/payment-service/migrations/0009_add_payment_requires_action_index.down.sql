@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_payments_requires_action_created_at;
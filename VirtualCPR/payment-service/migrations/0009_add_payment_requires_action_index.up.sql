@@ -0,0 +1,4 @@
+-- The expiry sweeper also voids manual capture payments left waiting for the
+-- customer to authenticate
+CREATE INDEX IF NOT EXISTS idx_payments_requires_action_created_at ON payments (created_at)
+    WHERE status = 'requires_action' AND capture_method = 'manual';
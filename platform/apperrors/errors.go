@@ -0,0 +1,148 @@
+// Package apperrors defines the domain error kinds shared by repositories,
+// services and handlers, and how each kind maps to an HTTP status.
+package apperrors
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+)
+
+// StatusClientClosedRequest is the non-standard status, popularised by nginx,
+// recorded when the client went away before the response was ready.
+const StatusClientClosedRequest = 499
+
+// Sentinel kinds. Match them with errors.Is on any error built by this package.
+var (
+	ErrNotFound             = errors.New("not found")
+	ErrConflict             = errors.New("conflict")
+	ErrValidation           = errors.New("validation failed")
+	ErrUnauthorized         = errors.New("unauthorized")
+	ErrForbidden            = errors.New("forbidden")
+	ErrUnsupportedMediaType = errors.New("unsupported media type")
+	ErrUpstream             = errors.New("upstream failure")
+	ErrPaymentRequired      = errors.New("payment required")
+	ErrUnprocessable        = errors.New("unprocessable entity")
+	ErrTimeout              = errors.New("timeout")
+	ErrCanceled             = errors.New("canceled")
+)
+
+// Error carries a kind, a client-facing message and an optional cause. The
+// cause is logged but never sent to clients.
+type Error struct {
+	Kind    error
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Is(target error) bool {
+	return e.Kind == target
+}
+
+func New(kind error, message string) *Error {
+	return &Error{Kind: kind, Message: message}
+}
+
+func Wrap(kind error, message string, cause error) *Error {
+	return &Error{Kind: kind, Message: message, Err: cause}
+}
+
+func NotFound(message string) *Error {
+	return New(ErrNotFound, message)
+}
+
+func Conflict(message string) *Error {
+	return New(ErrConflict, message)
+}
+
+func Validation(message string) *Error {
+	return New(ErrValidation, message)
+}
+
+func Unauthorized(message string) *Error {
+	return New(ErrUnauthorized, message)
+}
+
+func Forbidden(message string) *Error {
+	return New(ErrForbidden, message)
+}
+
+func Upstream(message string, cause error) *Error {
+	return Wrap(ErrUpstream, message, cause)
+}
+
+// FromContext explains err by ctx when ctx has ended: work cut short by the
+// request deadline is a timeout and work abandoned by the client is canceled.
+// Drivers do not always return the context's error when a query is
+// interrupted, so the context is the more reliable witness.
+func FromContext(ctx context.Context, err error) error {
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return Wrap(ErrTimeout, "the request did not complete in time", err)
+	case errors.Is(ctx.Err(), context.Canceled):
+		return Wrap(ErrCanceled, "the client closed the request", err)
+	default:
+		return err
+	}
+}
+
+// StatusCode maps an error to the HTTP status it should be reported with.
+// A missing row that escaped its repository is a miss like any other; anything
+// else that is not a known kind is an internal error.
+func StatusCode(err error) int {
+	switch {
+	case errors.Is(err, ErrCanceled), errors.Is(err, context.Canceled):
+		return StatusClientClosedRequest
+	case errors.Is(err, ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, ErrNotFound), errors.Is(err, sql.ErrNoRows):
+		return http.StatusNotFound
+	case errors.Is(err, ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, ErrValidation):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrUnauthorized):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, ErrUnsupportedMediaType):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, ErrUnprocessable):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, ErrPaymentRequired):
+		return http.StatusPaymentRequired
+	case errors.Is(err, ErrUpstream):
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Message returns the client-facing text for err. Errors that were not built
+// by this package are internal and get a generic message.
+func Message(err error) string {
+	var fieldErr *FieldErrors
+	if errors.As(err, &fieldErr) {
+		return fieldErr.Message
+	}
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr.Message
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return "the requested resource was not found"
+	}
+	return "an unexpected error occurred"
+}
@@ -0,0 +1,108 @@
+package apperrors
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/redact"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/requestid"
+)
+
+const ProblemContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details body.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// Middleware renders the last error a handler attached with c.Error as
+// application/problem+json. Internal details are logged with the request ID
+// and never included in the response; secrets are masked in both.
+func Middleware() gin.HandlerFunc {
+	useJSONFieldNames()
+
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+		err := c.Errors.Last().Err
+		if StatusCode(err) >= http.StatusInternalServerError {
+			err = FromContext(c.Request.Context(), err)
+		}
+		problem := NewProblem(c, err)
+
+		if problem.Status >= http.StatusInternalServerError {
+			slog.ErrorContext(c.Request.Context(), "Request failed",
+				"method", c.Request.Method,
+				"path", c.Request.URL.Path,
+				"error", err,
+			)
+		}
+
+		c.Header("Content-Type", ProblemContentType)
+		c.Render(problem.Status, render.JSON{Data: problem})
+	}
+}
+
+func NewProblem(c *gin.Context, err error) Problem {
+	status := StatusCode(err)
+	problem := Problem{
+		Type:      problemType(status),
+		Title:     statusText(status),
+		Status:    status,
+		Detail:    redact.Default().Text(Message(err)),
+		Instance:  c.Request.URL.Path,
+		RequestID: requestid.Get(c),
+	}
+
+	var fieldErr *FieldErrors
+	if errors.As(err, &fieldErr) {
+		problem.Errors = fieldErr.Fields
+	}
+	return problem
+}
+
+// Recovery turns panics into internal errors rendered by Middleware, which
+// must be registered before it. The stack is logged as structured JSON in place
+// of gin's plain text dump.
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, recovered any) {
+		slog.ErrorContext(c.Request.Context(), "Panic recovered", "panic", recovered, "stack", string(debug.Stack()))
+		c.Error(fmt.Errorf("panic recovered: %v", recovered))
+		c.Abort()
+	})
+}
+
+// NoRoute reports unknown routes as problems instead of gin's plain text 404.
+func NoRoute() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Error(NotFound("no route matches " + c.Request.Method + " " + c.Request.URL.Path))
+	}
+}
+
+func problemType(status int) string {
+	slug := strings.ReplaceAll(strings.ToLower(statusText(status)), " ", "-")
+	return "/problems/" + slug
+}
+
+func statusText(status int) string {
+	if status == StatusClientClosedRequest {
+		return "Client Closed Request"
+	}
+	return http.StatusText(status)
+}
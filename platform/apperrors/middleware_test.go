@@ -0,0 +1,101 @@
+package apperrors
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMiddlewareRendersProblems(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cause := errors.New("dial tcp 10.0.0.7:5432: connection refused")
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		fields []FieldError
+	}{
+		{"not found", NotFound("user not found"), http.StatusNotFound, nil},
+		{"conflict", Conflict("a user with this email already exists"), http.StatusConflict, nil},
+		{"validation", Validation("invalid user ID"), http.StatusBadRequest, nil},
+		{"field errors", &FieldErrors{Message: "request body failed validation", Fields: []FieldError{{Field: "email", Message: "is required"}}}, http.StatusBadRequest, []FieldError{{Field: "email", Message: "is required"}}},
+		{"upstream", Upstream("user-service is unavailable", cause), http.StatusBadGateway, nil},
+		{"unauthorized", Unauthorized("missing bearer token"), http.StatusUnauthorized, nil},
+		{"forbidden", Forbidden("insufficient permissions"), http.StatusForbidden, nil},
+		{"wrapped kind", fmt.Errorf("handler: %w", NotFound("user not found")), http.StatusNotFound, nil},
+		{"missing row", fmt.Errorf("query: %w", sql.ErrNoRows), http.StatusNotFound, nil},
+		{"deadline", fmt.Errorf("query: %w", context.DeadlineExceeded), http.StatusGatewayTimeout, nil},
+		{"unknown", cause, http.StatusInternalServerError, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(Middleware(), Recovery())
+			router.GET("/fail", func(c *gin.Context) {
+				c.Error(tt.err)
+			})
+
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/fail", nil))
+
+			problem := decodeProblem(t, recorder, tt.status)
+			if problem.Instance != "/fail" || problem.Type != problemType(tt.status) {
+				t.Errorf("problem = %+v, want instance /fail and type %s", problem, problemType(tt.status))
+			}
+			if fmt.Sprint(problem.Errors) != fmt.Sprint(tt.fields) {
+				t.Errorf("problem errors = %v, want %v", problem.Errors, tt.fields)
+			}
+			// Causes are logged, never sent
+			if strings.Contains(recorder.Body.String(), "connection refused") {
+				t.Errorf("response leaks the cause: %s", recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestMiddlewareRendersPanicsAndUnknownRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Middleware(), Recovery())
+	router.NoRoute(NoRoute())
+	router.GET("/panic", func(c *gin.Context) {
+		panic("password=hunter2")
+	})
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	decodeProblem(t, recorder, http.StatusInternalServerError)
+	if strings.Contains(recorder.Body.String(), "hunter2") {
+		t.Errorf("response leaks the panic: %s", recorder.Body.String())
+	}
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	decodeProblem(t, recorder, http.StatusNotFound)
+}
+
+func decodeProblem(t *testing.T, recorder *httptest.ResponseRecorder, status int) Problem {
+	t.Helper()
+	if recorder.Code != status {
+		t.Fatalf("status = %d, want %d; body = %s", recorder.Code, status, recorder.Body)
+	}
+	if got := recorder.Header().Get("Content-Type"); got != ProblemContentType {
+		t.Errorf("Content-Type = %q, want %q", got, ProblemContentType)
+	}
+	var problem Problem
+	if err := json.Unmarshal(recorder.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("decoding problem: %v", err)
+	}
+	if problem.Status != status {
+		t.Errorf("problem status = %d, want %d", problem.Status, status)
+	}
+	return problem
+}
@@ -0,0 +1,124 @@
+package apperrors
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// FieldErrors is a validation error that lists each invalid field.
+type FieldErrors struct {
+	Message string
+	Fields  []FieldError
+}
+
+func (e *FieldErrors) Error() string {
+	parts := make([]string, 0, len(e.Fields))
+	for _, field := range e.Fields {
+		parts = append(parts, field.Field+": "+field.Message)
+	}
+	return e.Message + ": " + strings.Join(parts, "; ")
+}
+
+func (e *FieldErrors) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// InvalidRequest converts a binding or decoding error into a validation error
+// naming the offending fields by their JSON names.
+func InvalidRequest(err error) error {
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		fields := make([]FieldError, 0, len(validationErrs))
+		for _, fieldErr := range validationErrs {
+			fields = append(fields, FieldError{Field: fieldPath(fieldErr), Message: describe(fieldErr)})
+		}
+		return &FieldErrors{Message: "request body failed validation", Fields: fields}
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return &FieldErrors{
+			Message: "request body failed validation",
+			Fields:  []FieldError{{Field: typeErr.Field, Message: "must be of type " + typeErr.Type.String()}},
+		}
+	}
+
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return Validation("request body is not valid JSON")
+	}
+
+	if strings.HasPrefix(err.Error(), "json: unknown field ") {
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return &FieldErrors{
+			Message: "request body failed validation",
+			Fields:  []FieldError{{Field: field, Message: "is not a recognised field"}},
+		}
+	}
+
+	return Validation("request body is invalid")
+}
+
+func fieldPath(fieldErr validator.FieldError) string {
+	namespace := fieldErr.Namespace()
+	// Drop the root struct name, e.g. "CreateUserRequest.email" -> "email"
+	if _, rest, found := strings.Cut(namespace, "."); found {
+		return rest
+	}
+	return fieldErr.Field()
+}
+
+func describe(fieldErr validator.FieldError) string {
+	switch fieldErr.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "min":
+		return fmt.Sprintf("must be at least %s characters", fieldErr.Param())
+	case "max":
+		return fmt.Sprintf("must be at most %s characters", fieldErr.Param())
+	case "oneof":
+		return "must be one of: " + fieldErr.Param()
+	case "gt":
+		return "must be greater than " + fieldErr.Param()
+	default:
+		return "failed the " + fieldErr.Tag() + " check"
+	}
+}
+
+var registerFieldNames sync.Once
+
+// useJSONFieldNames makes validator report fields by their JSON tag rather
+// than the Go struct field name.
+func useJSONFieldNames() {
+	registerFieldNames.Do(func() {
+		engine, ok := binding.Validator.Engine().(*validator.Validate)
+		if !ok {
+			return
+		}
+		engine.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				return ""
+			}
+			if name == "" {
+				return field.Name
+			}
+			return name
+		})
+	})
+}
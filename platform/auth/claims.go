@@ -0,0 +1,46 @@
+// Package auth issues and verifies the access tokens shared by every service
+// and enforces each service's route access policy.
+package auth
+
+import "github.com/golang-jwt/jwt/v5"
+
+type Role string
+
+const (
+	RoleCustomer Role = "customer"
+	RoleSupport  Role = "support"
+	RoleAdmin    Role = "admin"
+	// RoleService is held by other services, which act on behalf of any
+	// user. user-service issues it to the clients in SERVICE_CLIENTS only.
+	RoleService Role = "service"
+)
+
+// Claims is the access token payload user-service issues and the other
+// services verify.
+type Claims struct {
+	Email string `json:"email"`
+	Role  Role   `json:"role"`
+	jwt.RegisteredClaims
+}
+
+// Identity is the authenticated caller attached to each request.
+type Identity struct {
+	UserID string
+	Email  string
+	Role   Role
+	Token  string
+}
+
+func (i Identity) IsAdmin() bool {
+	return i.Role == RoleAdmin
+}
+
+// CanReadUser reports whether the caller may read data owned by userID.
+func (i Identity) CanReadUser(userID string) bool {
+	return i.UserID == userID || i.Role == RoleSupport || i.Role == RoleAdmin || i.Role == RoleService
+}
+
+// CanWriteUser reports whether the caller may create or change data owned by userID.
+func (i Identity) CanWriteUser(userID string) bool {
+	return i.UserID == userID || i.Role == RoleAdmin || i.Role == RoleService
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"strings"
+	"time"
+
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/config"
+)
+
+// Config is how order-service and payment-service verify access tokens.
+type Config struct {
+	JWKSURL      string
+	JWKSCacheTTL time.Duration
+	Secret       string
+	Issuer       string
+}
+
+func GetConfigFromEnv(env *config.Env) Config {
+	return Config{
+		JWKSURL:      env.String("AUTH_JWKS_URL", "http://localhost:8080/.well-known/jwks.json"),
+		JWKSCacheTTL: env.Duration("AUTH_JWKS_CACHE_TTL", 10*time.Minute),
+		Secret:       env.String("JWT_SECRET", ""),
+		Issuer:       env.String("JWT_ISSUER", "user-service"),
+	}
+}
+
+// GetKeyConfigFromEnv reads how user-service signs access tokens.
+func GetKeyConfigFromEnv(env *config.Env) KeyConfig {
+	return KeyConfig{
+		Algorithm:      env.String("JWT_ALGORITHM", AlgorithmRS256),
+		KeyID:          env.String("JWT_KEY_ID", ""),
+		Secret:         env.String("JWT_SECRET", ""),
+		SecretFile:     env.String("JWT_SECRET_FILE", ""),
+		PrivateKey:     env.String("JWT_PRIVATE_KEY", ""),
+		PrivateKeyFile: env.String("JWT_PRIVATE_KEY_FILE", ""),
+		Issuer:         env.String("JWT_ISSUER", "user-service"),
+		TTL:            env.Duration("JWT_TTL", 15*time.Minute),
+	}
+}
+
+// GetServiceClientsFromEnv reads the services user-service issues service
+// tokens to, as SERVICE_CLIENTS entries of the form "client-id:secret".
+func GetServiceClientsFromEnv(env *config.Env) ServiceClients {
+	clients := ServiceClients{}
+	for _, entry := range strings.Split(env.String("SERVICE_CLIENTS", ""), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		clientID, secret, found := strings.Cut(entry, ":")
+		if !found || clientID == "" || secret == "" {
+			env.Errorf("SERVICE_CLIENTS entries must look like client-id:secret, got %q", clientID)
+			continue
+		}
+		clients[clientID] = secret
+	}
+	return clients
+}
+
+// GetServiceClientConfigFromEnv reads how a service obtains its own access
+// token. The client ID defaults to the service's name and the secret is
+// required.
+func GetServiceClientConfigFromEnv(env *config.Env, name string) ServiceClientConfig {
+	clientConfig := ServiceClientConfig{
+		TokenURL:     env.String("SERVICE_TOKEN_URL", "http://localhost:8080/api/auth/token"),
+		ClientID:     env.String("SERVICE_CLIENT_ID", name),
+		ClientSecret: env.String("SERVICE_CLIENT_SECRET", ""),
+	}
+	if clientConfig.ClientSecret == "" {
+		env.Errorf("SERVICE_CLIENT_SECRET is required")
+	}
+	return clientConfig
+}
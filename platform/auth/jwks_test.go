@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestJWKSCacheSharesConcurrentRefreshes(t *testing.T) {
+	keys, err := NewKeyManager(KeyConfig{Algorithm: AlgorithmRS256, KeyID: "k1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fetches atomic.Int32
+	issuer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		// Hold the fetch open so every caller arrives while it is in flight
+		time.Sleep(50 * time.Millisecond)
+		json.NewEncoder(w).Encode(keys.JWKS())
+	}))
+	defer issuer.Close()
+
+	cache := NewJWKSCache(issuer.URL, time.Minute)
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cache.Key("k1"); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("Key() error = %v", err)
+	}
+	if got := fetches.Load(); got != 1 {
+		t.Errorf("issuer fetched %d times, want 1", got)
+	}
+}
+
+func TestJWKSCacheRejectsUnknownKidWithoutRefetching(t *testing.T) {
+	keys, err := NewKeyManager(KeyConfig{Algorithm: AlgorithmRS256, KeyID: "k1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fetches atomic.Int32
+	issuer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		json.NewEncoder(w).Encode(keys.JWKS())
+	}))
+	defer issuer.Close()
+
+	cache := NewJWKSCache(issuer.URL, time.Minute)
+	if _, err := cache.Key("k1"); err != nil {
+		t.Fatalf("Key(k1) error = %v", err)
+	}
+	for range 5 {
+		if _, err := cache.Key("rotated"); err == nil {
+			t.Fatal("Key(rotated) succeeded, want unknown key error")
+		}
+	}
+	if got := fetches.Load(); got != 1 {
+		t.Errorf("issuer fetched %d times, want 1 within the refresh interval", got)
+	}
+}
@@ -0,0 +1,213 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/logging"
+)
+
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+)
+
+type KeyConfig struct {
+	Algorithm      string
+	KeyID          string
+	Secret         string
+	SecretFile     string
+	PrivateKey     string
+	PrivateKeyFile string
+	Issuer         string
+	TTL            time.Duration
+}
+
+// KeyManager signs access tokens and publishes the verification keys.
+type KeyManager struct {
+	algorithm  string
+	keyID      string
+	issuer     string
+	ttl        time.Duration
+	secret     []byte
+	privateKey *rsa.PrivateKey
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+func NewKeyManager(config KeyConfig) (*KeyManager, error) {
+	manager := &KeyManager{
+		algorithm: strings.ToUpper(config.Algorithm),
+		keyID:     config.KeyID,
+		issuer:    config.Issuer,
+		ttl:       config.TTL,
+	}
+	if manager.ttl <= 0 {
+		manager.ttl = 15 * time.Minute
+	}
+
+	switch manager.algorithm {
+	case AlgorithmHS256:
+		secret, err := readValueOrFile(config.Secret, config.SecretFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWT secret: %w", err)
+		}
+		if len(secret) < 32 {
+			return nil, errors.New("HS256 secret must be at least 32 bytes")
+		}
+		manager.secret = secret
+	case AlgorithmRS256:
+		pemBytes, err := readValueOrFile(config.PrivateKey, config.PrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWT private key: %w", err)
+		}
+		if len(pemBytes) == 0 {
+			logging.For("auth").Warn("No JWT private key configured, generating an ephemeral RSA key. Tokens will not survive a restart")
+			manager.privateKey, err = rsa.GenerateKey(rand.Reader, 2048)
+			if err != nil {
+				return nil, fmt.Errorf("failed to generate RSA key: %w", err)
+			}
+		} else {
+			manager.privateKey, err = jwt.ParseRSAPrivateKeyFromPEM(pemBytes)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse JWT private key: %w", err)
+			}
+		}
+		if manager.keyID == "" {
+			manager.keyID = thumbprint(&manager.privateKey.PublicKey)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported JWT algorithm %q", config.Algorithm)
+	}
+
+	return manager, nil
+}
+
+// Issue signs an access token for the given user and returns it with its expiry.
+func (m *KeyManager) Issue(userID, email string, role Role) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(m.ttl)
+	claims := Claims{
+		Email: email,
+		Role:  role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   userID,
+			Issuer:    m.issuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+
+	var token *jwt.Token
+	var signingKey interface{}
+	switch m.algorithm {
+	case AlgorithmHS256:
+		token = jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		signingKey = m.secret
+	default:
+		token = jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		signingKey = m.privateKey
+	}
+	if m.keyID != "" {
+		token.Header["kid"] = m.keyID
+	}
+
+	signed, err := token.SignedString(signingKey)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to sign token: %w", err)
+	}
+	return signed, expiresAt, nil
+}
+
+// Verify checks a token signed by this manager and returns the caller it names.
+func (m *KeyManager) Verify(tokenString string) (Identity, error) {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{m.algorithm}),
+		jwt.WithExpirationRequired(),
+	}
+	if m.issuer != "" {
+		options = append(options, jwt.WithIssuer(m.issuer))
+	}
+
+	var claims Claims
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
+		if m.privateKey != nil {
+			return &m.privateKey.PublicKey, nil
+		}
+		return m.secret, nil
+	}, options...)
+	if err != nil {
+		return Identity{}, fmt.Errorf("invalid token: %w", err)
+	}
+	if claims.Subject == "" {
+		return Identity{}, errors.New("invalid token: missing subject")
+	}
+
+	role := claims.Role
+	if role == "" {
+		role = RoleCustomer
+	}
+
+	return Identity{
+		UserID: claims.Subject,
+		Email:  claims.Email,
+		Role:   role,
+		Token:  tokenString,
+	}, nil
+}
+
+// JWKS returns the public keys other services use to verify tokens. Symmetric
+// secrets are never published, so HS256 deployments get an empty set.
+func (m *KeyManager) JWKS() JWKS {
+	if m.privateKey == nil {
+		return JWKS{Keys: []JWK{}}
+	}
+	publicKey := m.privateKey.PublicKey
+	return JWKS{Keys: []JWK{{
+		Kty: "RSA",
+		Use: "sig",
+		Alg: AlgorithmRS256,
+		Kid: m.keyID,
+		N:   base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+	}}}
+}
+
+func readValueOrFile(value, path string) ([]byte, error) {
+	if value != "" {
+		return []byte(value), nil
+	}
+	if path == "" {
+		return nil, nil
+	}
+	return os.ReadFile(path)
+}
+
+// thumbprint derives a stable key ID from the public key (RFC 7638).
+func thumbprint(publicKey *rsa.PublicKey) string {
+	n := base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes())
+	e := base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes())
+	sum := sha256.Sum256([]byte(fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`, e, n)))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
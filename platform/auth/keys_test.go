@@ -0,0 +1,182 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func TestKeyManagerIssuesTokensItVerifies(t *testing.T) {
+	configs := map[string]KeyConfig{
+		"RS256": {Algorithm: AlgorithmRS256, KeyID: "k1", Issuer: "user-service"},
+		"HS256": {Algorithm: AlgorithmHS256, Secret: testSecret, Issuer: "user-service"},
+	}
+	for name, config := range configs {
+		t.Run(name, func(t *testing.T) {
+			keys, err := NewKeyManager(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			token, expiresAt, err := keys.Issue("user-1", "ada@example.com", RoleSupport)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if until := time.Until(expiresAt); until <= 14*time.Minute || until > 15*time.Minute {
+				t.Errorf("token expires in %s, want the default 15m", until)
+			}
+			identity, err := keys.Verify(token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := Identity{UserID: "user-1", Email: "ada@example.com", Role: RoleSupport, Token: token}
+			if identity != want {
+				t.Errorf("Verify() = %+v, want %+v", identity, want)
+			}
+
+			// Any change to the claims breaks the signature
+			parts := strings.Split(token, ".")
+			claims, _ := base64.RawURLEncoding.DecodeString(parts[1])
+			forged := strings.Replace(string(claims), `"support"`, `"admin"`, 1)
+			parts[1] = base64.RawURLEncoding.EncodeToString([]byte(forged))
+			if _, err := keys.Verify(strings.Join(parts, ".")); err == nil {
+				t.Error("Verify() accepted a token whose role was changed")
+			}
+		})
+	}
+}
+
+func TestKeyManagerRejectsTokens(t *testing.T) {
+	keys, err := NewKeyManager(KeyConfig{Algorithm: AlgorithmRS256, KeyID: "k1", Issuer: "user-service"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewKeyManager(KeyConfig{Algorithm: AlgorithmRS256, KeyID: "k1", Issuer: "user-service"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	elsewhere, err := NewKeyManager(KeyConfig{Algorithm: AlgorithmHS256, Secret: testSecret, Issuer: "someone-else"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := NewKeyManager(KeyConfig{Algorithm: AlgorithmRS256, KeyID: "k1", Issuer: "user-service"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired.privateKey = keys.privateKey
+	expired.ttl = -time.Minute
+
+	tests := map[string]*KeyManager{
+		"signed with another key": other,
+		"signed with HS256":       elsewhere,
+		"expired":                 expired,
+	}
+	for name, issuer := range tests {
+		t.Run(name, func(t *testing.T) {
+			token, _, err := issuer.Issue("user-1", "", RoleCustomer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := keys.Verify(token); err == nil {
+				t.Error("Verify() succeeded")
+			}
+		})
+	}
+}
+
+func TestNewKeyManagerRejectsBadConfig(t *testing.T) {
+	tests := map[string]KeyConfig{
+		"short secret":    {Algorithm: AlgorithmHS256, Secret: "too-short"},
+		"bad private key": {Algorithm: AlgorithmRS256, PrivateKey: "not a key"},
+		"unknown alg":     {Algorithm: "ES256"},
+	}
+	for name, config := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewKeyManager(config); err == nil {
+				t.Error("NewKeyManager() succeeded")
+			}
+		})
+	}
+}
+
+func TestKeyManagerJWKS(t *testing.T) {
+	keys, err := NewKeyManager(KeyConfig{Algorithm: AlgorithmRS256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := keys.JWKS()
+	if len(set.Keys) != 1 {
+		t.Fatalf("JWKS() has %d keys, want 1", len(set.Keys))
+	}
+	jwk := set.Keys[0]
+	if jwk.Kty != "RSA" || jwk.Use != "sig" || jwk.Alg != AlgorithmRS256 {
+		t.Errorf("JWK = %+v, want an RS256 signing key", jwk)
+	}
+	// Without a configured kid the key is named by its RFC 7638 thumbprint
+	if jwk.Kid == "" || jwk.Kid != thumbprint(&keys.privateKey.PublicKey) {
+		t.Errorf("kid = %q, want the key's thumbprint", jwk.Kid)
+	}
+	published, err := parseRSAPublicKey(jsonWebKey{Kty: jwk.Kty, Kid: jwk.Kid, N: jwk.N, E: jwk.E})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !published.Equal(&keys.privateKey.PublicKey) {
+		t.Error("the published key is not the signing key's public half")
+	}
+
+	symmetric, err := NewKeyManager(KeyConfig{Algorithm: AlgorithmHS256, Secret: testSecret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := json.Marshal(symmetric.JWKS())
+	if string(body) != `{"keys":[]}` {
+		t.Errorf("HS256 JWKS = %s, want an empty key set", body)
+	}
+}
+
+func TestVerifierFollowsKeyRotation(t *testing.T) {
+	before, err := NewKeyManager(KeyConfig{Algorithm: AlgorithmRS256, KeyID: "2024-01"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := NewKeyManager(KeyConfig{Algorithm: AlgorithmRS256, KeyID: "2024-02"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var current atomic.Pointer[KeyManager]
+	current.Store(before)
+	issuer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(current.Load().JWKS())
+	}))
+	defer issuer.Close()
+	verifier := NewVerifier(Config{JWKSURL: issuer.URL, JWKSCacheTTL: time.Hour})
+
+	old, _, err := before.Issue("user-1", "", RoleCustomer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifier.Verify(old); err != nil {
+		t.Fatalf("Verify() before the rotation error = %v", err)
+	}
+
+	// user-service rotates its key; once the refresh interval has passed, a
+	// token with the new kid makes the verifier fetch the new set
+	current.Store(after)
+	verifier.jwks.fetchedAt = time.Now().Add(-minRefreshInterval)
+	rotated, _, err := after.Issue("user-1", "", RoleCustomer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifier.Verify(rotated); err != nil {
+		t.Fatalf("Verify() with the new kid error = %v", err)
+	}
+	if _, err := verifier.Verify(old); err == nil {
+		t.Error("Verify() accepted a token signed with the retired key")
+	}
+}
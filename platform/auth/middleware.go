@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/apperrors"
+)
+
+const identityKey = "auth.identity"
+
+type contextKey struct{}
+
+type TokenVerifier interface {
+	Verify(token string) (Identity, error)
+}
+
+// Enforce authenticates the caller when a bearer token is present and applies
+// the route's rule from policy. The identity is stored on both the gin context
+// and the request context so outbound clients can forward the token.
+func Enforce(verifier TokenVerifier, policy Policy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var identity *Identity
+		if header := c.GetHeader("Authorization"); header != "" {
+			scheme, token, found := strings.Cut(header, " ")
+			if !found || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+				c.Header("WWW-Authenticate", `Bearer realm="api", error="invalid_request"`)
+				c.Error(apperrors.Unauthorized("malformed authorization header"))
+				c.Abort()
+				return
+			}
+
+			verified, err := verifier.Verify(strings.TrimSpace(token))
+			if err != nil {
+				c.Header("WWW-Authenticate", `Bearer realm="api", error="invalid_token"`)
+				c.Error(apperrors.Wrap(apperrors.ErrUnauthorized, "invalid bearer token", err))
+				c.Abort()
+				return
+			}
+			identity = &verified
+			c.Set(identityKey, verified)
+			c.Request = c.Request.WithContext(WithIdentity(c.Request.Context(), verified))
+		}
+
+		err := policy.Authorize(c.Request.Method, c.FullPath(), identity, c.Params)
+		switch {
+		case err == nil:
+			c.Next()
+		case errors.Is(err, ErrUnauthenticated):
+			c.Header("WWW-Authenticate", `Bearer realm="api"`)
+			c.Error(apperrors.Unauthorized(err.Error()))
+			c.Abort()
+		default:
+			c.Error(apperrors.Forbidden(err.Error()))
+			c.Abort()
+		}
+	}
+}
+
+// IdentityFrom returns the caller set by Enforce.
+func IdentityFrom(c *gin.Context) (Identity, bool) {
+	value, ok := c.Get(identityKey)
+	if !ok {
+		return Identity{}, false
+	}
+	identity, ok := value.(Identity)
+	return identity, ok
+}
+
+// CallerID returns the user ID of the caller set by Enforce, or "" for an
+// anonymous caller. It scopes idempotency keys to their caller.
+func CallerID(c *gin.Context) string {
+	identity, _ := IdentityFrom(c)
+	return identity.UserID
+}
+
+func WithIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, identity)
+}
+
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(contextKey{}).(Identity)
+	return identity, ok
+}
@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	ErrUnauthenticated = errors.New("authentication required")
+	ErrForbidden       = errors.New("insufficient permissions")
+	ErrUndeclaredRoute = errors.New("route has no access policy")
+)
+
+// Rule declares who may call a single route. A caller is allowed when the
+// route is public, their role is listed, or SelfParam names a path parameter
+// equal to their own user ID.
+type Rule struct {
+	Method    string
+	Path      string
+	Public    bool
+	Roles     []Role
+	SelfParam string
+}
+
+// Policy is the access table for a service, keyed by method and gin route template.
+type Policy []Rule
+
+func (p Policy) Lookup(method, path string) (Rule, bool) {
+	for _, rule := range p {
+		if rule.Method == method && rule.Path == path {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+// Authorize decides whether identity may call the route. A nil identity is an
+// anonymous caller. Routes without a rule are denied.
+func (p Policy) Authorize(method, path string, identity *Identity, params gin.Params) error {
+	rule, ok := p.Lookup(method, path)
+	if !ok {
+		return ErrUndeclaredRoute
+	}
+	if rule.Public {
+		return nil
+	}
+	if identity == nil {
+		return ErrUnauthenticated
+	}
+	for _, role := range rule.Roles {
+		if identity.Role == role {
+			return nil
+		}
+	}
+	if rule.SelfParam != "" && params.ByName(rule.SelfParam) == identity.UserID {
+		return nil
+	}
+	return ErrForbidden
+}
@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// serviceTokenMargin is how long before its expiry a service token is
+// replaced, so a request never leaves with one about to expire.
+const serviceTokenMargin = time.Minute
+
+// ServiceClients maps the client ID of each service allowed to obtain a
+// service token to its secret.
+type ServiceClients map[string]string
+
+// Authenticate reports whether secret is the one configured for clientID.
+func (c ServiceClients) Authenticate(clientID, secret string) bool {
+	want, ok := c[clientID]
+	if !ok || want == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(want), []byte(secret)) == 1
+}
+
+// ServiceClientConfig is how a service obtains its own access token from
+// user-service.
+type ServiceClientConfig struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+}
+
+// ServiceTokens obtains the calling service's own access token with its
+// client credentials and reuses it until shortly before it expires. Unlike a
+// caller's token it can always be renewed, so work that outlives a request,
+// or a restart, keeps working.
+type ServiceTokens struct {
+	config     ServiceClientConfig
+	httpClient *http.Client
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+func NewServiceTokens(config ServiceClientConfig, httpClient *http.Client) *ServiceTokens {
+	return &ServiceTokens{config: config, httpClient: httpClient}
+}
+
+// Identity returns the service's identity with a token that is valid for at
+// least a minute more.
+func (s *ServiceTokens) Identity(ctx context.Context) (Identity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if time.Until(s.expiresAt) < serviceTokenMargin {
+		token, expiresAt, err := s.fetch(ctx)
+		if err != nil {
+			return Identity{}, err
+		}
+		s.token, s.expiresAt = token, expiresAt
+	}
+	return Identity{UserID: s.config.ClientID, Role: RoleService, Token: s.token}, nil
+}
+
+func (s *ServiceTokens) fetch(ctx context.Context) (string, time.Time, error) {
+	body, err := json.Marshal(map[string]string{
+		"client_id":     s.config.ClientID,
+		"client_secret": s.config.ClientSecret,
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, s.config.TokenURL, bytes.NewReader(body))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to build service token request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := s.httpClient.Do(request)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to fetch service token: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", time.Time{}, fmt.Errorf("service token endpoint returned status code %d", response.StatusCode)
+	}
+
+	var issued struct {
+		AccessToken string    `json:"access_token"`
+		ExpiresAt   time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&issued); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to parse service token: %w", err)
+	}
+	if issued.AccessToken == "" {
+		return "", time.Time{}, fmt.Errorf("service token endpoint returned no token")
+	}
+	return issued.AccessToken, issued.ExpiresAt, nil
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestServiceTokensRenewBeforeExpiry(t *testing.T) {
+	var fetches atomic.Int32
+	lifetime := time.Hour
+	issuer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var credentials struct {
+			ClientID     string `json:"client_id"`
+			ClientSecret string `json:"client_secret"`
+		}
+		json.NewDecoder(r.Body).Decode(&credentials)
+		if !(ServiceClients{"order-service": "s3cret"}).Authenticate(credentials.ClientID, credentials.ClientSecret) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		n := fetches.Add(1)
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "token-" + string(rune('0'+n)),
+			"expires_at":   time.Now().Add(lifetime),
+		})
+	}))
+	defer issuer.Close()
+
+	tokens := NewServiceTokens(ServiceClientConfig{TokenURL: issuer.URL, ClientID: "order-service", ClientSecret: "s3cret"}, issuer.Client())
+	for range 3 {
+		identity, err := tokens.Identity(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if identity.Token != "token-1" || identity.Role != RoleService || identity.UserID != "order-service" {
+			t.Fatalf("Identity() = %+v, want the first token for order-service as service", identity)
+		}
+	}
+
+	// A token within the renewal margin of its expiry is replaced
+	lifetime = 30 * time.Second
+	tokens.expiresAt = time.Now().Add(30 * time.Second)
+	identity, err := tokens.Identity(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Token != "token-2" {
+		t.Errorf("token = %q, want a renewed one", identity.Token)
+	}
+	if got := fetches.Load(); got != 2 {
+		t.Errorf("fetched %d tokens, want 2", got)
+	}
+
+	wrong := NewServiceTokens(ServiceClientConfig{TokenURL: issuer.URL, ClientID: "order-service", ClientSecret: "guess"}, issuer.Client())
+	if _, err := wrong.Identity(context.Background()); err == nil {
+		t.Error("Identity() with a wrong secret succeeded")
+	}
+}
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Verifier validates access tokens issued by user-service. RS256 tokens are
+// checked against the JWKS; HS256 tokens only when a shared secret is configured.
+type Verifier struct {
+	jwks   *JWKSCache
+	secret []byte
+	issuer string
+}
+
+func NewVerifier(config Config) *Verifier {
+	return &Verifier{
+		jwks:   NewJWKSCache(config.JWKSURL, config.JWKSCacheTTL),
+		secret: []byte(config.Secret),
+		issuer: config.Issuer,
+	}
+}
+
+func (v *Verifier) Verify(tokenString string) (Identity, error) {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"RS256", "HS256"}),
+		jwt.WithExpirationRequired(),
+	}
+	if v.issuer != "" {
+		options = append(options, jwt.WithIssuer(v.issuer))
+	}
+
+	var claims Claims
+	_, err := jwt.ParseWithClaims(tokenString, &claims, v.keyFunc, options...)
+	if err != nil {
+		return Identity{}, fmt.Errorf("invalid token: %w", err)
+	}
+	if claims.Subject == "" {
+		return Identity{}, errors.New("invalid token: missing subject")
+	}
+
+	role := claims.Role
+	if role == "" {
+		role = RoleCustomer
+	}
+
+	return Identity{
+		UserID: claims.Subject,
+		Email:  claims.Email,
+		Role:   role,
+		Token:  tokenString,
+	}, nil
+}
+
+func (v *Verifier) keyFunc(token *jwt.Token) (interface{}, error) {
+	switch token.Method.Alg() {
+	case "HS256":
+		if len(v.secret) == 0 {
+			return nil, errors.New("HS256 tokens are not accepted")
+		}
+		return v.secret, nil
+	default:
+		kid, _ := token.Header["kid"].(string)
+		return v.jwks.Key(kid)
+	}
+}
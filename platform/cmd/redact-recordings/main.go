@@ -0,0 +1,71 @@
+// Command redact-recordings masks secrets in Keploy recordings before they are
+// committed. It rewrites every .yaml file under the given directories in place
+// using the same REDACT_* settings as the services.
+//
+//	go run ./platform/cmd/redact-recordings [-check] DIR...
+//
+// With -check it only lists files that still contain secrets and exits with
+// status 1 if there are any, which suits CI.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/config"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/redact"
+)
+
+func main() {
+	check := flag.Bool("check", false, "report files containing secrets without rewriting them")
+	flag.Parse()
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: redact-recordings [-check] DIR...")
+		os.Exit(2)
+	}
+
+	env := config.FromEnv()
+	redactor := redact.New(redact.ConfigFromEnv(env))
+	if err := env.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration: %v\n", err)
+		os.Exit(2)
+	}
+
+	dirty := 0
+	for _, dir := range flag.Args() {
+		err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil || entry.IsDir() || filepath.Ext(path) != ".yaml" {
+				return err
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			redacted, changed, err := redactor.Recording(data)
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			if !changed {
+				return nil
+			}
+
+			dirty++
+			if *check {
+				fmt.Printf("%s contains secrets\n", path)
+				return nil
+			}
+			fmt.Printf("Redacted %s\n", path)
+			return os.WriteFile(path, redacted, entry.Type().Perm()|0o644)
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if *check && dirty > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,94 @@
+// Package config loads typed service settings from environment variables.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Env reads settings from the environment. Unset or empty variables fall back
+// to their defaults; malformed values are collected so a service can report
+// every bad setting at once through Err.
+type Env struct {
+	lookup func(string) (string, bool)
+	errs   []error
+}
+
+// FromEnv reads settings from the process environment.
+func FromEnv() *Env {
+	return &Env{lookup: os.LookupEnv}
+}
+
+// FromMap reads settings from values, which is handy in tests and tools.
+func FromMap(values map[string]string) *Env {
+	return &Env{lookup: func(key string) (string, bool) {
+		value, ok := values[key]
+		return value, ok
+	}}
+}
+
+func (e *Env) raw(key string) string {
+	value, _ := e.lookup(key)
+	return value
+}
+
+// String returns the variable, or defaultValue when it is unset or empty.
+func (e *Env) String(key, defaultValue string) string {
+	if value := e.raw(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func (e *Env) Int(key string, defaultValue int) int {
+	valueStr := e.raw(key)
+	if valueStr == "" {
+		return defaultValue
+	}
+	value, err := strconv.Atoi(valueStr)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s must be an integer, got %q", key, valueStr))
+		return defaultValue
+	}
+	return value
+}
+
+func (e *Env) Bool(key string, defaultValue bool) bool {
+	valueStr := e.raw(key)
+	if valueStr == "" {
+		return defaultValue
+	}
+	value, err := strconv.ParseBool(valueStr)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s must be a boolean, got %q", key, valueStr))
+		return defaultValue
+	}
+	return value
+}
+
+func (e *Env) Duration(key string, defaultValue time.Duration) time.Duration {
+	valueStr := e.raw(key)
+	if valueStr == "" {
+		return defaultValue
+	}
+	value, err := time.ParseDuration(valueStr)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s must be a duration such as 30s, got %q", key, valueStr))
+		return defaultValue
+	}
+	return value
+}
+
+// Errorf records a malformed setting for packages that parse their own types,
+// so it is reported through Err with the rest.
+func (e *Env) Errorf(format string, args ...any) {
+	e.errs = append(e.errs, fmt.Errorf(format, args...))
+}
+
+// Err reports every malformed variable read so far.
+func (e *Env) Err() error {
+	return errors.Join(e.errs...)
+}
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/logging"
+)
+
+const migrateUsage = "usage: migrate up | down [steps] | status"
+
+// RunMigrateCommand implements the "migrate" subcommand of a service binary.
+func RunMigrateCommand(ctx context.Context, migrator *Migrator, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Applied %d migration(s), schema is at version %d\n", applied, migrator.Latest())
+		return nil
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			var err error
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+		}
+		rolledBack, err := migrator.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Rolled back %d migration(s)\n", rolledBack)
+		return nil
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		writer := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(writer, "%d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+		writer.Flush()
+		return err
+	default:
+		return errors.New(migrateUsage)
+	}
+}
+
+// EnsureSchema prepares the database before the server starts. It refuses to
+// run against a schema newer than the binary, applies pending migrations when
+// autoMigrate is set and otherwise requires the schema to be up to date.
+func EnsureSchema(ctx context.Context, migrator *Migrator, autoMigrate bool) error {
+	if autoMigrate {
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		if applied > 0 {
+			logging.For("database").InfoContext(ctx, "Applied migrations", "count", applied, "version", migrator.Latest())
+		}
+		return nil
+	}
+
+	pending, err := migrator.Pending(ctx)
+	if err != nil {
+		return err
+	}
+	if pending > 0 {
+		return fmt.Errorf("%d migration(s) pending, run \"migrate up\" first", pending)
+	}
+	return nil
+}
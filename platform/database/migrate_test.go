@@ -0,0 +1,198 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func migrationFiles(names ...string) fstest.MapFS {
+	files := fstest.MapFS{}
+	for _, name := range names {
+		files[name] = &fstest.MapFile{Data: []byte("-- " + name)}
+	}
+	return files
+}
+
+func TestNewMigrator(t *testing.T) {
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+		// want lists the loaded migrations as version_name, or is empty when
+		// loading fails with an error containing wantErr
+		want    []string
+		wantErr string
+	}{
+		{"ordered by version", migrationFiles(
+			"0010_add_index.up.sql", "0010_add_index.down.sql",
+			"0002_add_role.up.sql", "0002_add_role.down.sql",
+			"0001_create_users.up.sql", "0001_create_users.down.sql",
+		), []string{"1_create_users", "2_add_role", "10_add_index"}, ""},
+		{"empty", fstest.MapFS{}, nil, ""},
+		{"directories are skipped", fstest.MapFS{
+			"0001_create_users.up.sql":   {Data: []byte("-- up")},
+			"0001_create_users.down.sql": {Data: []byte("-- down")},
+			"fixtures/users.sql":         {Data: []byte("-- fixture")},
+		}, []string{"1_create_users"}, ""},
+		{"missing down script", migrationFiles("0001_create_users.up.sql"), nil, "must have both up and down scripts"},
+		{"missing up script", migrationFiles("0001_create_users.down.sql"), nil, "must have both up and down scripts"},
+		{"conflicting names", migrationFiles("0001_create_users.up.sql", "0001_create_accounts.down.sql"), nil, "conflicting names"},
+		{"no version", migrationFiles("create_users.up.sql"), nil, "unexpected migration file name"},
+		{"no direction", migrationFiles("0001_create_users.sql"), nil, "unexpected migration file name"},
+		{"capitalised name", migrationFiles("0001_CreateUsers.up.sql"), nil, "unexpected migration file name"},
+		{"stray file", migrationFiles("0001_create_users.up.sql", "0001_create_users.down.sql", "README.md"), nil, "unexpected migration file name"},
+		{"version overflow", migrationFiles("99999999999999999999_huge.up.sql"), nil, "invalid migration version"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrator, err := NewMigrator(nil, tt.files)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("NewMigrator() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewMigrator() error = %v", err)
+			}
+			var got []string
+			for _, migration := range migrator.migrations {
+				got = append(got, fmt.Sprintf("%d_%s", migration.Version, migration.Name))
+				if migration.Up == "" || migration.Down == "" {
+					t.Errorf("migration %d has empty scripts", migration.Version)
+				}
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("migrations = %v, want %v", got, tt.want)
+			}
+			if len(tt.want) > 0 && migrator.Latest() != migrator.migrations[len(migrator.migrations)-1].Version {
+				t.Errorf("Latest() = %d, want the highest version", migrator.Latest())
+			}
+		})
+	}
+}
+
+func TestCheckKnown(t *testing.T) {
+	migrator, err := NewMigrator(nil, migrationFiles("0001_create_users.up.sql", "0001_create_users.down.sql", "0002_add_role.up.sql", "0002_add_role.down.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if err := migrator.checkKnown(map[int64]time.Time{1: now}); err != nil {
+		t.Errorf("checkKnown() behind the binary error = %v", err)
+	}
+	if err := migrator.checkKnown(map[int64]time.Time{1: now, 2: now}); err != nil {
+		t.Errorf("checkKnown() level with the binary error = %v", err)
+	}
+	// Version 3 was applied by a newer release
+	if err := migrator.checkKnown(map[int64]time.Time{1: now, 2: now, 3: now}); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("checkKnown() ahead of the binary error = %v, want %v", err, ErrSchemaTooNew)
+	}
+}
+
+// TestMigratorAgainstPostgres runs migrations up, down and up again in a
+// throwaway schema of the database at TEST_DATABASE_URL, a postgres:// URL.
+func TestMigratorAgainstPostgres(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	ctx := context.Background()
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer admin.Close()
+	schema := fmt.Sprintf("migrate_test_%d", time.Now().UnixNano())
+	if _, err := admin.ExecContext(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatal(err)
+	}
+	defer admin.ExecContext(context.Background(), "DROP SCHEMA "+schema+" CASCADE")
+
+	scoped, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := scoped.Query()
+	query.Set("search_path", schema)
+	scoped.RawQuery = query.Encode()
+	db, err := sql.Open("postgres", scoped.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	files := fstest.MapFS{
+		"0001_create_widgets.up.sql":   {Data: []byte("CREATE TABLE widgets (id TEXT PRIMARY KEY);")},
+		"0001_create_widgets.down.sql": {Data: []byte("DROP TABLE widgets;")},
+		"0002_add_color.up.sql":        {Data: []byte("ALTER TABLE widgets ADD COLUMN color TEXT NOT NULL DEFAULT 'red';")},
+		"0002_add_color.down.sql":      {Data: []byte("ALTER TABLE widgets DROP COLUMN color;")},
+	}
+	migrator, err := NewMigrator(db, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	step := func(name string, run func() (int, error), wantRan, wantPending int) {
+		t.Helper()
+		ran, err := run()
+		if err != nil {
+			t.Fatalf("%s error = %v", name, err)
+		}
+		pending, err := migrator.Pending(ctx)
+		if err != nil {
+			t.Fatalf("Pending() after %s error = %v", name, err)
+		}
+		if ran != wantRan || pending != wantPending {
+			t.Errorf("%s ran %d with %d pending, want %d with %d pending", name, ran, pending, wantRan, wantPending)
+		}
+	}
+
+	step("Up()", func() (int, error) { return migrator.Up(ctx) }, 2, 0)
+	if _, err := db.ExecContext(ctx, "INSERT INTO widgets (id) VALUES ('w-1')"); err != nil {
+		t.Fatalf("schema after Up() is not usable: %v", err)
+	}
+	step("Up() again", func() (int, error) { return migrator.Up(ctx) }, 0, 0)
+	step("Down(1)", func() (int, error) { return migrator.Down(ctx, 1) }, 1, 1)
+	if _, err := db.ExecContext(ctx, "SELECT color FROM widgets"); err == nil {
+		t.Error("color column survived Down(1)")
+	}
+	step("re-Up()", func() (int, error) { return migrator.Up(ctx) }, 1, 0)
+
+	older, err := NewMigrator(db, fstest.MapFS{
+		"0001_create_widgets.up.sql":   files["0001_create_widgets.up.sql"],
+		"0001_create_widgets.down.sql": files["0001_create_widgets.down.sql"],
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := older.Up(ctx); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("Up() by an older binary error = %v, want %v", err, ErrSchemaTooNew)
+	}
+
+	failing, err := NewMigrator(db, fstest.MapFS{
+		"0001_create_widgets.up.sql":   files["0001_create_widgets.up.sql"],
+		"0001_create_widgets.down.sql": files["0001_create_widgets.down.sql"],
+		"0002_add_color.up.sql":        files["0002_add_color.up.sql"],
+		"0002_add_color.down.sql":      files["0002_add_color.down.sql"],
+		"0003_broken.up.sql":           {Data: []byte("CREATE TABLE gadgets (id TEXT); SELECT * FROM missing_table;")},
+		"0003_broken.down.sql":         {Data: []byte("DROP TABLE gadgets;")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := failing.Up(ctx); err == nil {
+		t.Fatal("Up() with a broken migration succeeded")
+	}
+	// The failed script's transaction took its partial changes with it
+	if _, err := db.ExecContext(ctx, "SELECT * FROM gadgets"); err == nil {
+		t.Error("a failed migration left its table behind")
+	}
+	step("Down(2)", func() (int, error) { return migrator.Down(ctx, 2) }, 2, 2)
+}
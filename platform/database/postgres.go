@@ -0,0 +1,109 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/XSAM/otelsql"
+	_ "github.com/lib/pq"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/config"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/logging"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+type Config struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	DBName   string
+	SSLMode  string
+
+	AutoMigrate     bool
+	ConnectAttempts int
+	RetryInterval   time.Duration
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// ConfigFromEnv reads the DB_* variables. defaultName is the database used
+// when DB_NAME is unset, normally the service's own.
+func ConfigFromEnv(env *config.Env, defaultName string) Config {
+	return Config{
+		Host:     env.String("DB_HOST", "localhost"),
+		Port:     env.Int("DB_PORT", 5432),
+		User:     env.String("DB_USER", "postgres"),
+		Password: env.String("DB_PASSWORD", "password"),
+		DBName:   env.String("DB_NAME", defaultName),
+		SSLMode:  env.String("DB_SSL_MODE", "disable"),
+
+		AutoMigrate:     env.Bool("DB_AUTO_MIGRATE", true),
+		ConnectAttempts: env.Int("DB_CONNECT_ATTEMPTS", 30),
+		RetryInterval:   env.Duration("DB_CONNECT_RETRY_INTERVAL", 5*time.Second),
+		MaxOpenConns:    env.Int("DB_MAX_OPEN_CONNS", 25),
+		MaxIdleConns:    env.Int("DB_MAX_IDLE_CONNS", 25),
+		ConnMaxLifetime: env.Duration("DB_CONN_MAX_LIFETIME", 5*time.Minute),
+	}
+}
+
+// spanOptions keeps one span per statement and drops the per-connection
+// bookkeeping spans that would otherwise drown them out.
+var spanOptions = otelsql.SpanOptions{
+	OmitConnResetSession: true,
+	OmitConnPrepare:      true,
+	OmitRows:             true,
+	OmitConnectorConnect: true,
+}
+
+// Open opens a pool on driverName that records a span for each statement.
+// NewPostgresDB uses it for Postgres; tests use it to trace a stand-in driver.
+func Open(driverName, dsn, dbName string) (*sql.DB, error) {
+	return otelsql.Open(driverName, dsn,
+		otelsql.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBNamespace(dbName)),
+		otelsql.WithSpanOptions(spanOptions),
+	)
+}
+
+// NewPostgresDB opens a connection pool, retrying until the database accepts
+// connections or ConnectAttempts is exhausted.
+func NewPostgresDB(config Config) (*sql.DB, error) {
+	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		config.Host, config.Port, config.User, config.Password, config.DBName, config.SSLMode)
+
+	attempts := config.ConnectAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	logger := logging.For("database")
+	var db *sql.DB
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		logger.Info("Connecting to database", "host", config.Host, "database", config.DBName, "attempt", attempt, "attempts", attempts)
+		db, err = Open("postgres", dsn, config.DBName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open database connection: %w", err)
+		}
+
+		err = db.Ping()
+		if err == nil {
+			logger.Info("Connected to database", "database", config.DBName)
+			break
+		}
+		db.Close()
+		if attempt < attempts {
+			logger.Warn("Failed to ping database, retrying", "error", err, "retry_in", config.RetryInterval.String())
+			time.Sleep(config.RetryInterval)
+		}
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database after %d attempts: %w", attempts, err)
+	}
+	db.SetMaxOpenConns(config.MaxOpenConns)
+	db.SetMaxIdleConns(config.MaxIdleConns)
+	db.SetConnMaxLifetime(config.ConnMaxLifetime)
+	return db, nil
+}
@@ -0,0 +1,183 @@
+// Package health serves liveness and readiness probes.
+package health
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/logging"
+)
+
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+
+	defaultTimeout  = 2 * time.Second
+	defaultCacheTTL = 5 * time.Second
+)
+
+// Check reports whether a dependency is usable. It must honour ctx.
+type Check func(ctx context.Context) error
+
+// Options tune a single check. Zero values use a 2s timeout and a 5s cache.
+type Options struct {
+	Timeout  time.Duration
+	CacheTTL time.Duration
+}
+
+// Result is one dependency's entry in the readiness report. /readyz is public,
+// so why a check failed is logged rather than reported.
+type Result struct {
+	Status     string    `json:"status"`
+	DurationMS int64     `json:"duration_ms"`
+	CheckedAt  time.Time `json:"checked_at"`
+}
+
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+type check struct {
+	name    string
+	run     Check
+	options Options
+
+	// mu serialises runs so concurrent probes share one result instead of
+	// stampeding the dependency.
+	mu     sync.Mutex
+	last   Result
+	hasRun bool
+}
+
+// Checker aggregates dependency checks for the readiness probe.
+type Checker struct {
+	checks []*check
+}
+
+func NewChecker() *Checker {
+	return &Checker{}
+}
+
+// Add registers a readiness check under name.
+func (h *Checker) Add(name string, run Check, options Options) {
+	if options.Timeout <= 0 {
+		options.Timeout = defaultTimeout
+	}
+	if options.CacheTTL <= 0 {
+		options.CacheTTL = defaultCacheTTL
+	}
+	h.checks = append(h.checks, &check{name: name, run: run, options: options})
+}
+
+// RegisterRoutes mounts /healthz and /readyz. Both are public and sit outside
+// any route policy.
+func (h *Checker) RegisterRoutes(router *gin.Engine) {
+	router.GET("/healthz", h.Liveness)
+	router.GET("/readyz", h.Readiness)
+}
+
+// Liveness reports that the process is up and serving requests. It never
+// touches dependencies, so a failing database does not get the service killed.
+func (h *Checker) Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": StatusOK})
+}
+
+// Readiness runs every check concurrently and answers 503 if any fails.
+func (h *Checker) Readiness(c *gin.Context) {
+	report := h.Check(c.Request.Context())
+	status := http.StatusOK
+	if report.Status != StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(status, report)
+}
+
+// Check runs all checks, reusing results younger than their cache TTL.
+func (h *Checker) Check(ctx context.Context) Report {
+	results := make([]Result, len(h.checks))
+	var wg sync.WaitGroup
+	for i, dependency := range h.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = dependency.result(ctx)
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(h.checks))}
+	for i, dependency := range h.checks {
+		report.Checks[dependency.name] = results[i]
+		if results[i].Status != StatusOK {
+			report.Status = StatusUnavailable
+		}
+	}
+	return report
+}
+
+func (c *check) result(ctx context.Context) Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.hasRun && time.Since(c.last.CheckedAt) < c.options.CacheTTL {
+		return c.last
+	}
+
+	// The result is shared with other probes, so it must not depend on this
+	// caller hanging up early
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.options.Timeout)
+	defer cancel()
+
+	started := time.Now()
+	err := c.run(ctx)
+	result := Result{
+		Status:     StatusOK,
+		DurationMS: time.Since(started).Milliseconds(),
+		CheckedAt:  started,
+	}
+	if err != nil {
+		result.Status = StatusUnavailable
+		logging.For("health").WarnContext(ctx, "Readiness check failed",
+			"check", c.name,
+			"error", err,
+			"duration_ms", result.DurationMS,
+		)
+	}
+	c.last = result
+	c.hasRun = true
+	return result
+}
+
+// Database pings the connection pool.
+func Database(db *sql.DB) Check {
+	return func(ctx context.Context) error {
+		return db.PingContext(ctx)
+	}
+}
+
+// HTTP requests url with GET and treats any response below 500 as healthy.
+// Use it for downstream services' liveness endpoints or to confirm a remote
+// API is reachable without credentials.
+func HTTP(client *http.Client, url string) Check {
+	return func(ctx context.Context) error {
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		response, err := client.Do(request)
+		if err != nil {
+			return err
+		}
+		defer response.Body.Close()
+		if response.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("%s returned status %d", url, response.StatusCode)
+		}
+		return nil
+	}
+}
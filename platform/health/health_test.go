@@ -0,0 +1,46 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestReadinessHidesCheckErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	checker := NewChecker()
+	checker.Add("database", func(ctx context.Context) error { return nil }, Options{})
+	checker.Add("user-service", func(ctx context.Context) error {
+		return errors.New(`Get "http://user-service:8080/healthz": dial tcp 10.0.0.7:8080: connection refused`)
+	}, Options{})
+	router := gin.New()
+	checker.RegisterRoutes(router)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusServiceUnavailable)
+	}
+	var report Report
+	if err := json.Unmarshal(recorder.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if got := report.Checks["database"].Status; got != StatusOK {
+		t.Errorf("database status = %q, want %q", got, StatusOK)
+	}
+	if got := report.Checks["user-service"].Status; got != StatusUnavailable {
+		t.Errorf("user-service status = %q, want %q", got, StatusUnavailable)
+	}
+	for _, detail := range []string{"10.0.0.7", "connection refused", "user-service:8080"} {
+		if strings.Contains(recorder.Body.String(), detail) {
+			t.Errorf("readiness report leaks %q: %s", detail, recorder.Body.String())
+		}
+	}
+}
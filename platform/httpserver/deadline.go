@@ -0,0 +1,35 @@
+package httpserver
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+func routeKey(method, path string) string {
+	return strings.ToUpper(method) + " " + path
+}
+
+// Deadline bounds each request's context by its route timeout, falling back to
+// config.RequestTimeout. Database queries and outbound calls made with the
+// request context stop at the deadline, and the net/http server already
+// cancels the context when the client disconnects, so abandoned requests stop
+// downstream work as well.
+func Deadline(config Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		timeout, ok := config.RouteTimeouts[routeKey(c.Request.Method, c.FullPath())]
+		if !ok {
+			timeout = config.RequestTimeout
+		}
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
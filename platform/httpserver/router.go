@@ -0,0 +1,28 @@
+// Package httpserver builds the gin router and HTTP server shared by every
+// service.
+package httpserver
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/apperrors"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/logging"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/metrics"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/requestid"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/tracing"
+)
+
+// NewRouter returns a gin engine with the standard middleware chain, from
+// tracing through to problem+json errors. Unknown routes answer with a 404
+// problem.
+func NewRouter(config Config, m *metrics.Metrics) *gin.Engine {
+	router := gin.New()
+	router.Use(tracing.Middleware(config.Name))
+	router.Use(requestid.Middleware())
+	router.Use(Deadline(config))
+	router.Use(m.Middleware())
+	router.Use(logging.Middleware())
+	router.Use(apperrors.Middleware())
+	router.Use(apperrors.Recovery())
+	router.NoRoute(apperrors.NoRoute())
+	return router
+}
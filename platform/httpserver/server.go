@@ -0,0 +1,72 @@
+package httpserver
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/config"
+)
+
+type Config struct {
+	// Name identifies the service in logs and telemetry.
+	Name              string
+	Port              string
+	ReadHeaderTimeout time.Duration
+	IdleTimeout       time.Duration
+	// RequestTimeout is the deadline given to each request's context. Zero
+	// means no deadline.
+	RequestTimeout time.Duration
+	// RouteTimeouts overrides RequestTimeout per route, keyed by method and
+	// gin route template, e.g. "POST /api/orders".
+	RouteTimeouts map[string]time.Duration
+}
+
+// ConfigFromEnv reads PORT, falling back to defaultPort, the HTTP_* timeouts
+// and HTTP_ROUTE_TIMEOUTS, a comma separated list such as
+// "POST /api/orders=5s,GET /api/orders=2s".
+func ConfigFromEnv(env *config.Env, name, defaultPort string) Config {
+	return Config{
+		Name:              name,
+		Port:              env.String("PORT", defaultPort),
+		ReadHeaderTimeout: env.Duration("HTTP_READ_HEADER_TIMEOUT", 10*time.Second),
+		IdleTimeout:       env.Duration("HTTP_IDLE_TIMEOUT", 2*time.Minute),
+		RequestTimeout:    env.Duration("HTTP_REQUEST_TIMEOUT", 10*time.Second),
+		RouteTimeouts:     routeTimeoutsFromEnv(env),
+	}
+}
+
+func routeTimeoutsFromEnv(env *config.Env) map[string]time.Duration {
+	timeouts := make(map[string]time.Duration)
+	for _, entry := range strings.Split(env.String("HTTP_ROUTE_TIMEOUTS", ""), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		route, value, found := strings.Cut(entry, "=")
+		method, path, hasPath := strings.Cut(strings.TrimSpace(route), " ")
+		if !found || !hasPath {
+			env.Errorf("HTTP_ROUTE_TIMEOUTS entries must look like \"METHOD /path=duration\", got %q", entry)
+			continue
+		}
+		timeout, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			env.Errorf("HTTP_ROUTE_TIMEOUTS timeout for %q must be a duration such as 5s, got %q", route, value)
+			continue
+		}
+		timeouts[routeKey(method, strings.TrimSpace(path))] = timeout
+	}
+	return timeouts
+}
+
+// New returns a server for handler on the configured port. Run it with
+// lifecycle.Run so it shuts down gracefully.
+func New(config Config, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              fmt.Sprintf(":%s", config.Port),
+		Handler:           handler,
+		ReadHeaderTimeout: config.ReadHeaderTimeout,
+		IdleTimeout:       config.IdleTimeout,
+	}
+}
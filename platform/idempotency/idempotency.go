@@ -0,0 +1,276 @@
+// Package idempotency makes create routes safe to retry. A request carrying an
+// Idempotency-Key header runs once per key and caller; retries get the stored
+// response back instead of creating a second resource.
+//
+// Each service stores keys in its own database, in a table created by its
+// migrations:
+//
+//	CREATE TABLE idempotency_keys (
+//	    key VARCHAR(255) NOT NULL,
+//	    caller VARCHAR(255) NOT NULL,
+//	    fingerprint CHAR(64) NOT NULL,
+//	    status_code INT NOT NULL,
+//	    content_type VARCHAR(255) NOT NULL,
+//	    response_body BYTEA,
+//	    created_at TIMESTAMP NOT NULL,
+//	    claim_token VARCHAR(36) NOT NULL DEFAULT '',
+//	    PRIMARY KEY (key, caller)
+//	);
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/apperrors"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/config"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/logging"
+)
+
+const (
+	Header = "Idempotency-Key"
+	// ReplayedHeader is set to "true" on responses replayed from a stored one.
+	ReplayedHeader = "Idempotent-Replayed"
+	maxKeyLength   = 255
+)
+
+type Config struct {
+	// TTL is how long a key is remembered. A key older than this starts over
+	// as if it had never been used.
+	TTL time.Duration
+	// Lease is how long a key stays claimed by a request that has not
+	// finished. A claim older than this was abandoned, by a crash for
+	// example, and the next request with the key runs again. It must exceed
+	// the longest request deadline.
+	Lease time.Duration
+}
+
+// ConfigFromEnv reads IDEMPOTENCY_KEY_TTL and IDEMPOTENCY_KEY_LEASE.
+func ConfigFromEnv(env *config.Env) Config {
+	return Config{
+		TTL:   env.Duration("IDEMPOTENCY_KEY_TTL", 24*time.Hour),
+		Lease: env.Duration("IDEMPOTENCY_KEY_LEASE", 5*time.Minute),
+	}
+}
+
+// CallerFunc names the caller a key belongs to, normally the authenticated
+// user's ID, so two callers can use the same key without seeing each other's
+// responses.
+type CallerFunc func(c *gin.Context) string
+
+// Store keeps idempotency keys and their responses in the idempotency_keys
+// table.
+type Store struct {
+	db     *sql.DB
+	config Config
+}
+
+func NewStore(db *sql.DB, config Config) *Store {
+	return &Store{db: db, config: config}
+}
+
+type ctxKey struct{}
+
+// WithKey stores a request's scoped idempotency key on ctx.
+func WithKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, key)
+}
+
+// FromContext returns the idempotency key of the current request, scoped to
+// its caller, or "" when the request has none. It is safe to pass on to
+// payment providers as their own idempotency key.
+func FromContext(ctx context.Context) string {
+	key, _ := ctx.Value(ctxKey{}).(string)
+	return key
+}
+
+// Middleware runs the route at most once per Idempotency-Key and caller.
+// Requests without the header are passed through.
+//
+// The first request claims the key in a short transaction and runs the
+// handler without holding a lock or a connection; a duplicate sent while it
+// runs is rejected with 409 and may be retried. Only final successful
+// responses are stored. After an error, or a 202 Accepted for work that is
+// still going on, the key is released and a retry runs the handler again. A
+// key reused with a different method, path or body is rejected with 422.
+func (s *Store) Middleware(caller CallerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(Header)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxKeyLength {
+			c.Error(apperrors.Validation(fmt.Sprintf("%s must be at most %d characters", Header, maxKeyLength)))
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.Error(apperrors.Wrap(apperrors.ErrValidation, "failed to read request body", err))
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		if err := s.run(c, key, caller(c), fingerprint(c, body)); err != nil {
+			c.Error(err)
+			c.Abort()
+		}
+	}
+}
+
+// run claims the key and either replays the stored response or runs the
+// handler and then stores what it wrote or releases the key.
+func (s *Store) run(c *gin.Context, key, caller, fingerprint string) error {
+	ctx := c.Request.Context()
+	log := logging.For("idempotency")
+
+	token, stored, err := s.claim(ctx, key, caller, fingerprint)
+	if err != nil {
+		return err
+	}
+	if token == "" {
+		log.InfoContext(ctx, "Replaying stored response", "status", stored.statusCode)
+		c.Header(ReplayedHeader, "true")
+		c.Data(stored.statusCode, stored.contentType, stored.body)
+		c.Abort()
+		return nil
+	}
+
+	recorder := &responseRecorder{ResponseWriter: c.Writer}
+	c.Writer = recorder
+	c.Request = c.Request.WithContext(WithKey(ctx, scopedKey(key, caller)))
+	c.Next()
+
+	// The outcome is recorded even when the client has gone away, so that a
+	// response the handler did produce is replayed to the retry
+	ctx = context.WithoutCancel(ctx)
+	status := c.Writer.Status()
+	if len(c.Errors) > 0 || status < 200 || status >= 300 || status == http.StatusAccepted {
+		release := `DELETE FROM idempotency_keys
+				    WHERE key = $1 AND caller = $2 AND claim_token = $3 AND status_code = 0`
+		if _, err := s.db.ExecContext(ctx, release, key, caller, token); err != nil {
+			log.ErrorContext(ctx, "Failed to release idempotency key", "error", err)
+		}
+		return nil
+	}
+	finish := `UPDATE idempotency_keys SET status_code = $1, content_type = $2, response_body = $3
+			   WHERE key = $4 AND caller = $5 AND claim_token = $6`
+	if _, err := s.db.ExecContext(ctx, finish, status, c.Writer.Header().Get("Content-Type"), recorder.body.Bytes(), key, caller, token); err != nil {
+		log.ErrorContext(ctx, "Failed to store idempotent response", "error", err)
+	}
+	return nil
+}
+
+type storedResponse struct {
+	fingerprint string
+	statusCode  int
+	contentType string
+	body        []byte
+}
+
+// claim takes the key for this request in its own short transaction and
+// returns the claim's token, or the stored response to replay when the token
+// is empty. A key whose response has expired, or whose claim was abandoned, is
+// taken over like a new one.
+func (s *Store) claim(ctx context.Context, key, caller, fingerprint string) (string, storedResponse, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", storedResponse{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	token := uuid.New().String()
+	// A concurrent insert of the same key waits here only until the other
+	// request's claim commits
+	insert := `INSERT INTO idempotency_keys (key, caller, fingerprint, status_code, content_type, created_at, claim_token)
+			   VALUES ($1, $2, $3, 0, '', $4, $5)
+			   ON CONFLICT (key, caller) DO NOTHING`
+	result, err := tx.ExecContext(ctx, insert, key, caller, fingerprint, now, token)
+	if err != nil {
+		return "", storedResponse{}, err
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return "", storedResponse{}, err
+	}
+	if inserted == 1 {
+		return token, storedResponse{}, tx.Commit()
+	}
+
+	var stored storedResponse
+	var createdAt time.Time
+	query := `SELECT fingerprint, status_code, content_type, response_body, created_at
+			  FROM idempotency_keys
+			  WHERE key = $1 AND caller = $2
+			  FOR UPDATE`
+	err = tx.QueryRowContext(ctx, query, key, caller).Scan(&stored.fingerprint, &stored.statusCode, &stored.contentType, &stored.body, &createdAt)
+	if err != nil {
+		return "", storedResponse{}, err
+	}
+	age := now.Sub(createdAt)
+	inProgress := stored.statusCode == 0
+	if inProgress && age <= s.config.Lease || !inProgress && age <= s.config.TTL {
+		if stored.fingerprint != fingerprint {
+			return "", storedResponse{}, apperrors.New(apperrors.ErrUnprocessable, fmt.Sprintf("%s was already used with a different request", Header))
+		}
+		if inProgress {
+			return "", storedResponse{}, apperrors.Conflict(fmt.Sprintf("a request with this %s is still in progress", Header))
+		}
+		return "", stored, tx.Commit()
+	}
+
+	takeOver := `UPDATE idempotency_keys
+				 SET fingerprint = $1, status_code = 0, content_type = '', response_body = NULL, created_at = $2, claim_token = $3
+				 WHERE key = $4 AND caller = $5`
+	if _, err := tx.ExecContext(ctx, takeOver, fingerprint, now, token, key, caller); err != nil {
+		return "", storedResponse{}, err
+	}
+	return token, storedResponse{}, tx.Commit()
+}
+
+// fingerprint identifies a request by method, path and body, so a key cannot
+// be replayed against a different request. The path is the one requested,
+// not the route template, so a key used to check out one order cannot answer
+// for another.
+func fingerprint(c *gin.Context, body []byte) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s %s\n", c.Request.Method, c.Request.URL.Path)
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// scopedKey combines key and caller into a key that is unique across callers.
+func scopedKey(key, caller string) string {
+	hash := sha256.Sum256([]byte(caller + "\x00" + key))
+	return hex.EncodeToString(hash[:])
+}
+
+// responseRecorder copies the response body as it is written.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
+
+func (r *responseRecorder) WriteString(data string) (int, error) {
+	r.body.WriteString(data)
+	return r.ResponseWriter.WriteString(data)
+}
@@ -0,0 +1,318 @@
+package idempotency
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/apperrors"
+)
+
+// newTestRouter serves POST /orders and POST /orders/:id/checkout behind the
+// middleware. Each handler run answers with its run number, after waiting for
+// block when it is set.
+func newTestRouter(t *testing.T, config Config, block chan struct{}) (*gin.Engine, *atomic.Int32) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	// A fresh table for every router, also when the test runs again
+	db, err := sql.Open("idempotency-test", fmt.Sprintf("%s-%d", t.Name(), time.Now().UnixNano()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	var runs atomic.Int32
+	handler := func(c *gin.Context) {
+		n := runs.Add(1)
+		if block != nil {
+			<-block
+		}
+		if c.GetHeader("X-Fail") != "" {
+			c.Error(apperrors.Validation("rejected"))
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"run": n, "path": c.Request.URL.Path})
+	}
+	store := NewStore(db, config)
+	caller := func(c *gin.Context) string { return "user-1" }
+	router := gin.New()
+	router.Use(apperrors.Middleware())
+	router.POST("/orders", store.Middleware(caller), handler)
+	router.POST("/orders/:id/checkout", store.Middleware(caller), handler)
+	return router, &runs
+}
+
+func send(router http.Handler, path, key, body string, header ...string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(Header, key)
+	for i := 0; i+1 < len(header); i += 2 {
+		request.Header.Set(header[i], header[i+1])
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+var testConfig = Config{TTL: time.Hour, Lease: time.Minute}
+
+func TestMiddlewareReplaysStoredResponse(t *testing.T) {
+	router, runs := newTestRouter(t, testConfig, nil)
+
+	first := send(router, "/orders", "key-1", `{"total":10}`)
+	if first.Code != http.StatusCreated {
+		t.Fatalf("first status = %d, body = %s", first.Code, first.Body)
+	}
+	retry := send(router, "/orders", "key-1", `{"total":10}`)
+	if retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() {
+		t.Errorf("retry = %d %s, want the stored %d %s", retry.Code, retry.Body, first.Code, first.Body)
+	}
+	if retry.Header().Get(ReplayedHeader) != "true" {
+		t.Errorf("retry %s header = %q, want true", ReplayedHeader, retry.Header().Get(ReplayedHeader))
+	}
+	if got := runs.Load(); got != 1 {
+		t.Errorf("handler ran %d times, want 1", got)
+	}
+}
+
+func TestMiddlewareRejectsKeyReusedWithDifferentBody(t *testing.T) {
+	router, runs := newTestRouter(t, testConfig, nil)
+
+	send(router, "/orders", "key-1", `{"total":10}`)
+	reused := send(router, "/orders", "key-1", `{"total":99}`)
+	if reused.Code != http.StatusUnprocessableEntity {
+		t.Errorf("status = %d, want 422", reused.Code)
+	}
+	if got := runs.Load(); got != 1 {
+		t.Errorf("handler ran %d times, want 1", got)
+	}
+}
+
+func TestMiddlewareRejectsKeyReusedForAnotherOrder(t *testing.T) {
+	router, runs := newTestRouter(t, testConfig, nil)
+
+	first := send(router, "/orders/order-1/checkout", "key-1", `{"card_token":"tok_visa"}`)
+	if first.Code != http.StatusCreated {
+		t.Fatalf("first status = %d, body = %s", first.Code, first.Body)
+	}
+	// Same route and body, but another order: not a retry of the first
+	other := send(router, "/orders/order-2/checkout", "key-1", `{"card_token":"tok_visa"}`)
+	if other.Code != http.StatusUnprocessableEntity {
+		t.Errorf("status = %d, body = %s, want 422 rather than order-1's response", other.Code, other.Body)
+	}
+	if got := runs.Load(); got != 1 {
+		t.Errorf("handler ran %d times, want 1", got)
+	}
+}
+
+func TestMiddlewareRejectsDuplicateInProgress(t *testing.T) {
+	block := make(chan struct{})
+	router, runs := newTestRouter(t, testConfig, block)
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- send(router, "/orders", "key-1", `{}`) }()
+	waitForRuns(t, runs, 1)
+
+	duplicate := send(router, "/orders", "key-1", `{}`)
+	if duplicate.Code != http.StatusConflict {
+		t.Errorf("duplicate status = %d, want 409", duplicate.Code)
+	}
+	close(block)
+	if first := <-done; first.Code != http.StatusCreated {
+		t.Errorf("first status = %d, want 201", first.Code)
+	}
+	if retry := send(router, "/orders", "key-1", `{}`); retry.Header().Get(ReplayedHeader) != "true" {
+		t.Errorf("retry after the first finished was not replayed: %d %s", retry.Code, retry.Body)
+	}
+	if got := runs.Load(); got != 1 {
+		t.Errorf("handler ran %d times, want 1", got)
+	}
+}
+
+func TestMiddlewareTakesOverAbandonedClaim(t *testing.T) {
+	block := make(chan struct{})
+	router, runs := newTestRouter(t, Config{TTL: time.Hour, Lease: 20 * time.Millisecond}, block)
+
+	abandoned := make(chan *httptest.ResponseRecorder)
+	go func() { abandoned <- send(router, "/orders", "key-1", `{}`) }()
+	waitForRuns(t, runs, 1)
+	time.Sleep(40 * time.Millisecond)
+
+	// The first claim's lease has run out, so the key is taken over
+	takeover := make(chan *httptest.ResponseRecorder)
+	go func() { takeover <- send(router, "/orders", "key-1", `{}`) }()
+	waitForRuns(t, runs, 2)
+	close(block)
+	second := <-takeover
+	if second.Code != http.StatusCreated {
+		t.Fatalf("takeover status = %d, body = %s", second.Code, second.Body)
+	}
+	<-abandoned
+
+	// Only the request holding the claim stores its response
+	replay := send(router, "/orders", "key-1", `{}`)
+	if replay.Body.String() != second.Body.String() {
+		t.Errorf("replay = %s, want the takeover's %s", replay.Body, second.Body)
+	}
+}
+
+func TestMiddlewareReleasesKeyAfterError(t *testing.T) {
+	router, runs := newTestRouter(t, testConfig, nil)
+
+	if failed := send(router, "/orders", "key-1", `{}`, "X-Fail", "1"); failed.Code != http.StatusBadRequest {
+		t.Fatalf("failed status = %d, want 400", failed.Code)
+	}
+	retry := send(router, "/orders", "key-1", `{}`)
+	if retry.Code != http.StatusCreated || retry.Header().Get(ReplayedHeader) != "" {
+		t.Errorf("retry = %d replayed=%q, want a fresh 201", retry.Code, retry.Header().Get(ReplayedHeader))
+	}
+	if got := runs.Load(); got != 2 {
+		t.Errorf("handler ran %d times, want 2", got)
+	}
+}
+
+func waitForRuns(t *testing.T, runs *atomic.Int32, n int32) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for runs.Load() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("handler ran %d times, want %d", runs.Load(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// The stand-in driver keeps the idempotency_keys table in memory, one per
+// DSN, and answers the statements the store runs. Transactions are not
+// isolated; each statement runs atomically.
+func init() {
+	sql.Register("idempotency-test", &keysDriver{tables: map[string]*keysTable{}})
+}
+
+type keysDriver struct {
+	mu     sync.Mutex
+	tables map[string]*keysTable
+}
+
+func (d *keysDriver) Open(dsn string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	table, ok := d.tables[dsn]
+	if !ok {
+		table = &keysTable{rows: map[string]*keyRow{}}
+		d.tables[dsn] = table
+	}
+	return keysConn{table}, nil
+}
+
+type keysTable struct {
+	mu   sync.Mutex
+	rows map[string]*keyRow
+}
+
+type keyRow struct {
+	fingerprint string
+	statusCode  int64
+	contentType string
+	body        []byte
+	createdAt   time.Time
+	claimToken  string
+}
+
+type keysConn struct{ table *keysTable }
+
+func (c keysConn) Prepare(query string) (driver.Stmt, error) { return keysStmt{c.table, query}, nil }
+func (keysConn) Close() error                                { return nil }
+func (keysConn) Begin() (driver.Tx, error)                   { return keysTx{}, nil }
+
+type keysTx struct{}
+
+func (keysTx) Commit() error   { return nil }
+func (keysTx) Rollback() error { return nil }
+
+type keysStmt struct {
+	table *keysTable
+	query string
+}
+
+func (keysStmt) Close() error  { return nil }
+func (keysStmt) NumInput() int { return -1 }
+
+func (s keysStmt) Exec(args []driver.Value) (driver.Result, error) {
+	t := s.table
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	query := strings.Join(strings.Fields(s.query), " ")
+	switch {
+	case strings.HasPrefix(query, "INSERT INTO idempotency_keys"):
+		id := rowID(args[0], args[1])
+		if _, ok := t.rows[id]; ok {
+			return driver.RowsAffected(0), nil
+		}
+		t.rows[id] = &keyRow{fingerprint: args[2].(string), createdAt: args[3].(time.Time), claimToken: args[4].(string)}
+		return driver.RowsAffected(1), nil
+	case strings.HasPrefix(query, "UPDATE idempotency_keys SET fingerprint"):
+		row := t.rows[rowID(args[3], args[4])]
+		row.fingerprint, row.statusCode, row.contentType, row.body = args[0].(string), 0, "", nil
+		row.createdAt, row.claimToken = args[1].(time.Time), args[2].(string)
+		return driver.RowsAffected(1), nil
+	case strings.HasPrefix(query, "UPDATE idempotency_keys SET status_code"):
+		row, ok := t.rows[rowID(args[3], args[4])]
+		if !ok || row.claimToken != args[5].(string) {
+			return driver.RowsAffected(0), nil
+		}
+		row.statusCode, row.contentType, row.body = args[0].(int64), args[1].(string), args[2].([]byte)
+		return driver.RowsAffected(1), nil
+	case strings.HasPrefix(query, "DELETE FROM idempotency_keys"):
+		id := rowID(args[0], args[1])
+		row, ok := t.rows[id]
+		if !ok || row.claimToken != args[2].(string) || row.statusCode != 0 {
+			return driver.RowsAffected(0), nil
+		}
+		delete(t.rows, id)
+		return driver.RowsAffected(1), nil
+	}
+	return nil, fmt.Errorf("unexpected statement %q", query)
+}
+
+func (s keysStmt) Query(args []driver.Value) (driver.Rows, error) {
+	t := s.table
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	row, ok := t.rows[rowID(args[0], args[1])]
+	if !ok {
+		return &keysRows{}, nil
+	}
+	return &keysRows{values: []driver.Value{row.fingerprint, row.statusCode, row.contentType, row.body, row.createdAt}}, nil
+}
+
+type keysRows struct{ values []driver.Value }
+
+func (*keysRows) Columns() []string {
+	return []string{"fingerprint", "status_code", "content_type", "response_body", "created_at"}
+}
+
+func (*keysRows) Close() error { return nil }
+
+func (r *keysRows) Next(dest []driver.Value) error {
+	if r.values == nil {
+		return io.EOF
+	}
+	copy(dest, r.values)
+	r.values = nil
+	return nil
+}
+
+func rowID(key, caller driver.Value) string {
+	return fmt.Sprintf("%v\x00%v", key, caller)
+}
@@ -0,0 +1,99 @@
+// Package lifecycle runs a service's HTTP server until it is asked to stop and
+// then shuts everything down in order.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/config"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/logging"
+)
+
+type Config struct {
+	// ShutdownTimeout bounds the whole shutdown: draining in-flight requests
+	// and running every stop hook.
+	ShutdownTimeout time.Duration
+}
+
+func ConfigFromEnv(env *config.Env) Config {
+	return Config{
+		ShutdownTimeout: env.Duration("SHUTDOWN_TIMEOUT", 15*time.Second),
+	}
+}
+
+type hook struct {
+	name string
+	stop func(context.Context) error
+}
+
+// Lifecycle owns the shutdown sequence of a service.
+type Lifecycle struct {
+	config Config
+	hooks  []hook
+}
+
+func New(config Config) *Lifecycle {
+	return &Lifecycle{config: config}
+}
+
+// OnStop registers a hook to run after the server has drained. Hooks run in
+// reverse registration order, so resources registered first, such as the
+// database pool, are released last.
+func (l *Lifecycle) OnStop(name string, stop func(ctx context.Context) error) {
+	l.hooks = append(l.hooks, hook{name: name, stop: stop})
+}
+
+// Run serves until SIGINT or SIGTERM arrives or the server fails. It then
+// stops accepting connections, waits for in-flight requests and runs the stop
+// hooks, all within ShutdownTimeout. A second signal exits immediately.
+func (l *Lifecycle) Run(server *http.Server) error {
+	ctx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+
+	logger := logging.For("lifecycle")
+	serveErr := make(chan error, 1)
+	logger.Info("Listening", "addr", server.Addr)
+	go func() {
+		serveErr <- server.ListenAndServe()
+	}()
+
+	var err error
+	select {
+	case err = <-serveErr:
+		if errors.Is(err, http.ErrServerClosed) {
+			err = nil
+		}
+		if err != nil {
+			err = fmt.Errorf("server failed: %w", err)
+		}
+	case <-ctx.Done():
+		logger.Info("Shutdown signal received, draining requests", "timeout", l.config.ShutdownTimeout.String())
+	}
+	// Restore default signal handling so a second signal kills the process
+	stopSignals()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), l.config.ShutdownTimeout)
+	defer cancel()
+
+	if shutdownErr := server.Shutdown(shutdownCtx); shutdownErr != nil {
+		logger.Error("HTTP server did not drain cleanly", "error", shutdownErr)
+		err = errors.Join(err, shutdownErr)
+	}
+	for i := len(l.hooks) - 1; i >= 0; i-- {
+		hook := l.hooks[i]
+		if hookErr := hook.stop(shutdownCtx); hookErr != nil {
+			logger.Error("Failed to stop component", "component", hook.name, "error", hookErr)
+			err = errors.Join(err, fmt.Errorf("stop %s: %w", hook.name, hookErr))
+		}
+	}
+
+	logger.Info("Shutdown complete")
+	return err
+}
@@ -0,0 +1,85 @@
+package logging
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/apperrors"
+)
+
+// Route templates for reading and changing log levels at runtime. Services
+// mount them behind their own access policy, normally admin only.
+const (
+	LevelsPath      = "/admin/log-levels"
+	LoggerLevelPath = "/admin/log-levels/:logger"
+)
+
+type setLevelRequest struct {
+	Level string `json:"level" binding:"required"`
+}
+
+// Middleware writes one access log line per request through the http logger,
+// after the error renderer has set the final status.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		started := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		For("http").InfoContext(c.Request.Context(), "Request handled",
+			"method", c.Request.Method,
+			"route", route,
+			"path", c.Request.URL.Path,
+			"status", c.Writer.Status(),
+			"bytes", c.Writer.Size(),
+			"duration_ms", time.Since(started).Milliseconds(),
+			"client_ip", c.ClientIP(),
+		)
+	}
+}
+
+// RegisterRoutes mounts the log level routes on routes:
+//
+//	GET    /admin/log-levels          default level and per-logger overrides
+//	PUT    /admin/log-levels/:logger  {"level": "debug"}; "default" sets the default
+//	DELETE /admin/log-levels/:logger  make the logger follow the default again
+func RegisterRoutes(routes gin.IRoutes) {
+	routes.GET(LevelsPath, getLevels)
+	routes.PUT(LoggerLevelPath, setLevel)
+	routes.DELETE(LoggerLevelPath, unsetLevel)
+}
+
+func getLevels(c *gin.Context) {
+	c.JSON(http.StatusOK, levels.snapshot())
+}
+
+func setLevel(c *gin.Context) {
+	var req setLevelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperrors.InvalidRequest(err))
+		return
+	}
+	level, err := ParseLevel(req.Level)
+	if err != nil {
+		c.Error(apperrors.Validation("level " + err.Error()))
+		return
+	}
+
+	levels.set(c.Param("logger"), level)
+	For("").InfoContext(c.Request.Context(), "Log level changed", "target", c.Param("logger"), "level", levelName(level))
+	c.JSON(http.StatusOK, levels.snapshot())
+}
+
+func unsetLevel(c *gin.Context) {
+	if c.Param("logger") == DefaultLogger {
+		c.Error(apperrors.Validation("the default level can be changed but not removed"))
+		return
+	}
+
+	levels.unset(c.Param("logger"))
+	c.JSON(http.StatusOK, levels.snapshot())
+}
@@ -0,0 +1,81 @@
+package logging
+
+import (
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// DefaultLogger names the level applied to loggers without an override in
+// the log level routes.
+const DefaultLogger = "default"
+
+var levels = &levelTable{overrides: map[string]slog.Level{}}
+
+// levelTable holds the default level and per-logger overrides. It is read on
+// every log call and written only by Setup and the log level routes.
+type levelTable struct {
+	mu        sync.RWMutex
+	root      slog.Level
+	overrides map[string]slog.Level
+}
+
+func (t *levelTable) Level(name string) slog.Level {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if level, ok := t.overrides[name]; ok {
+		return level
+	}
+	return t.root
+}
+
+func (t *levelTable) reset(root slog.Level, overrides map[string]slog.Level) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.root = root
+	t.overrides = make(map[string]slog.Level, len(overrides))
+	for name, level := range overrides {
+		t.overrides[name] = level
+	}
+}
+
+// set changes one logger's level, or the default level for DefaultLogger.
+func (t *levelTable) set(name string, level slog.Level) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if name == DefaultLogger {
+		t.root = level
+		return
+	}
+	t.overrides[name] = level
+}
+
+// unset makes a logger follow the default level again.
+func (t *levelTable) unset(name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.overrides, name)
+}
+
+// LevelsResponse lists the default level and every override.
+type LevelsResponse struct {
+	Default string            `json:"default"`
+	Loggers map[string]string `json:"loggers"`
+}
+
+func (t *levelTable) snapshot() LevelsResponse {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	response := LevelsResponse{
+		Default: levelName(t.root),
+		Loggers: make(map[string]string, len(t.overrides)),
+	}
+	for name, level := range t.overrides {
+		response.Loggers[name] = levelName(level)
+	}
+	return response
+}
+
+func levelName(level slog.Level) string {
+	return strings.ToLower(level.String())
+}
@@ -0,0 +1,194 @@
+// Package logging writes structured JSON logs through log/slog. Every line
+// carries the service name, the logger it came from and, when logged with a
+// request context, the request and trace IDs.
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/config"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/redact"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/requestid"
+)
+
+type Config struct {
+	// Level applies to every logger without an entry in Levels.
+	Level slog.Level
+	// Levels overrides the level of individual loggers, keyed by the name
+	// passed to For.
+	Levels map[string]slog.Level
+	// Redact lists the secrets masked in every log line.
+	Redact redact.Config
+}
+
+// ConfigFromEnv reads LOG_LEVEL, LOG_LEVELS, a comma separated list of
+// logger=level pairs such as "database=debug,http=warn", and the REDACT_*
+// variables.
+func ConfigFromEnv(env *config.Env) Config {
+	cfg := Config{
+		Level:  slog.LevelInfo,
+		Levels: map[string]slog.Level{},
+		Redact: redact.ConfigFromEnv(env),
+	}
+
+	if value := env.String("LOG_LEVEL", ""); value != "" {
+		level, err := ParseLevel(value)
+		if err != nil {
+			env.Errorf("LOG_LEVEL %v", err)
+		} else {
+			cfg.Level = level
+		}
+	}
+
+	for _, pair := range strings.Split(env.String("LOG_LEVELS", ""), ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, value, found := strings.Cut(pair, "=")
+		if !found || strings.TrimSpace(name) == "" {
+			env.Errorf("LOG_LEVELS entries must look like logger=level, got %q", pair)
+			continue
+		}
+		level, err := ParseLevel(value)
+		if err != nil {
+			env.Errorf("LOG_LEVELS %v", err)
+			continue
+		}
+		cfg.Levels[strings.TrimSpace(name)] = level
+	}
+	return cfg
+}
+
+// ParseLevel accepts debug, info, warn or error in any case.
+func ParseLevel(value string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(value))); err != nil {
+		return 0, fmt.Errorf("must be one of debug, info, warn or error, got %q", value)
+	}
+	return level, nil
+}
+
+// output is the JSON handler every logger writes through. It is replaced by
+// Setup, so loggers should be created with For after Setup has run.
+var output atomic.Pointer[slog.Handler]
+
+func init() {
+	setOutput(os.Stdout, "")
+}
+
+func setOutput(w io.Writer, service string) {
+	var h slog.Handler = slog.NewJSONHandler(w, &slog.HandlerOptions{
+		// Filtering happens in handler.Enabled against the per-logger levels
+		Level:       slog.LevelDebug - 4,
+		ReplaceAttr: redactAttr,
+	})
+	if service != "" {
+		h = h.WithAttrs([]slog.Attr{slog.String("service", service)})
+	}
+	output.Store(&h)
+}
+
+// Setup sends every log line to stdout as JSON tagged with service, applies
+// the configured levels and makes the default slog logger, and therefore the
+// standard log package, use the same output. It also installs the configured
+// redactor as redact.Default, which masks secrets in every line. Call it first
+// in main.
+func Setup(service string, config Config) {
+	redact.SetDefault(redact.New(config.Redact))
+	setOutput(os.Stdout, service)
+	levels.reset(config.Level, config.Levels)
+	slog.SetDefault(For(""))
+
+	// gin prints its route table and warnings as plain text in debug mode
+	if os.Getenv(gin.EnvGinMode) == "" {
+		gin.SetMode(gin.ReleaseMode)
+	}
+}
+
+// redactAttr masks attributes named after a secret field or header and scrubs
+// secrets from string, error, header and body values.
+func redactAttr(groups []string, attr slog.Attr) slog.Attr {
+	r := redact.Default()
+	if r.Field(append(groups[:len(groups):len(groups)], attr.Key)) || r.Header(attr.Key) {
+		return slog.String(attr.Key, redact.Mask)
+	}
+
+	switch attr.Value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, r.Text(attr.Value.String()))
+	case slog.KindAny:
+		switch value := attr.Value.Any().(type) {
+		case error:
+			return slog.String(attr.Key, r.Text(value.Error()))
+		case http.Header:
+			return slog.Any(attr.Key, r.Headers(value))
+		case json.RawMessage:
+			return slog.Any(attr.Key, json.RawMessage(r.JSON(value)))
+		case []byte:
+			return slog.String(attr.Key, string(r.JSON(value)))
+		case fmt.Stringer:
+			return slog.String(attr.Key, r.Text(value.String()))
+		}
+	}
+	return attr
+}
+
+// For returns the logger called name. Its level can be changed at runtime
+// through the log level routes. The empty name is the default logger.
+func For(name string) *slog.Logger {
+	out := *output.Load()
+	if name != "" {
+		out = out.WithAttrs([]slog.Attr{slog.String("logger", name)})
+	}
+	return slog.New(&handler{name: name, out: out})
+}
+
+// Fatal logs msg with err at error level through the default logger and exits.
+func Fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// handler applies the named logger's level and adds request and trace IDs
+// from the context.
+type handler struct {
+	name string
+	out  slog.Handler
+}
+
+func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= levels.Level(h.name)
+}
+
+func (h *handler) Handle(ctx context.Context, record slog.Record) error {
+	if id := requestid.FromContext(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		record.AddAttrs(
+			slog.String("trace_id", span.TraceID().String()),
+			slog.String("span_id", span.SpanID().String()),
+		)
+	}
+	return h.out.Handle(ctx, record)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &handler{name: h.name, out: h.out.WithAttrs(attrs)}
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return &handler{name: h.name, out: h.out.WithGroup(name)}
+}
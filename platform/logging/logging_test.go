@@ -0,0 +1,156 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/config"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/requestid"
+)
+
+// captureLines sends every log line to a buffer at the given levels for the
+// rest of the test and returns a function decoding what was written.
+func captureLines(t *testing.T, root slog.Level, overrides map[string]slog.Level) func() []map[string]any {
+	t.Helper()
+	var buf bytes.Buffer
+	setOutput(&buf, "order-service")
+	levels.reset(root, overrides)
+	t.Cleanup(func() {
+		setOutput(os.Stdout, "")
+		levels.reset(slog.LevelInfo, nil)
+	})
+	return func() []map[string]any {
+		var lines []map[string]any
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			if line == "" {
+				continue
+			}
+			var decoded map[string]any
+			if err := json.Unmarshal([]byte(line), &decoded); err != nil {
+				t.Fatalf("log line %q is not JSON: %v", line, err)
+			}
+			lines = append(lines, decoded)
+		}
+		return lines
+	}
+}
+
+func TestHandlerAddsRequestAndTraceIDs(t *testing.T) {
+	lines := captureLines(t, slog.LevelInfo, nil)
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := requestid.WithContext(context.Background(), "checkout-42")
+	ctx = trace.ContextWithSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID}))
+
+	For("database").InfoContext(ctx, "Query ran")
+	For("database").Info("Pool opened")
+
+	got := lines()
+	if len(got) != 2 {
+		t.Fatalf("wrote %d lines, want 2", len(got))
+	}
+	want := map[string]any{
+		"service":    "order-service",
+		"logger":     "database",
+		"request_id": "checkout-42",
+		"trace_id":   traceID.String(),
+		"span_id":    spanID.String(),
+	}
+	for key, value := range want {
+		if got[0][key] != value {
+			t.Errorf("%s = %v, want %v", key, got[0][key], value)
+		}
+	}
+	// Without a request context there is nothing to correlate
+	for _, key := range []string{"request_id", "trace_id", "span_id"} {
+		if _, ok := got[1][key]; ok {
+			t.Errorf("line logged without a request has %s", key)
+		}
+	}
+}
+
+func TestPerLoggerLevels(t *testing.T) {
+	lines := captureLines(t, slog.LevelWarn, map[string]slog.Level{"database": slog.LevelDebug})
+
+	For("database").Debug("logged by its override")
+	For("http").Info("below the default")
+	For("").Warn("at the default")
+	levels.set("http", slog.LevelInfo)
+	For("http").Info("logged after the level changed")
+	levels.unset("database")
+	For("database").Debug("below the default again")
+
+	var messages []string
+	for _, line := range lines() {
+		messages = append(messages, line["msg"].(string))
+	}
+	want := []string{"logged by its override", "at the default", "logged after the level changed"}
+	if strings.Join(messages, "|") != strings.Join(want, "|") {
+		t.Errorf("logged %q, want %q", messages, want)
+	}
+}
+
+func TestMiddlewareLogsRouteTemplate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	lines := captureLines(t, slog.LevelInfo, nil)
+	router := gin.New()
+	router.Use(requestid.Middleware(), Middleware())
+	router.GET("/api/orders/:id", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	request := httptest.NewRequest(http.MethodGet, "/api/orders/order-1", nil)
+	request.Header.Set(requestid.Header, "checkout-42")
+	router.ServeHTTP(httptest.NewRecorder(), request)
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/wp-login.php", nil))
+
+	got := lines()
+	if len(got) != 2 {
+		t.Fatalf("wrote %d lines, want 2", len(got))
+	}
+	for i, want := range []map[string]any{
+		{"logger": "http", "route": "/api/orders/:id", "path": "/api/orders/order-1", "status": float64(http.StatusNoContent), "request_id": "checkout-42"},
+		{"logger": "http", "route": "unmatched", "path": "/wp-login.php", "status": float64(http.StatusNotFound)},
+	} {
+		for key, value := range want {
+			if got[i][key] != value {
+				t.Errorf("line %d %s = %v, want %v", i, key, got[i][key], value)
+			}
+		}
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	env := config.FromMap(map[string]string{
+		"LOG_LEVEL":  "WARN",
+		"LOG_LEVELS": " database=debug, http=error ,",
+	})
+	cfg := ConfigFromEnv(env)
+	if err := env.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Level != slog.LevelWarn || cfg.Levels["database"] != slog.LevelDebug || cfg.Levels["http"] != slog.LevelError || len(cfg.Levels) != 2 {
+		t.Errorf("ConfigFromEnv() = %+v", cfg)
+	}
+
+	for _, values := range []map[string]string{
+		{"LOG_LEVEL": "verbose"},
+		{"LOG_LEVELS": "database"},
+		{"LOG_LEVELS": "=debug"},
+		{"LOG_LEVELS": "database=loud"},
+	} {
+		env := config.FromMap(values)
+		ConfigFromEnv(env)
+		if env.Err() == nil {
+			t.Errorf("ConfigFromEnv(%v) accepted an invalid level", values)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+// Package metrics exposes Prometheus metrics with the same names and labels in
+// every service. Each series carries a constant service label.
+package metrics
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/apperrors"
+)
+
+const (
+	OutcomeOK          = "ok"
+	OutcomeClientError = "client_error"
+	OutcomeError       = "error"
+
+	// unmatchedRoute labels requests that did not match any route, keeping
+	// arbitrary paths out of the label set.
+	unmatchedRoute = "unmatched"
+)
+
+// Outbound records calls to other services and third-party APIs.
+type Outbound interface {
+	ObserveOutbound(target, operation string, started time.Time, err error)
+}
+
+type Metrics struct {
+	registry   *prometheus.Registry
+	registerer prometheus.Registerer
+
+	httpRequests    *prometheus.CounterVec
+	httpDuration    *prometheus.HistogramVec
+	httpInFlight    prometheus.Gauge
+	outboundLatency *prometheus.HistogramVec
+}
+
+// New creates a registry for service with Go runtime and process collectors.
+func New(service string) *Metrics {
+	registry := prometheus.NewRegistry()
+	registerer := prometheus.WrapRegistererWith(prometheus.Labels{"service": service}, registry)
+
+	m := &Metrics{
+		registry:   registry,
+		registerer: registerer,
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "HTTP requests handled, by route template and status code.",
+		}, []string{"method", "route", "status"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "HTTP request latency, by route template and status code.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		httpInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "HTTP requests currently being handled.",
+		}),
+		outboundLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "outbound_request_duration_seconds",
+			Help:    "Latency of calls to other services and third-party APIs, by outcome.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"target", "operation", "outcome"}),
+	}
+	registerer.MustRegister(
+		m.httpRequests,
+		m.httpDuration,
+		m.httpInFlight,
+		m.outboundLatency,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// Registerer lets services add their own collectors under the service label.
+func (m *Metrics) Registerer() prometheus.Registerer {
+	return m.registerer
+}
+
+// RegisterDB exports the pool's sql.DBStats as go_sql_* metrics labelled
+// with dbName.
+func (m *Metrics) RegisterDB(db *sql.DB, dbName string) {
+	m.registerer.MustRegister(collectors.NewDBStatsCollector(db, dbName))
+}
+
+// RegisterRoutes mounts the public /metrics endpoint.
+func (m *Metrics) RegisterRoutes(router *gin.Engine) {
+	router.GET("/metrics", gin.WrapH(promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})))
+}
+
+// Middleware records rate, errors and duration per gin route template. It must
+// run outside the error renderer so it sees the final status code.
+func (m *Metrics) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		m.httpInFlight.Inc()
+		started := time.Now()
+		c.Next()
+		m.httpInFlight.Dec()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		labels := prometheus.Labels{
+			"method": c.Request.Method,
+			"route":  route,
+			"status": strconv.Itoa(c.Writer.Status()),
+		}
+		m.httpRequests.With(labels).Inc()
+		m.httpDuration.With(labels).Observe(time.Since(started).Seconds())
+	}
+}
+
+// ObserveOutbound records one outbound call. Errors the caller caused, such as
+// a missing user, count as client_error rather than error.
+func (m *Metrics) ObserveOutbound(target, operation string, started time.Time, err error) {
+	m.outboundLatency.WithLabelValues(target, operation, Outcome(err)).Observe(time.Since(started).Seconds())
+}
+
+func Outcome(err error) string {
+	if err == nil {
+		return OutcomeOK
+	}
+	if apperrors.StatusCode(err) < 500 {
+		return OutcomeClientError
+	}
+	return OutcomeError
+}
@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/apperrors"
+)
+
+// samples returns the value of each series of the named counter or histogram,
+// keyed by its labels in name=value form, histograms by their sample count.
+func samples(t *testing.T, m *Metrics, name string) map[string]float64 {
+	t.Helper()
+	families, err := m.registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	series := make(map[string]float64)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			var key string
+			for _, label := range metric.GetLabel() {
+				key += label.GetName() + "=" + label.GetValue() + " "
+			}
+			if metric.GetHistogram() != nil {
+				series[key] = float64(metric.GetHistogram().GetSampleCount())
+			} else {
+				series[key] = metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return series
+}
+
+func TestMiddlewareLabelsByRouteTemplate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := New("order-service")
+	router := gin.New()
+	router.Use(m.Middleware())
+	router.GET("/api/orders/:id", func(c *gin.Context) {
+		if c.Param("id") == "missing" {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	for _, path := range []string{"/api/orders/order-1", "/api/orders/order-2", "/api/orders/missing", "/wp-login.php", "/.env"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	// Two order IDs share one series, and probes for arbitrary paths share
+	// another, so the label set stays bounded
+	want := map[string]float64{
+		"method=GET route=/api/orders/:id service=order-service status=200 ": 2,
+		"method=GET route=/api/orders/:id service=order-service status=404 ": 1,
+		"method=GET route=unmatched service=order-service status=404 ":       2,
+	}
+	for _, name := range []string{"http_requests_total", "http_request_duration_seconds"} {
+		got := samples(t, m, name)
+		if len(got) != len(want) {
+			t.Errorf("%s series = %v, want %v", name, got, want)
+			continue
+		}
+		for labels, count := range want {
+			if got[labels] != count {
+				t.Errorf("%s{%s} = %v, want %v", name, labels, got[labels], count)
+			}
+		}
+	}
+}
+
+func TestObserveOutbound(t *testing.T) {
+	m := New("order-service")
+	started := time.Now()
+	m.ObserveOutbound("user-service", "validate_user", started, nil)
+	m.ObserveOutbound("user-service", "validate_user", started, apperrors.NotFound("user not found"))
+	m.ObserveOutbound("user-service", "validate_user", started, apperrors.Upstream("failed to call user service", errors.New("connection refused")))
+	m.ObserveOutbound("user-service", "validate_user", started, errors.New("unexpected"))
+
+	got := samples(t, m, "outbound_request_duration_seconds")
+	for outcome, count := range map[string]float64{OutcomeOK: 1, OutcomeClientError: 1, OutcomeError: 2} {
+		labels := "operation=validate_user outcome=" + outcome + " service=order-service target=user-service "
+		if got[labels] != count {
+			t.Errorf("outbound{%s} = %v, want %v", labels, got[labels], count)
+		}
+	}
+}
+
+func TestRegisterRoutesServesMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := New("order-service")
+	router := gin.New()
+	router.Use(m.Middleware())
+	m.RegisterRoutes(router)
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d", recorder.Code)
+	}
+	want := `http_requests_total{method="GET",route="/metrics",service="order-service",status="200"} 1`
+	if !slices.Contains(strings.Split(recorder.Body.String(), "\n"), want) {
+		t.Errorf("/metrics does not contain %s", want)
+	}
+}
@@ -0,0 +1,129 @@
+// Package pagination implements opaque keyset cursors over (created_at, id)
+// for list endpoints that are ordered newest first.
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/apperrors"
+)
+
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+// Cursor identifies the last row of a page. Clients treat it as opaque.
+type Cursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        string    `json:"id"`
+}
+
+func (c Cursor) Encode() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func DecodeCursor(value string) (Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return Cursor{}, apperrors.Validation("cursor is invalid")
+	}
+	var cursor Cursor
+	if err := json.Unmarshal(raw, &cursor); err != nil || cursor.ID == "" {
+		return Cursor{}, apperrors.Validation("cursor is invalid")
+	}
+	return cursor, nil
+}
+
+// Params is the requested page: at most Limit rows strictly after After.
+type Params struct {
+	Limit int
+	After *Cursor
+}
+
+// ParseParams reads the limit and cursor query parameters.
+func ParseParams(c *gin.Context) (Params, error) {
+	params := Params{Limit: DefaultLimit}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > MaxLimit {
+			return Params{}, apperrors.Validation("limit must be between 1 and " + strconv.Itoa(MaxLimit))
+		}
+		params.Limit = limit
+	}
+
+	if value := c.Query("cursor"); value != "" {
+		cursor, err := DecodeCursor(value)
+		if err != nil {
+			return Params{}, err
+		}
+		params.After = &cursor
+	}
+	return params, nil
+}
+
+// Page is the response envelope for list endpoints.
+type Page[T any] struct {
+	Data       []T    `json:"data"`
+	Limit      int    `json:"limit"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	Next       string `json:"next,omitempty"`
+}
+
+// NewPage wraps items, linking to the following page when next is set. The
+// link keeps the request's other query parameters, so filters carry over.
+func NewPage[T any](c *gin.Context, items []T, params Params, next *Cursor) Page[T] {
+	if items == nil {
+		items = []T{}
+	}
+	page := Page[T]{Data: items, Limit: params.Limit}
+	if next == nil {
+		return page
+	}
+
+	page.NextCursor = next.Encode()
+	query := c.Request.URL.Query()
+	query.Set("cursor", page.NextCursor)
+	query.Set("limit", strconv.Itoa(params.Limit))
+	page.Next = (&url.URL{Path: c.Request.URL.Path, RawQuery: query.Encode()}).String()
+	return page
+}
+
+// PrefixPattern builds a LIKE pattern matching values that start with prefix,
+// escaping LIKE wildcards in the prefix itself.
+func PrefixPattern(prefix string) string {
+	escaper := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return escaper.Replace(strings.ToLower(prefix)) + "%"
+}
+
+// ParseTime reads an optional RFC 3339 timestamp query parameter.
+func ParseTime(c *gin.Context, name string) (*time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, apperrors.Validation(name + " must be an RFC 3339 timestamp")
+	}
+	return &parsed, nil
+}
+
+// Trim drops the extra row fetched by Query.Build and returns the cursor for
+// the next page, or nil when this is the last page.
+func Trim[T any](rows []T, params Params, cursorOf func(T) Cursor) ([]T, *Cursor) {
+	if len(rows) <= params.Limit {
+		return rows, nil
+	}
+	rows = rows[:params.Limit]
+	next := cursorOf(rows[len(rows)-1])
+	return rows, &next
+}
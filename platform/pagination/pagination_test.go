@@ -0,0 +1,114 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/apperrors"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	cursor := Cursor{CreatedAt: time.Date(2026, 3, 9, 9, 13, 20, 123456000, time.UTC), ID: "order-7"}
+	decoded, err := DecodeCursor(cursor.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Postgres keeps microseconds, so the cursor must not round them away
+	if !decoded.CreatedAt.Equal(cursor.CreatedAt) || decoded.ID != cursor.ID {
+		t.Errorf("DecodeCursor(Encode()) = %+v, want %+v", decoded, cursor)
+	}
+}
+
+func TestDecodeCursorRejectsInvalidValues(t *testing.T) {
+	valid := Cursor{CreatedAt: time.Now(), ID: "order-7"}.Encode()
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"not base64", "%%%"},
+		{"standard base64 padding", valid + "=="},
+		{"truncated", valid[:len(valid)-4]},
+		{"not JSON", base64.RawURLEncoding.EncodeToString([]byte("order-7"))},
+		{"no ID", base64.RawURLEncoding.EncodeToString([]byte(`{"t":"2026-03-09T09:13:20Z"}`))},
+		{"bad timestamp", base64.RawURLEncoding.EncodeToString([]byte(`{"t":"yesterday","id":"order-7"}`))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeCursor(tt.value); !errors.Is(err, apperrors.ErrValidation) {
+				t.Errorf("DecodeCursor(%q) error = %v, want %v", tt.value, err, apperrors.ErrValidation)
+			}
+		})
+	}
+}
+
+func TestParseParams(t *testing.T) {
+	cursor := Cursor{CreatedAt: time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC), ID: "order-7"}
+	tests := []struct {
+		name      string
+		query     string
+		wantLimit int
+		wantAfter *Cursor
+		wantErr   error
+	}{
+		{"defaults", "", DefaultLimit, nil, nil},
+		{"smallest limit", "limit=1", 1, nil, nil},
+		{"largest limit", "limit=100", MaxLimit, nil, nil},
+		{"zero limit", "limit=0", 0, nil, apperrors.ErrValidation},
+		{"negative limit", "limit=-5", 0, nil, apperrors.ErrValidation},
+		{"limit past the maximum", "limit=101", 0, nil, apperrors.ErrValidation},
+		{"limit not a number", "limit=ten", 0, nil, apperrors.ErrValidation},
+		{"cursor", "cursor=" + cursor.Encode(), DefaultLimit, &cursor, nil},
+		{"tampered cursor", "cursor=" + cursor.Encode() + "x", 0, nil, apperrors.ErrValidation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, err := ParseParams(testContext("/api/orders?" + tt.query))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseParams(%q) error = %v, want %v", tt.query, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if params.Limit != tt.wantLimit {
+				t.Errorf("limit = %d, want %d", params.Limit, tt.wantLimit)
+			}
+			if (params.After == nil) != (tt.wantAfter == nil) || params.After != nil && (params.After.ID != tt.wantAfter.ID || !params.After.CreatedAt.Equal(tt.wantAfter.CreatedAt)) {
+				t.Errorf("after = %+v, want %+v", params.After, tt.wantAfter)
+			}
+		})
+	}
+}
+
+func TestNewPageLinksNextPageWithFilters(t *testing.T) {
+	c := testContext("/api/orders?status=pending&limit=2")
+	next := &Cursor{CreatedAt: time.Now(), ID: "order-2"}
+	page := NewPage(c, []string{"order-1", "order-2"}, Params{Limit: 2}, next)
+
+	if page.NextCursor != next.Encode() {
+		t.Errorf("next_cursor = %q, want %q", page.NextCursor, next.Encode())
+	}
+	link, err := url.Parse(page.Next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := link.Query()
+	if link.Path != "/api/orders" || query.Get("status") != "pending" || query.Get("limit") != "2" || query.Get("cursor") != page.NextCursor {
+		t.Errorf("next = %q, want /api/orders keeping status and limit with the cursor", page.Next)
+	}
+
+	last := NewPage[string](c, nil, Params{Limit: 2}, nil)
+	if last.Data == nil || last.NextCursor != "" || last.Next != "" {
+		t.Errorf("last page = %+v, want empty data and no next link", last)
+	}
+}
+
+func testContext(target string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", target, nil)
+	return c
+}
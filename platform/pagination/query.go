@@ -0,0 +1,37 @@
+package pagination
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Query accumulates WHERE conditions and their positional arguments.
+type Query struct {
+	conditions []string
+	Args       []interface{}
+}
+
+// Where adds a condition. Each "?" in condition is replaced with the next
+// positional parameter.
+func (q *Query) Where(condition string, args ...interface{}) {
+	for _, arg := range args {
+		q.Args = append(q.Args, arg)
+		condition = strings.Replace(condition, "?", fmt.Sprintf("$%d", len(q.Args)), 1)
+	}
+	q.conditions = append(q.conditions, condition)
+}
+
+// Build appends the filters, keyset condition, ordering and limit to base.
+// One extra row is fetched so callers can tell whether another page exists.
+func (q *Query) Build(base string, params Params) string {
+	if params.After != nil {
+		q.Where("(created_at, id) < (?, ?)", params.After.CreatedAt, params.After.ID)
+	}
+
+	query := base
+	if len(q.conditions) > 0 {
+		query += " WHERE " + strings.Join(q.conditions, " AND ")
+	}
+	q.Args = append(q.Args, params.Limit+1)
+	return query + fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT $%d", len(q.Args))
+}
@@ -0,0 +1,115 @@
+package pagination
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestQueryBuild(t *testing.T) {
+	after := Cursor{CreatedAt: time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC), ID: "order-7"}
+	var q Query
+	q.Where("status = ?", "pending")
+	q.Where("created_at BETWEEN ? AND ?", "from", "to")
+	got := q.Build("SELECT id FROM orders", Params{Limit: 20, After: &after})
+
+	want := "SELECT id FROM orders WHERE status = $1 AND created_at BETWEEN $2 AND $3 AND (created_at, id) < ($4, $5) ORDER BY created_at DESC, id DESC LIMIT $6"
+	if got != want {
+		t.Errorf("Build() =\n%s\nwant\n%s", got, want)
+	}
+	wantArgs := fmt.Sprint([]interface{}{"pending", "from", "to", after.CreatedAt, "order-7", 21})
+	if fmt.Sprint(q.Args) != wantArgs {
+		t.Errorf("args = %v, want %v", q.Args, wantArgs)
+	}
+
+	var first Query
+	if got := first.Build("SELECT id FROM orders", Params{Limit: 5}); got != "SELECT id FROM orders ORDER BY created_at DESC, id DESC LIMIT $1" {
+		t.Errorf("Build() without filters = %s", got)
+	}
+}
+
+type row struct {
+	id        string
+	createdAt time.Time
+}
+
+// page answers the query Build produces from rows, the way Postgres would.
+func page(rows []row, params Params) []row {
+	sorted := append([]row(nil), rows...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if !sorted[i].createdAt.Equal(sorted[j].createdAt) {
+			return sorted[i].createdAt.After(sorted[j].createdAt)
+		}
+		return sorted[i].id > sorted[j].id
+	})
+	var matched []row
+	for _, r := range sorted {
+		after := params.After
+		// (created_at, id) < (after.CreatedAt, after.ID)
+		if after == nil || r.createdAt.Before(after.CreatedAt) || r.createdAt.Equal(after.CreatedAt) && r.id < after.ID {
+			matched = append(matched, r)
+		}
+		if len(matched) == params.Limit+1 {
+			break
+		}
+	}
+	return matched
+}
+
+func TestKeysetPagingVisitsTiedRowsOnce(t *testing.T) {
+	// Rows inserted in one transaction share created_at, so only the ID
+	// orders them
+	now := time.Date(2026, 3, 9, 9, 0, 0, 0, time.UTC)
+	var rows []row
+	for i := 0; i < 7; i++ {
+		rows = append(rows, row{id: fmt.Sprintf("order-%d", i), createdAt: now})
+	}
+	rows = append(rows, row{id: "order-newer", createdAt: now.Add(time.Second)}, row{id: "order-older", createdAt: now.Add(-time.Second)})
+
+	seen := make(map[string]int)
+	var order []string
+	params := Params{Limit: 2}
+	for pages := 0; ; pages++ {
+		if pages > len(rows) {
+			t.Fatal("paging did not end")
+		}
+		items, next := Trim(page(rows, params), params, func(r row) Cursor {
+			return Cursor{CreatedAt: r.createdAt, ID: r.id}
+		})
+		for _, r := range items {
+			seen[r.id]++
+			order = append(order, r.id)
+		}
+		if next == nil {
+			break
+		}
+		// The cursor goes through the client and back
+		decoded, err := DecodeCursor(next.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		params.After = &decoded
+	}
+
+	for _, r := range rows {
+		if seen[r.id] != 1 {
+			t.Errorf("%s returned %d times, want once", r.id, seen[r.id])
+		}
+	}
+	if order[0] != "order-newer" || order[len(order)-1] != "order-older" {
+		t.Errorf("order = %v, want newest first", order)
+	}
+}
+
+func TestTrim(t *testing.T) {
+	cursorOf := func(id int) Cursor { return Cursor{ID: fmt.Sprint(id)} }
+	items, next := Trim([]int{1, 2, 3}, Params{Limit: 2}, cursorOf)
+	if len(items) != 2 || next == nil || next.ID != "2" {
+		t.Errorf("Trim() with an extra row = %v, %+v; want [1 2] and a cursor at 2", items, next)
+	}
+	items, next = Trim([]int{1, 2}, Params{Limit: 2}, cursorOf)
+	if len(items) != 2 || next != nil {
+		t.Errorf("Trim() of a last page = %v, %+v; want [1 2] and no cursor", items, next)
+	}
+}
@@ -0,0 +1,101 @@
+package redact_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/apperrors"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/logging"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/redact"
+)
+
+var secrets = []string{"hunter2", "tok_visa_4242", "eyJhbGciOiJSUzI1NiJ9.payload.signature"}
+
+// captureLogs runs fn with every log line going to a temporary file and
+// returns what was written.
+func captureLogs(t *testing.T, fn func()) string {
+	t.Helper()
+	file, err := os.CreateTemp(t.TempDir(), "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = file
+	logging.Setup("redact-test", logging.Config{Level: slog.LevelInfo, Redact: redact.DefaultConfig()})
+	os.Stdout = stdout
+	t.Cleanup(func() {
+		logging.Setup("", logging.Config{Level: slog.LevelInfo, Redact: redact.DefaultConfig()})
+	})
+
+	fn()
+
+	written, err := os.ReadFile(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(written)
+}
+
+func assertRedacted(t *testing.T, logs string) {
+	t.Helper()
+	if logs == "" {
+		t.Fatal("nothing was logged")
+	}
+	for _, secret := range secrets {
+		if strings.Contains(logs, secret) {
+			t.Errorf("log output contains %q:\n%s", secret, logs)
+		}
+	}
+	if !strings.Contains(logs, redact.Mask) {
+		t.Errorf("log output has no %s marker:\n%s", redact.Mask, logs)
+	}
+}
+
+func TestLoggerRedactsSecrets(t *testing.T) {
+	logs := captureLogs(t, func() {
+		logging.For("test").Info("Login attempt",
+			"password", secrets[0],
+			"body", json.RawMessage(`{"email":"ada@example.com","card_token":"`+secrets[1]+`"}`),
+			"headers", http.Header{"Authorization": {"Bearer " + secrets[2]}},
+			"error", errors.New(`gateway rejected {"card_token": "`+secrets[1]+`"}`),
+			"detail", "retrying with password="+secrets[0],
+		)
+	})
+	assertRedacted(t, logs)
+}
+
+func TestAccessLogRedactsSecrets(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logs := captureLogs(t, func() {
+		router := gin.New()
+		router.Use(logging.Middleware())
+		router.Use(apperrors.Middleware())
+		router.POST("/api/payments", func(c *gin.Context) {
+			c.Error(fmt.Errorf("gateway call failed: card_token=%s Authorization: Bearer %s", secrets[1], secrets[2]))
+		})
+
+		body := `{"password":"` + secrets[0] + `","card_token":"` + secrets[1] + `"}`
+		request := httptest.NewRequest(http.MethodPost, "/api/payments?password="+secrets[0], strings.NewReader(body))
+		request.Header.Set("Authorization", "Bearer "+secrets[2])
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+
+		for _, secret := range secrets {
+			if strings.Contains(recorder.Body.String(), secret) {
+				t.Errorf("response contains %q: %s", secret, recorder.Body.String())
+			}
+		}
+	})
+	if !strings.Contains(logs, `"msg":"Request handled"`) {
+		t.Fatalf("no access log line:\n%s", logs)
+	}
+	assertRedacted(t, logs)
+}
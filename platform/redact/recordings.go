@@ -0,0 +1,94 @@
+package redact
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Recording scrubs a Keploy test or mocks file. Header mappings are masked by
+// name, body fields are redacted as JSON and every other string, such as the
+// recorded curl command or a database row, is scrubbed as Text. It reports
+// whether anything changed; unchanged files are returned as they were.
+func (r *Redactor) Recording(data []byte) ([]byte, bool, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	var documents []*yaml.Node
+	for {
+		var document yaml.Node
+		if err := decoder.Decode(&document); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, false, fmt.Errorf("failed to parse recording: %w", err)
+		}
+		documents = append(documents, &document)
+	}
+
+	changed := false
+	for _, document := range documents {
+		if r.node(document, "") {
+			changed = true
+		}
+	}
+	if !changed {
+		return data, false, nil
+	}
+
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(4)
+	for _, document := range documents {
+		if err := encoder.Encode(document); err != nil {
+			return nil, false, fmt.Errorf("failed to write recording: %w", err)
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, false, fmt.Errorf("failed to write recording: %w", err)
+	}
+	return out.Bytes(), true, nil
+}
+
+// node scrubs n, which is the value of key in its parent mapping.
+func (r *Redactor) node(n *yaml.Node, key string) bool {
+	changed := false
+	switch n.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, child := range n.Content {
+			if r.node(child, key) {
+				changed = true
+			}
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			name, value := n.Content[i].Value, n.Content[i+1]
+			if strings.EqualFold(key, "header") && value.Kind == yaml.ScalarNode && r.Header(name) {
+				changed = setScalar(value, Mask) || changed
+				continue
+			}
+			if r.node(value, name) {
+				changed = true
+			}
+		}
+	case yaml.ScalarNode:
+		if n.Tag != "!!str" {
+			return false
+		}
+		if strings.EqualFold(key, "body") {
+			return setScalar(n, string(r.JSON([]byte(n.Value))))
+		}
+		return setScalar(n, r.Text(n.Value))
+	}
+	return changed
+}
+
+func setScalar(n *yaml.Node, value string) bool {
+	if n.Value == value {
+		return false
+	}
+	n.Value = value
+	return true
+}
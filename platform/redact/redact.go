@@ -0,0 +1,347 @@
+// Package redact scrubs secrets such as passwords, card tokens and bearer
+// tokens from JSON bodies, headers and free text before they are logged,
+// returned in error details or stored in traffic recordings.
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/config"
+)
+
+// Mask replaces every redacted value.
+const Mask = "[REDACTED]"
+
+var (
+	// DefaultFields are the request and response fields that carry secrets
+	// in the services' APIs.
+	DefaultFields = []string{"password", "current_password", "new_password", "card_token", "client_secret", "token", "access_token"}
+	// DefaultHeaders carry credentials.
+	DefaultHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+	// EmailFields are added to the fields when emails are redacted.
+	EmailFields = []string{"email", "user_email"}
+)
+
+type Config struct {
+	// Fields are JSON paths whose values are masked. A path is a dot
+	// separated list of keys matched against the end of a value's location,
+	// ignoring array indexes, so "password" matches the key at any depth and
+	// "card.number" only under a card object.
+	Fields []string
+	// Headers are masked by name, case insensitively.
+	Headers []string
+	// Emails masks email fields and any email address in free text.
+	Emails bool
+}
+
+// DefaultConfig redacts DefaultFields and DefaultHeaders but keeps emails.
+func DefaultConfig() Config {
+	return Config{Fields: DefaultFields, Headers: DefaultHeaders}
+}
+
+// ConfigFromEnv adds REDACT_FIELDS and REDACT_HEADERS, comma separated, to the
+// defaults and reads REDACT_EMAILS.
+func ConfigFromEnv(env *config.Env) Config {
+	cfg := DefaultConfig()
+	cfg.Fields = append(append([]string{}, cfg.Fields...), splitList(env.String("REDACT_FIELDS", ""))...)
+	cfg.Headers = append(append([]string{}, cfg.Headers...), splitList(env.String("REDACT_HEADERS", ""))...)
+	cfg.Emails = env.Bool("REDACT_EMAILS", false)
+	return cfg
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+var (
+	emailPattern  = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	bcryptPattern = regexp.MustCompile(`\$2[aby]?\$\d{2}\$[./A-Za-z0-9]{53}`)
+	bearerPattern = regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9\-._~+/]+=*`)
+)
+
+// Redactor applies a Config. It is safe for concurrent use.
+type Redactor struct {
+	fields  [][]string
+	headers map[string]bool
+	emails  bool
+	// text matches "field": value and field=value pairs in free text,
+	// including JSON escaped inside a string, and "Header: value" when the
+	// header starts a line or a quoted string, as in curl's -H 'Header: value'.
+	// A bare name followed by a colon is prose, as in "invalid token: token is
+	// expired", and is left alone.
+	text *regexp.Regexp
+}
+
+func New(config Config) *Redactor {
+	r := &Redactor{headers: make(map[string]bool), emails: config.Emails}
+
+	fields := config.Fields
+	if config.Emails {
+		fields = append(append([]string{}, fields...), EmailFields...)
+	}
+	var names, headers []string
+	for _, field := range fields {
+		path := strings.Split(strings.ToLower(field), ".")
+		r.fields = append(r.fields, path)
+		names = append(names, regexp.QuoteMeta(path[len(path)-1]))
+	}
+	for _, header := range config.Headers {
+		r.headers[strings.ToLower(header)] = true
+		headers = append(headers, regexp.QuoteMeta(strings.ToLower(header)))
+	}
+	names = append(names, headers...)
+	if len(names) > 0 {
+		name := `(?:` + strings.Join(names, "|") + `)`
+		key := `\\?"` + name + `\\?"\s*:\s*|\b` + name + `\s*=\s*`
+		if len(headers) > 0 {
+			key += `|(?:^|\\?['"])(?:` + strings.Join(headers, "|") + `)\s*:\s*`
+		}
+		r.text = regexp.MustCompile(`(?im)(` + key + `)(?:(\\?")(?:[^"\\]|\\[^"])*\\?"|(')[^']*'|(?:(?:bearer|basic)\s+)?[^\s,;&}'"]+)`)
+	}
+	return r
+}
+
+var defaultRedactor atomic.Pointer[Redactor]
+
+func init() {
+	SetDefault(New(DefaultConfig()))
+}
+
+// Default returns the redactor installed by SetDefault, which starts out
+// applying DefaultConfig.
+func Default() *Redactor {
+	return defaultRedactor.Load()
+}
+
+func SetDefault(r *Redactor) {
+	defaultRedactor.Store(r)
+}
+
+// Field reports whether the value at path, a list of JSON keys from the root,
+// must be masked.
+func (r *Redactor) Field(path []string) bool {
+	for _, field := range r.fields {
+		if len(field) > len(path) {
+			continue
+		}
+		offset := len(path) - len(field)
+		matched := true
+		for i, key := range field {
+			if !strings.EqualFold(key, path[offset+i]) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Header reports whether the named header is masked.
+func (r *Redactor) Header(name string) bool {
+	return r.headers[strings.ToLower(name)]
+}
+
+// Headers returns a copy of h with masked header values.
+func (r *Redactor) Headers(h http.Header) http.Header {
+	redacted := make(http.Header, len(h))
+	for name, values := range h {
+		if r.Header(name) {
+			redacted[name] = []string{Mask}
+			continue
+		}
+		redacted[name] = append([]string(nil), values...)
+	}
+	return redacted
+}
+
+// JSON masks the configured fields in a JSON document and scrubs the remaining
+// string values as Text, keeping the document's layout and key order. Bodies
+// that are not JSON are scrubbed as Text, so secrets in form bodies or plain
+// text are still masked.
+func (r *Redactor) JSON(body []byte) []byte {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return body
+	}
+	if !json.Valid(body) {
+		return []byte(r.Text(string(body)))
+	}
+
+	s := &scanner{data: body, redactor: r}
+	s.value(nil)
+	if len(s.edits) == 0 {
+		return body
+	}
+
+	var out bytes.Buffer
+	last := 0
+	for _, e := range s.edits {
+		out.Write(body[last:e.start])
+		out.WriteString(e.replacement)
+		last = e.end
+	}
+	out.Write(body[last:])
+	return out.Bytes()
+}
+
+type edit struct {
+	start, end  int
+	replacement string
+}
+
+// scanner walks a document already checked by json.Valid, recording edits for
+// masked fields and scrubbed strings.
+type scanner struct {
+	data     []byte
+	pos      int
+	redactor *Redactor
+	edits    []edit
+}
+
+var maskedString = strconv.Quote(Mask)
+
+func (s *scanner) skipSpace() {
+	for s.pos < len(s.data) && strings.IndexByte(" \t\r\n", s.data[s.pos]) >= 0 {
+		s.pos++
+	}
+}
+
+func (s *scanner) value(path []string) {
+	s.skipSpace()
+	switch s.data[s.pos] {
+	case '{':
+		s.pos++
+		for {
+			s.skipSpace()
+			if s.data[s.pos] == '}' {
+				s.pos++
+				return
+			}
+			if s.data[s.pos] == ',' {
+				s.pos++
+				continue
+			}
+			key := s.string()
+			s.skipSpace()
+			s.pos++ // colon
+			childPath := append(path[:len(path):len(path)], key)
+			if s.redactor.Field(childPath) {
+				s.skipSpace()
+				start := s.pos
+				s.skip(childPath)
+				s.edits = append(s.edits, edit{start: start, end: s.pos, replacement: maskedString})
+				continue
+			}
+			s.value(childPath)
+		}
+	case '[':
+		s.pos++
+		for {
+			s.skipSpace()
+			if s.data[s.pos] == ']' {
+				s.pos++
+				return
+			}
+			if s.data[s.pos] == ',' {
+				s.pos++
+				continue
+			}
+			s.value(path)
+		}
+	case '"':
+		start := s.pos
+		text := s.string()
+		if redacted := s.redactor.Text(text); redacted != text {
+			s.edits = append(s.edits, edit{start: start, end: s.pos, replacement: quoteJSON(redacted)})
+		}
+	default:
+		for s.pos < len(s.data) && strings.IndexByte(",}] \t\r\n", s.data[s.pos]) < 0 {
+			s.pos++
+		}
+	}
+}
+
+// skip moves past a value without recording edits inside it.
+func (s *scanner) skip(path []string) {
+	edits := len(s.edits)
+	s.value(path)
+	s.edits = s.edits[:edits]
+}
+
+// string reads a string token and returns its decoded value.
+func (s *scanner) string() string {
+	start := s.pos
+	s.pos++
+	for s.data[s.pos] != '"' {
+		if s.data[s.pos] == '\\' {
+			s.pos++
+		}
+		s.pos++
+	}
+	s.pos++
+	var value string
+	json.Unmarshal(s.data[start:s.pos], &value)
+	return value
+}
+
+func quoteJSON(value string) string {
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(value)
+	return strings.TrimSuffix(out.String(), "\n")
+}
+
+// Text masks secrets in free text such as error messages and curl commands:
+// values following a configured field or header name, bearer credentials,
+// bcrypt hashes and, when enabled, email addresses.
+func (r *Redactor) Text(text string) string {
+	text = bearerPattern.ReplaceAllString(text, "${1} "+Mask)
+	if r.text != nil {
+		text = r.maskPairs(text)
+	}
+	text = bcryptPattern.ReplaceAllString(text, Mask)
+	if r.emails {
+		text = emailPattern.ReplaceAllString(text, Mask)
+	}
+	return text
+}
+
+// maskPairs replaces the value of each field or header pair matched by r.text,
+// keeping the quotes around quoted values.
+func (r *Redactor) maskPairs(text string) string {
+	matches := r.text.FindAllStringSubmatchIndex(text, -1)
+	if matches == nil {
+		return text
+	}
+
+	var out strings.Builder
+	last := 0
+	for _, m := range matches {
+		out.WriteString(text[last:m[3]])
+		quote := ""
+		if m[4] >= 0 {
+			quote = text[m[4]:m[5]]
+		} else if m[6] >= 0 {
+			quote = text[m[6]:m[7]]
+		}
+		out.WriteString(quote + Mask + quote)
+		last = m[1]
+	}
+	out.WriteString(text[last:])
+	return out.String()
+}
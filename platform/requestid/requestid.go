@@ -0,0 +1,49 @@
+// Package requestid tags every request with an ID that is echoed in the
+// X-Request-ID response header and in error responses.
+package requestid
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	Header     = "X-Request-ID"
+	contextKey = "request_id"
+	maxLength  = 128
+)
+
+type ctxKey struct{}
+
+// Middleware accepts the caller's X-Request-ID or generates a new one. The ID
+// is also stored on the request context for loggers and outbound clients.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(Header)
+		if id == "" || len(id) > maxLength {
+			id = uuid.New().String()
+		}
+
+		c.Set(contextKey, id)
+		c.Request = c.Request.WithContext(WithContext(c.Request.Context(), id))
+		c.Header(Header, id)
+		c.Next()
+	}
+}
+
+// Get returns the current request's ID.
+func Get(c *gin.Context) string {
+	return c.GetString(contextKey)
+}
+
+func WithContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext returns the request ID carried by ctx, or "" outside a request.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
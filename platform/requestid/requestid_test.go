@@ -0,0 +1,65 @@
+package requestid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name     string
+		incoming string
+		// keep is true when the caller's ID must be used as is; otherwise a
+		// new UUID is expected
+		keep bool
+	}{
+		{"caller's ID", "checkout-42", true},
+		{"longest accepted", strings.Repeat("a", maxLength), true},
+		{"none", "", false},
+		{"too long", strings.Repeat("a", maxLength+1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fromGin, fromContext string
+			router := gin.New()
+			router.Use(Middleware())
+			router.GET("/ping", func(c *gin.Context) {
+				fromGin = Get(c)
+				fromContext = FromContext(c.Request.Context())
+			})
+
+			request := httptest.NewRequest(http.MethodGet, "/ping", nil)
+			if tt.incoming != "" {
+				request.Header.Set(Header, tt.incoming)
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+
+			echoed := recorder.Header().Get(Header)
+			if tt.keep && echoed != tt.incoming {
+				t.Errorf("%s = %q, want the caller's %q", Header, echoed, tt.incoming)
+			}
+			if !tt.keep {
+				if _, err := uuid.Parse(echoed); err != nil {
+					t.Errorf("%s = %q, want a generated UUID", Header, echoed)
+				}
+			}
+			// Handlers, loggers and outbound clients must all see the echoed ID
+			if fromGin != echoed || fromContext != echoed {
+				t.Errorf("Get() = %q, FromContext() = %q, want %q", fromGin, fromContext, echoed)
+			}
+		})
+	}
+}
+
+func TestFromContextOutsideRequest(t *testing.T) {
+	if id := FromContext(httptest.NewRequest(http.MethodGet, "/", nil).Context()); id != "" {
+		t.Errorf("FromContext() = %q, want empty", id)
+	}
+}
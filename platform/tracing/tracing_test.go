@@ -0,0 +1,130 @@
+package tracing
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// exportedSpan is the part of a file exporter line the tests look at.
+type exportedSpan struct {
+	Name        string
+	SpanContext struct{ TraceID, SpanID string }
+	Parent      struct{ TraceID, SpanID string }
+}
+
+func TestMiddlewareAndTransport(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const (
+		traceID      = "4bf92f3577b34da6a3ce929d0e0e4736"
+		remoteSpanID = "00f067aa0ba902b7"
+	)
+	traceFile := filepath.Join(t.TempDir(), "traces.jsonl")
+	shutdown, err := Setup(context.Background(), "order-service", Config{Exporter: ExporterFile, File: traceFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	downstreamTraceparent := make(chan string, 1)
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downstreamTraceparent <- r.Header.Get("traceparent")
+	}))
+	defer downstream.Close()
+	client := &http.Client{Transport: Transport(nil)}
+
+	router := gin.New()
+	router.Use(Middleware("order-service"))
+	router.GET("/api/orders/:id", func(c *gin.Context) {
+		request, _ := http.NewRequestWithContext(c.Request.Context(), http.MethodGet, downstream.URL, nil)
+		response, err := client.Do(request)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		response.Body.Close()
+	})
+	router.GET("/healthz", func(c *gin.Context) {
+		if trace.SpanContextFromContext(c.Request.Context()).IsValid() {
+			t.Error("/healthz was traced")
+		}
+	})
+
+	request := httptest.NewRequest(http.MethodGet, "/api/orders/order-1", nil)
+	request.Header.Set("traceparent", "00-"+traceID+"-"+remoteSpanID+"-01")
+	router.ServeHTTP(httptest.NewRecorder(), request)
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := readSpans(t, traceFile)
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans, want the server and client spans of one request: %+v", len(spans), spans)
+	}
+	var server, outbound exportedSpan
+	for _, span := range spans {
+		if span.Name == "/api/orders/:id" {
+			server = span
+		} else {
+			outbound = span
+		}
+	}
+	if server.SpanContext.TraceID != traceID || server.Parent.SpanID != remoteSpanID {
+		t.Errorf("server span = %+v, want the route template continuing trace %s from span %s", server, traceID, remoteSpanID)
+	}
+	if outbound.Parent.SpanID != server.SpanContext.SpanID {
+		t.Errorf("client span parent = %s, want the server span %s", outbound.Parent.SpanID, server.SpanContext.SpanID)
+	}
+	if got, want := <-downstreamTraceparent, "00-"+traceID+"-"+outbound.SpanContext.SpanID+"-01"; got != want {
+		t.Errorf("downstream traceparent = %q, want %q", got, want)
+	}
+}
+
+func TestSetup(t *testing.T) {
+	shutdown, err := Setup(context.Background(), "order-service", Config{Exporter: ExporterNone})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("shutdown() with exporting off error = %v", err)
+	}
+
+	if _, err := Setup(context.Background(), "order-service", Config{Exporter: "zipkin"}); err == nil {
+		t.Error("Setup() accepted an unsupported exporter")
+	}
+	if _, err := Setup(context.Background(), "order-service", Config{Exporter: ExporterFile, File: filepath.Join(t.TempDir(), "missing", "traces.jsonl")}); err == nil {
+		t.Error("Setup() accepted a trace file it cannot open")
+	}
+}
+
+func readSpans(t *testing.T, path string) []exportedSpan {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var spans []exportedSpan
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var span exportedSpan
+		if err := json.Unmarshal(scanner.Bytes(), &span); err != nil {
+			t.Fatalf("decoding span: %v", err)
+		}
+		spans = append(spans, span)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return spans
+}
@@ -1,59 +1,104 @@
 package main
 
 import (
-	"fmt"
-	"log"
+	"context"
 	"os"
+	"time"
 
-	"github.com/gin-gonic/gin"
-	_ "github.com/lib/pq"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/auth"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/config"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/database"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/health"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/httpserver"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/lifecycle"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/logging"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/metrics"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/tracing"
 	"github.com/robaa12/keploy-ContractTesting-MicroServices/user-service/internal/handlers"
 	"github.com/robaa12/keploy-ContractTesting-MicroServices/user-service/internal/repository"
 	"github.com/robaa12/keploy-ContractTesting-MicroServices/user-service/internal/service"
-	"github.com/robaa12/keploy-ContractTesting-MicroServices/user-service/pkg/database"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/user-service/migrations"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/user-service/pkg/notify"
 )
 
 func main() {
-	dbConfig := database.GetConfigFromEnv()
+	env := config.FromEnv()
+	loggingConfig := logging.ConfigFromEnv(env)
+	dbConfig := database.ConfigFromEnv(env, "user_service")
+	keyConfig := auth.GetKeyConfigFromEnv(env)
+	serviceClients := auth.GetServiceClientsFromEnv(env)
+	notifierConfig := notify.GetConfigFromEnv(env)
+	serverConfig := httpserver.ConfigFromEnv(env, "user-service", "8080")
+	resetTokenTTL := env.Duration("PASSWORD_RESET_TTL", 30*time.Minute)
+	lifecycleConfig := lifecycle.ConfigFromEnv(env)
+	tracingConfig := tracing.ConfigFromEnv(env)
+	logging.Setup("user-service", loggingConfig)
+	if err := env.Err(); err != nil {
+		logging.Fatal("Invalid configuration", err)
+	}
+
+	// Tracing is stopped last so spans from the other shutdown hooks are flushed
+	app := lifecycle.New(lifecycleConfig)
+	shutdownTracing, err := tracing.Setup(context.Background(), serverConfig.Name, tracingConfig)
+	if err != nil {
+		logging.Fatal("Failed to setup tracing", err)
+	}
+	app.OnStop("tracing", shutdownTracing)
 
 	// Connect to database
 	db, err := database.NewPostgresDB(dbConfig)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		logging.Fatal("Failed to connect to database", err)
 	}
-	defer db.Close()
+	serviceMetrics := metrics.New(serverConfig.Name)
+	serviceMetrics.RegisterDB(db, dbConfig.DBName)
+	app.OnStop("database", func(context.Context) error {
+		return db.Close()
+	})
 
-	// Setup database schema
-	if err := database.SetupSchema(db); err != nil {
-		log.Fatalf("Failed to setup database schema: %v", err)
+	// Apply schema migrations, or run the migrate subcommand and exit
+	migrator, err := database.NewMigrator(db, migrations.Files)
+	if err != nil {
+		logging.Fatal("Failed to load migrations", err)
+	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := database.RunMigrateCommand(context.Background(), migrator, os.Args[2:], os.Stdout); err != nil {
+			logging.Fatal("Migration failed", err)
+		}
+		return
+	}
+	if err := database.EnsureSchema(context.Background(), migrator, dbConfig.AutoMigrate); err != nil {
+		logging.Fatal("Failed to prepare database schema", err)
+	}
+
+	// Load token signing keys
+	keys, err := auth.NewKeyManager(keyConfig)
+	if err != nil {
+		logging.Fatal("Failed to load JWT keys", err)
+	}
+
+	// Setup password reset notifications
+	notifier, err := notify.NewNotifier(notifierConfig)
+	if err != nil {
+		logging.Fatal("Failed to setup notifier", err)
 	}
 
 	userRepo := repository.NewPostgresRepository(db)
+	resetTokenRepo := repository.NewPostgresResetTokenRepository(db)
 	userService := service.NewUserService(userRepo)
-	userHandler := handlers.NewUserHandler(userService)
+	passwordService := service.NewPasswordService(userRepo, resetTokenRepo, notifier, resetTokenTTL)
+	userHandler := handlers.NewUserHandler(userService, passwordService, keys, serviceClients)
 
-	// Setup Gin router
-	router := gin.Default()
+	checker := health.NewChecker()
+	checker.Add("database", health.Database(db), health.Options{Timeout: 2 * time.Second, CacheTTL: 2 * time.Second})
 
-	// Add middleware
-	router.Use(gin.Logger())
-	router.Use(gin.Recovery())
-
-	// Register routes
+	router := httpserver.NewRouter(serverConfig, serviceMetrics)
+	checker.RegisterRoutes(router)
+	serviceMetrics.RegisterRoutes(router)
 	userHandler.RegisterRoutes(router)
+	logging.RegisterRoutes(router.Group("", auth.Enforce(keys, handlers.RoutePolicy)))
 
-	// Start the server
-	port := GetEnvOrDefault("PORT", "8080")
-	log.Printf("Server starting on port %s", port)
-	if err := router.Run(fmt.Sprintf(":%s", port)); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
-	}
-}
-
-func GetEnvOrDefault(key, defaultValue string) string {
-	value := os.Getenv(key)
-	if value == "" {
-		return defaultValue
+	if err := app.Run(httpserver.New(serverConfig, router)); err != nil {
+		logging.Fatal("Server stopped with error", err)
 	}
-	return value
 }
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/auth"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/logging"
+)
+
+func TestRoutePolicy(t *testing.T) {
+	const self, other = "user-1", "user-2"
+	callers := map[string]*auth.Identity{
+		"anonymous": nil,
+		"customer":  {UserID: self, Role: auth.RoleCustomer},
+		"support":   {UserID: "support-1", Role: auth.RoleSupport},
+		"admin":     {UserID: "admin-1", Role: auth.RoleAdmin},
+		"service":   {UserID: "order-service", Role: auth.RoleService},
+	}
+	everyone := []string{"anonymous", "customer", "support", "admin", "service"}
+	own := gin.Params{{Key: "id", Value: self}}
+	others := gin.Params{{Key: "id", Value: other}}
+	tests := []struct {
+		method  string
+		path    string
+		params  gin.Params
+		allowed []string
+	}{
+		{http.MethodPost, "/api/auth/login", nil, everyone},
+		{http.MethodPost, "/api/auth/token", nil, everyone},
+		{http.MethodPost, "/api/auth/forgot-password", nil, everyone},
+		{http.MethodPost, "/api/auth/reset-password", nil, everyone},
+		{http.MethodGet, "/.well-known/jwks.json", nil, everyone},
+		{http.MethodPost, "/api/users", nil, everyone},
+		{http.MethodGet, "/api/users", nil, []string{"admin"}},
+		{http.MethodGet, "/api/users/:id", own, []string{"customer", "support", "admin", "service"}},
+		{http.MethodGet, "/api/users/:id", others, []string{"support", "admin", "service"}},
+		// Support can read profiles but not change them
+		{http.MethodPut, "/api/users/:id", own, []string{"customer", "admin"}},
+		{http.MethodPut, "/api/users/:id", others, []string{"admin"}},
+		{http.MethodPatch, "/api/users/:id", own, []string{"customer", "admin"}},
+		{http.MethodPatch, "/api/users/:id", others, []string{"admin"}},
+		// Only the account owner can change a password, not even an admin
+		{http.MethodPut, "/api/users/:id/password", own, []string{"customer"}},
+		{http.MethodPut, "/api/users/:id/password", others, nil},
+		{http.MethodPut, "/api/users/:id/role", own, []string{"admin"}},
+		{http.MethodDelete, "/api/users/:id", own, []string{"admin"}},
+		{http.MethodGet, logging.LevelsPath, nil, []string{"admin"}},
+		{http.MethodPut, logging.LoggerLevelPath, nil, []string{"admin"}},
+		{http.MethodDelete, logging.LoggerLevelPath, nil, []string{"admin"}},
+		// Routes without a rule are denied to everyone
+		{http.MethodGet, "/api/users/:id/password", own, nil},
+	}
+
+	covered := map[string]bool{}
+	for _, tt := range tests {
+		covered[tt.method+" "+tt.path] = true
+		for name, identity := range callers {
+			want := false
+			for _, allowed := range tt.allowed {
+				want = want || allowed == name
+			}
+			err := RoutePolicy.Authorize(tt.method, tt.path, identity, tt.params)
+			if (err == nil) != want {
+				t.Errorf("%s %s %v as %s: error = %v, want allowed = %t", tt.method, tt.path, tt.params, name, err, want)
+			}
+		}
+	}
+	for _, rule := range RoutePolicy {
+		if !covered[rule.Method+" "+rule.Path] {
+			t.Errorf("route %s %s has no test case", rule.Method, rule.Path)
+		}
+	}
+}
@@ -1,28 +1,71 @@
 package handlers
 
 import (
+	"bytes"
+	"encoding/json"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/apperrors"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/auth"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/logging"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/pagination"
 	"github.com/robaa12/keploy-ContractTesting-MicroServices/user-service/internal/models"
 	"github.com/robaa12/keploy-ContractTesting-MicroServices/user-service/internal/service"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/user-service/pkg/mergepatch"
 )
 
 type UserHandler struct {
-	userService service.UserService
+	userService     service.UserService
+	passwordService service.PasswordService
+	keys            *auth.KeyManager
+	clients         auth.ServiceClients
 }
 
-func NewUserHandler(userService service.UserService) *UserHandler {
-	return &UserHandler{userService: userService}
+func NewUserHandler(userService service.UserService, passwordService service.PasswordService, keys *auth.KeyManager, clients auth.ServiceClients) *UserHandler {
+	return &UserHandler{userService: userService, passwordService: passwordService, keys: keys, clients: clients}
+}
+
+// RoutePolicy declares who may call each user route. Customers can only read
+// and edit their own profile; other services can read any.
+var RoutePolicy = auth.Policy{
+	{Method: http.MethodPost, Path: "/api/auth/login", Public: true},
+	{Method: http.MethodPost, Path: "/api/auth/token", Public: true},
+	{Method: http.MethodPost, Path: "/api/auth/forgot-password", Public: true},
+	{Method: http.MethodPost, Path: "/api/auth/reset-password", Public: true},
+	{Method: http.MethodGet, Path: "/.well-known/jwks.json", Public: true},
+	{Method: http.MethodPost, Path: "/api/users", Public: true},
+	{Method: http.MethodGet, Path: "/api/users", Roles: []auth.Role{auth.RoleAdmin}},
+	{Method: http.MethodGet, Path: "/api/users/:id", Roles: []auth.Role{auth.RoleSupport, auth.RoleAdmin, auth.RoleService}, SelfParam: "id"},
+	{Method: http.MethodPut, Path: "/api/users/:id", Roles: []auth.Role{auth.RoleAdmin}, SelfParam: "id"},
+	{Method: http.MethodPatch, Path: "/api/users/:id", Roles: []auth.Role{auth.RoleAdmin}, SelfParam: "id"},
+	{Method: http.MethodPut, Path: "/api/users/:id/password", SelfParam: "id"},
+	{Method: http.MethodPut, Path: "/api/users/:id/role", Roles: []auth.Role{auth.RoleAdmin}},
+	{Method: http.MethodDelete, Path: "/api/users/:id", Roles: []auth.Role{auth.RoleAdmin}},
+	{Method: http.MethodGet, Path: logging.LevelsPath, Roles: []auth.Role{auth.RoleAdmin}},
+	{Method: http.MethodPut, Path: logging.LoggerLevelPath, Roles: []auth.Role{auth.RoleAdmin}},
+	{Method: http.MethodDelete, Path: logging.LoggerLevelPath, Roles: []auth.Role{auth.RoleAdmin}},
 }
 
 func (h *UserHandler) RegisterRoutes(router *gin.Engine) {
-	userGroup := router.Group("/api/users")
+	api := router.Group("", auth.Enforce(h.keys, RoutePolicy))
+	api.POST("/api/auth/login", h.Login)
+	api.POST("/api/auth/token", h.ServiceToken)
+	api.POST("/api/auth/forgot-password", h.ForgotPassword)
+	api.POST("/api/auth/reset-password", h.ResetPassword)
+	api.GET("/.well-known/jwks.json", h.JWKS)
+
+	userGroup := api.Group("/api/users")
 	{
 		userGroup.POST("", h.CreateUser)
 		userGroup.GET("", h.ListUsers)
 		userGroup.GET("/:id", h.GetUser)
 		userGroup.PUT("/:id", h.UpdateUser)
+		userGroup.PATCH("/:id", h.PatchUser)
+		userGroup.PUT("/:id/password", h.ChangePassword)
+		userGroup.PUT("/:id/role", h.UpdateUserRole)
 		userGroup.DELETE("/:id", h.DeleteUser)
 	}
 }
@@ -31,49 +74,236 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 	var request models.CreateUserRequest
 
 	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(apperrors.InvalidRequest(err))
 		return
 	}
 
-	user, err := h.userService.CreateUser(request)
+	user, err := h.userService.CreateUser(c.Request.Context(), request)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
 	c.JSON(http.StatusCreated, user)
 }
 
+func (h *UserHandler) Login(c *gin.Context) {
+	var request models.LoginRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.Error(apperrors.InvalidRequest(err))
+		return
+	}
+
+	user, err := h.userService.Authenticate(c.Request.Context(), request.Email, request.Password)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	token, expiresAt, err := h.keys.Issue(user.ID, user.Email, auth.Role(user.Role))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.LoginResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(time.Until(expiresAt).Seconds()),
+		ExpiresAt:   expiresAt,
+	})
+}
+
+// ServiceToken issues another service a token of its own, with the service
+// role, in exchange for its client credentials.
+func (h *UserHandler) ServiceToken(c *gin.Context) {
+	var request models.ServiceTokenRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.Error(apperrors.InvalidRequest(err))
+		return
+	}
+
+	if !h.clients.Authenticate(request.ClientID, request.ClientSecret) {
+		c.Error(apperrors.Unauthorized("invalid client credentials"))
+		return
+	}
+
+	token, expiresAt, err := h.keys.Issue(request.ClientID, "", auth.RoleService)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.LoginResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(time.Until(expiresAt).Seconds()),
+		ExpiresAt:   expiresAt,
+	})
+}
+
+func (h *UserHandler) ForgotPassword(c *gin.Context) {
+	var request models.ForgotPasswordRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.Error(apperrors.InvalidRequest(err))
+		return
+	}
+
+	if err := h.passwordService.ForgotPassword(c.Request.Context(), request.Email); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "if the account exists, a reset token has been sent"})
+}
+
+func (h *UserHandler) ResetPassword(c *gin.Context) {
+	var request models.ResetPasswordRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.Error(apperrors.InvalidRequest(err))
+		return
+	}
+
+	if err := h.passwordService.ResetPassword(c.Request.Context(), request); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "password reset successfully"})
+}
+
+func (h *UserHandler) ChangePassword(c *gin.Context) {
+	id := c.Param("id")
+	var request models.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.Error(apperrors.InvalidRequest(err))
+		return
+	}
+
+	if err := h.passwordService.ChangePassword(c.Request.Context(), id, request); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "password changed successfully"})
+}
+
+func (h *UserHandler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.keys.JWKS())
+}
+
 func (h *UserHandler) ListUsers(c *gin.Context) {
-	users, err := h.userService.ListUsers()
+	params, err := pagination.ParseParams(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
+	filter := models.UserFilter{
+		EmailPrefix: c.Query("email_prefix"),
+		NamePrefix:  c.Query("name_prefix"),
+	}
 
-	c.JSON(http.StatusOK, users)
+	users, next, err := h.userService.ListUsers(c.Request.Context(), filter, params)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, pagination.NewPage(c, users, params, next))
 }
 
 func (h *UserHandler) UpdateUser(c *gin.Context) {
 	id := c.Param("id")
-	var user models.User
-	if err := c.ShouldBindJSON(&user); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	var request models.UpdateUserRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.Error(apperrors.InvalidRequest(err))
+		return
+	}
+	h.replaceUser(c, id, request)
+}
+
+// PatchUser applies an RFC 7396 merge patch to the user's editable fields and
+// validates the result exactly like a full replace.
+func (h *UserHandler) PatchUser(c *gin.Context) {
+	id := c.Param("id")
+	if contentType := c.ContentType(); contentType != mergepatch.ContentType && contentType != binding.MIMEJSON {
+		c.Error(apperrors.New(apperrors.ErrUnsupportedMediaType, "content type must be "+mergepatch.ContentType))
+		return
+	}
+
+	patch, err := c.GetRawData()
+	if err != nil {
+		c.Error(apperrors.InvalidRequest(err))
+		return
+	}
+
+	current, err := h.userService.GetEditableFields(c.Request.Context(), id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	document, err := json.Marshal(current)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	merged, err := mergepatch.Apply(document, patch)
+	if err != nil {
+		c.Error(apperrors.Validation("request body is not a valid merge patch"))
+		return
+	}
+
+	// Fields outside UpdateUserRequest, such as id or password, cannot be patched
+	var request models.UpdateUserRequest
+	decoder := json.NewDecoder(bytes.NewReader(merged))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		c.Error(apperrors.InvalidRequest(err))
+		return
+	}
+	if err := binding.Validator.ValidateStruct(&request); err != nil {
+		c.Error(apperrors.InvalidRequest(err))
+		return
+	}
+
+	h.replaceUser(c, id, request)
+}
+
+func (h *UserHandler) replaceUser(c *gin.Context, id string, request models.UpdateUserRequest) {
+	updatedUser, err := h.userService.UpdateUser(c.Request.Context(), id, request)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, updatedUser)
+}
+
+func (h *UserHandler) UpdateUserRole(c *gin.Context) {
+	id := c.Param("id")
+	var request models.UpdateRoleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.Error(apperrors.InvalidRequest(err))
 		return
 	}
-	upddatedUser, err := h.userService.UpdateUser(id, user)
+	updatedUser, err := h.userService.UpdateUserRole(c.Request.Context(), id, request.Role)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
-	c.JSON(http.StatusOK, upddatedUser)
+	c.JSON(http.StatusOK, updatedUser)
 }
 
 func (h *UserHandler) GetUser(c *gin.Context) {
 	id := c.Param("id")
-	user, err := h.userService.GetUserByID(id)
+	user, err := h.userService.GetUserByID(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusOK, user)
@@ -81,9 +311,9 @@ func (h *UserHandler) GetUser(c *gin.Context) {
 
 func (h *UserHandler) DeleteUser(c *gin.Context) {
 	id := c.Param("id")
-	err := h.userService.DeleteUser(id)
+	err := h.userService.DeleteUser(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "user deleted successfully"})
@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/apperrors"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/auth"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/httpserver"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/metrics"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/pagination"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/user-service/internal/models"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/user-service/internal/repository"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/user-service/internal/service"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// stubUsers answers from users unless an error is set for the method, which
+// it then fails with the way the Postgres repository would.
+type stubUsers struct {
+	users map[string]models.User
+	errs  map[string]error
+}
+
+func (r stubUsers) CreateUser(ctx context.Context, user models.User) (models.User, error) {
+	return user, r.errs["CreateUser"]
+}
+
+func (r stubUsers) GetUserByID(ctx context.Context, id string) (models.User, error) {
+	if err := r.errs["GetUserByID"]; err != nil {
+		return models.User{}, err
+	}
+	user, ok := r.users[id]
+	if !ok {
+		return models.User{}, apperrors.NotFound("user not found")
+	}
+	return user, nil
+}
+
+func (r stubUsers) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	if err := r.errs["GetUserByEmail"]; err != nil {
+		return models.User{}, err
+	}
+	for _, user := range r.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return models.User{}, apperrors.NotFound("user not found")
+}
+
+func (r stubUsers) ListUsers(ctx context.Context, filter models.UserFilter, params pagination.Params) ([]models.User, error) {
+	return nil, r.errs["ListUsers"]
+}
+
+func (r stubUsers) UpdateUser(ctx context.Context, user models.User) error {
+	return r.errs["UpdateUser"]
+}
+
+func (r stubUsers) UpdatePassword(ctx context.Context, id, passwordHash string) error {
+	return r.errs["UpdatePassword"]
+}
+
+func (r stubUsers) DeleteUser(ctx context.Context, id string) error {
+	return r.errs["DeleteUser"]
+}
+
+type stubResetTokens struct{}
+
+func (stubResetTokens) CreateResetToken(ctx context.Context, token models.PasswordResetToken) error {
+	return nil
+}
+
+func (stubResetTokens) ConsumeResetToken(ctx context.Context, tokenHash string) (string, error) {
+	return "", apperrors.NotFound("reset token not found")
+}
+
+func (stubResetTokens) InvalidateResetTokens(ctx context.Context, userID string) error {
+	return nil
+}
+
+type discardNotifier struct{}
+
+func (discardNotifier) SendPasswordReset(email, token string, expiresAt time.Time) error { return nil }
+
+var (
+	_ repository.UserRepository       = stubUsers{}
+	_ repository.ResetTokenRepository = stubResetTokens{}
+)
+
+func newTestRouter(t *testing.T, errs map[string]error) (*gin.Engine, *auth.KeyManager) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	hash, err := bcrypt.GenerateFromPassword([]byte("right-password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := stubUsers{
+		users: map[string]models.User{
+			"user-1": {ID: "user-1", Name: "Ada", Email: "ada@example.com", Role: "customer", Password: string(hash)},
+			"user-2": {ID: "user-2", Name: "Grace", Email: "grace@example.com", Role: "customer"},
+		},
+		errs: errs,
+	}
+	keys, err := auth.NewKeyManager(auth.KeyConfig{Algorithm: auth.AlgorithmHS256, Secret: strings.Repeat("k", 32)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := service.NewUserService(repo)
+	passwords := service.NewPasswordService(repo, stubResetTokens{}, discardNotifier{}, time.Hour)
+
+	router := httpserver.NewRouter(httpserver.Config{Name: "user-service"}, metrics.New("user-service"))
+	NewUserHandler(users, passwords, keys, nil).RegisterRoutes(router)
+	return router, keys
+}
+
+func TestHandlersMapErrors(t *testing.T) {
+	cause := errors.New("dial tcp 10.0.0.7:5432: connection refused")
+	tests := []struct {
+		name   string
+		as     auth.Role
+		method string
+		path   string
+		body   string
+		errs   map[string]error
+		status int
+		fields []string
+	}{
+		{"found", auth.RoleAdmin, http.MethodGet, "/api/users/user-1", "", nil, http.StatusOK, nil},
+		{"missing row", auth.RoleAdmin, http.MethodGet, "/api/users/user-9", "", map[string]error{"GetUserByID": fmt.Errorf("scan user: %w", sql.ErrNoRows)}, http.StatusNotFound, nil},
+		{"delete missing", auth.RoleAdmin, http.MethodDelete, "/api/users/user-9", "", map[string]error{"DeleteUser": apperrors.NotFound("user not found")}, http.StatusNotFound, nil},
+		{"create", "", http.MethodPost, "/api/users", `{"name":"Linus","email":"linus@example.com","password":"long-enough"}`, nil, http.StatusCreated, nil},
+		{"email taken", "", http.MethodPost, "/api/users", `{"name":"Ada","email":"ada@example.com","password":"long-enough"}`, nil, http.StatusConflict, nil},
+		// Another signup took the email between the check and the insert
+		{"unique violation", "", http.MethodPost, "/api/users", `{"name":"Linus","email":"linus@example.com","password":"long-enough"}`, map[string]error{"CreateUser": repository.ErrDuplicateEmail}, http.StatusConflict, nil},
+		{"invalid body", "", http.MethodPost, "/api/users", `{"name":"Linus","email":"linus","password":"short"}`, nil, http.StatusBadRequest, []string{"email", "password"}},
+		{"malformed body", "", http.MethodPost, "/api/users", `{"name":`, nil, http.StatusBadRequest, nil},
+		{"update to a taken email", auth.RoleAdmin, http.MethodPut, "/api/users/user-1", `{"name":"Ada","email":"grace@example.com"}`, nil, http.StatusConflict, nil},
+		{"update unique violation", auth.RoleAdmin, http.MethodPut, "/api/users/user-1", `{"name":"Ada","email":"ada@new.example.com"}`, map[string]error{"UpdateUser": repository.ErrDuplicateEmail}, http.StatusConflict, nil},
+		{"patch the password", auth.RoleAdmin, http.MethodPatch, "/api/users/user-1", `{"password":"sneaky"}`, nil, http.StatusBadRequest, []string{"password"}},
+		{"unknown role", auth.RoleAdmin, http.MethodPut, "/api/users/user-1/role", `{"role":"root"}`, nil, http.StatusBadRequest, []string{"role"}},
+		{"wrong current password", auth.RoleAdmin, http.MethodPut, "/api/users/user-1/password", `{"current_password":"guess","new_password":"long-enough"}`, nil, http.StatusForbidden, nil},
+		{"spent reset token", "", http.MethodPost, "/api/auth/reset-password", `{"token":"spent","new_password":"long-enough"}`, nil, http.StatusBadRequest, nil},
+		{"database down", auth.RoleAdmin, http.MethodGet, "/api/users", "", map[string]error{"ListUsers": cause}, http.StatusInternalServerError, nil},
+		{"wrong password", "", http.MethodPost, "/api/auth/login", `{"email":"ada@example.com","password":"guess"}`, nil, http.StatusUnauthorized, nil},
+		{"unknown email", "", http.MethodPost, "/api/auth/login", `{"email":"nobody@example.com","password":"guess"}`, nil, http.StatusUnauthorized, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, keys := newTestRouter(t, tt.errs)
+			request := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			request.Header.Set("Content-Type", "application/json")
+			if tt.as != "" {
+				token, _, err := keys.Issue("caller-1", "", tt.as)
+				if err != nil {
+					t.Fatal(err)
+				}
+				request.Header.Set("Authorization", "Bearer "+token)
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != tt.status {
+				t.Fatalf("status = %d, want %d; body = %s", recorder.Code, tt.status, recorder.Body)
+			}
+			if tt.status < http.StatusBadRequest {
+				return
+			}
+			if got := recorder.Header().Get("Content-Type"); got != apperrors.ProblemContentType {
+				t.Errorf("Content-Type = %q, want %q", got, apperrors.ProblemContentType)
+			}
+			var problem apperrors.Problem
+			if err := json.Unmarshal(recorder.Body.Bytes(), &problem); err != nil {
+				t.Fatalf("decoding problem: %v", err)
+			}
+			var fields []string
+			for _, field := range problem.Errors {
+				fields = append(fields, field.Field)
+			}
+			if fmt.Sprint(fields) != fmt.Sprint(tt.fields) {
+				t.Errorf("invalid fields = %v, want %v", fields, tt.fields)
+			}
+			if strings.Contains(recorder.Body.String(), "connection refused") {
+				t.Errorf("response leaks the cause: %s", recorder.Body)
+			}
+		})
+	}
+}
+
+func TestLoginIssuesVerifiableToken(t *testing.T) {
+	router, keys := newTestRouter(t, nil)
+	request := httptest.NewRequest(http.MethodPost, "/api/auth/login", strings.NewReader(`{"email":"ada@example.com","password":"right-password"}`))
+	request.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", recorder.Code, recorder.Body)
+	}
+	var response models.LoginResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.TokenType != "Bearer" || response.ExpiresIn <= 0 {
+		t.Errorf("response = %+v, want a bearer token that has not expired", response)
+	}
+	identity, err := keys.Verify(response.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.UserID != "user-1" || identity.Email != "ada@example.com" || identity.Role != auth.RoleCustomer {
+		t.Errorf("token identity = %+v, want user-1 as customer", identity)
+	}
+}
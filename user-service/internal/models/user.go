@@ -7,6 +7,7 @@ type User struct {
 	Name      string    `json:"name"`
 	Email     string    `json:"email"`
 	Address   string    `json:"address,omitempty"`
+	Role      string    `json:"role"`
 	Password  string    `json:"_"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
@@ -17,10 +18,18 @@ type UserResponse struct {
 	Name      string    `json:"name"`
 	Email     string    `json:"email"`
 	Address   string    `json:"address,omitempty"`
+	Role      string    `json:"role"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// UserFilter narrows ListUsers to users whose email or name starts with a
+// prefix (case-insensitive).
+type UserFilter struct {
+	EmailPrefix string
+	NamePrefix  string
+}
+
 type CreateUserRequest struct {
 	Name     string `json:"name" binding:"required"`
 	Email    string `json:"email" binding:"required,email"`
@@ -28,12 +37,76 @@ type CreateUserRequest struct {
 	Address  string `json:"address"`
 }
 
+// UpdateUserRequest holds every editable profile field. PUT replaces all of
+// them and PATCH is validated against it after the merge patch is applied.
+type UpdateUserRequest struct {
+	Name    string `json:"name" binding:"required"`
+	Email   string `json:"email" binding:"required,email"`
+	Address string `json:"address,omitempty"`
+}
+
+type UpdateRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=customer support admin"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=9"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=9"`
+}
+
+// PasswordResetToken is stored with only a hash of the token sent to the user.
+type PasswordResetToken struct {
+	ID        string
+	UserID    string
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+type LoginRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+}
+
+// ServiceTokenRequest is another service asking for a token of its own with
+// its client credentials.
+type ServiceTokenRequest struct {
+	ClientID     string `json:"client_id" binding:"required"`
+	ClientSecret string `json:"client_secret" binding:"required"`
+}
+
+type LoginResponse struct {
+	AccessToken string    `json:"access_token"`
+	TokenType   string    `json:"token_type"`
+	ExpiresIn   int64     `json:"expires_in"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+func (u User) ToUpdateUserRequest() UpdateUserRequest {
+	return UpdateUserRequest{
+		Name:    u.Name,
+		Email:   u.Email,
+		Address: u.Address,
+	}
+}
+
 func (u User) ToUserResponse() UserResponse {
 	return UserResponse{
 		ID:        u.ID,
 		Name:      u.Name,
 		Email:     u.Email,
 		Address:   u.Address,
+		Role:      u.Role,
 		CreatedAt: u.CreatedAt,
 		UpdatedAt: u.UpdatedAt,
 	}
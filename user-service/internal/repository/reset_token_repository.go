@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/apperrors"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/user-service/internal/models"
+)
+
+type ResetTokenRepository interface {
+	CreateResetToken(ctx context.Context, token models.PasswordResetToken) error
+	ConsumeResetToken(ctx context.Context, tokenHash string) (string, error)
+	InvalidateResetTokens(ctx context.Context, userID string) error
+}
+
+type PostgresResetTokenRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresResetTokenRepository(db *sql.DB) *PostgresResetTokenRepository {
+	return &PostgresResetTokenRepository{
+		db: db,
+	}
+}
+
+func (r *PostgresResetTokenRepository) CreateResetToken(ctx context.Context, token models.PasswordResetToken) error {
+	query := `INSERT INTO password_reset_tokens (id, user_id, token_hash, expires_at, created_at) VALUES ($1, $2, $3, $4, $5)`
+
+	if token.ID == "" {
+		token.ID = uuid.New().String()
+	}
+	token.CreatedAt = time.Now()
+
+	_, err := r.db.ExecContext(ctx, query, token.ID, token.UserID, token.TokenHash, token.ExpiresAt, token.CreatedAt)
+	return err
+}
+
+// ConsumeResetToken marks an unused, unexpired token as used and returns its
+// user ID. The single UPDATE makes concurrent redemptions of the same token safe.
+func (r *PostgresResetTokenRepository) ConsumeResetToken(ctx context.Context, tokenHash string) (string, error) {
+	query := `UPDATE password_reset_tokens SET used_at = $1 WHERE token_hash = $2 AND used_at IS NULL AND expires_at > $1 RETURNING user_id`
+
+	var userID string
+	err := r.db.QueryRowContext(ctx, query, time.Now(), tokenHash).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", apperrors.NotFound("reset token not found")
+		}
+		return "", err
+	}
+	return userID, nil
+}
+
+func (r *PostgresResetTokenRepository) InvalidateResetTokens(ctx context.Context, userID string) error {
+	query := `UPDATE password_reset_tokens SET used_at = $1 WHERE user_id = $2 AND used_at IS NULL`
+
+	_, err := r.db.ExecContext(ctx, query, time.Now(), userID)
+	return err
+}
@@ -1,21 +1,30 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/apperrors"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/pagination"
 	"github.com/robaa12/keploy-ContractTesting-MicroServices/user-service/internal/models"
 )
 
+var ErrDuplicateEmail = apperrors.Conflict("user with that email already exists")
+
 type UserRepository interface {
-	CreateUser(user models.User) (models.User, error)
-	GetUserByID(id string) (models.User, error)
-	GetUserByEmail(email string) (models.User, error)
-	ListUsers() ([]models.User, error)
-	UpdateUser(user models.User) error
-	DeleteUser(id string) error
+	CreateUser(ctx context.Context, user models.User) (models.User, error)
+	GetUserByID(ctx context.Context, id string) (models.User, error)
+	GetUserByEmail(ctx context.Context, email string) (models.User, error)
+	ListUsers(ctx context.Context, filter models.UserFilter, params pagination.Params) ([]models.User, error)
+	// UpdateUser writes the user's profile and role. The password is left
+	// alone so that a stale copy of the user cannot undo a password change.
+	UpdateUser(ctx context.Context, user models.User) error
+	UpdatePassword(ctx context.Context, id, passwordHash string) error
+	DeleteUser(ctx context.Context, id string) error
 }
 
 type PostgresUserRepository struct {
@@ -28,8 +37,8 @@ func NewPostgresRepository(db *sql.DB) *PostgresUserRepository {
 	}
 }
 
-func (r *PostgresUserRepository) CreateUser(user models.User) (models.User, error) {
-	query := `INSERT INTO users (id, name, email, address, password, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, name, email, address, password,created_at, updated_at`
+func (r *PostgresUserRepository) CreateUser(ctx context.Context, user models.User) (models.User, error) {
+	query := `INSERT INTO users (id, name, email, address, role, password, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, name, email, address, role, password, created_at, updated_at`
 
 	// Generate UUID if not provided
 	if user.ID == "" {
@@ -39,45 +48,57 @@ func (r *PostgresUserRepository) CreateUser(user models.User) (models.User, erro
 	user.CreatedAt = now
 	user.UpdatedAt = now
 
-	err := r.db.QueryRow(query, user.ID, user.Name, user.Email, user.Address, user.Password, user.CreatedAt, user.UpdatedAt).Scan(&user.ID, &user.Name, &user.Email, &user.Address, &user.Password, &user.CreatedAt, &user.UpdatedAt)
+	err := r.db.QueryRowContext(ctx, query, user.ID, user.Name, user.Email, user.Address, user.Role, user.Password, user.CreatedAt, user.UpdatedAt).Scan(&user.ID, &user.Name, &user.Email, &user.Address, &user.Role, &user.Password, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
+		if isUniqueViolation(err) {
+			return models.User{}, ErrDuplicateEmail
+		}
 		return models.User{}, err
 	}
 	return user, nil
 }
 
-func (r *PostgresUserRepository) GetUserByID(id string) (models.User, error) {
-	query := `SELECT id, name, email, address, password, created_at, updated_at FROM users WHERE id = $1`
+func (r *PostgresUserRepository) GetUserByID(ctx context.Context, id string) (models.User, error) {
+	query := `SELECT id, name, email, address, role, password, created_at, updated_at FROM users WHERE id = $1`
 	var user models.User
-	err := r.db.QueryRow(query, id).Scan(&user.ID, &user.Name, &user.Email, &user.Address, &user.Password, &user.CreatedAt, &user.UpdatedAt)
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&user.ID, &user.Name, &user.Email, &user.Address, &user.Role, &user.Password, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return models.User{}, errors.New("user not found")
+			return models.User{}, apperrors.NotFound("user not found")
 		}
 		return models.User{}, err
 	}
 	return user, nil
 }
 
-func (r *PostgresUserRepository) GetUserByEmail(email string) (models.User, error) {
-	query := `SELECT id, name, email, address, password, created_at, updated_at FROM users WHERE email = $1`
+func (r *PostgresUserRepository) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	query := `SELECT id, name, email, address, role, password, created_at, updated_at FROM users WHERE email = $1`
 
 	var user models.User
-	err := r.db.QueryRow(query, email).Scan(&user.ID, &user.Name, &user.Email, &user.Address, &user.Password, &user.CreatedAt, &user.UpdatedAt)
+	err := r.db.QueryRowContext(ctx, query, email).Scan(&user.ID, &user.Name, &user.Email, &user.Address, &user.Role, &user.Password, &user.CreatedAt, &user.UpdatedAt)
 
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return models.User{}, errors.New("user not found")
+			return models.User{}, apperrors.NotFound("user not found")
 		}
 		return models.User{}, err
 	}
 	return user, nil
 }
 
-func (r *PostgresUserRepository) ListUsers() ([]models.User, error) {
-	query := `SELECT id, name, email, address, password, created_at, updated_at FROM users`
+// ListUsers returns one page of users, newest first. It fetches one row more
+// than params.Limit so the caller can tell whether there is a next page.
+func (r *PostgresUserRepository) ListUsers(ctx context.Context, filter models.UserFilter, params pagination.Params) ([]models.User, error) {
+	var builder pagination.Query
+	if filter.EmailPrefix != "" {
+		builder.Where("lower(email) LIKE ?", pagination.PrefixPattern(filter.EmailPrefix))
+	}
+	if filter.NamePrefix != "" {
+		builder.Where("lower(name) LIKE ?", pagination.PrefixPattern(filter.NamePrefix))
+	}
+	query := builder.Build(`SELECT id, name, email, address, role, password, created_at, updated_at FROM users`, params)
 
-	rows, err := r.db.Query(query)
+	rows, err := r.db.QueryContext(ctx, query, builder.Args...)
 	if err != nil {
 		return nil, err
 	}
@@ -86,7 +107,7 @@ func (r *PostgresUserRepository) ListUsers() ([]models.User, error) {
 	var users []models.User
 	for rows.Next() {
 		var user models.User
-		if err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.Address, &user.Password, &user.CreatedAt, &user.UpdatedAt); err != nil {
+		if err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.Address, &user.Role, &user.Password, &user.CreatedAt, &user.UpdatedAt); err != nil {
 			return nil, err
 		}
 		users = append(users, user)
@@ -97,13 +118,16 @@ func (r *PostgresUserRepository) ListUsers() ([]models.User, error) {
 	return users, nil
 }
 
-func (r *PostgresUserRepository) UpdateUser(user models.User) error {
-	query := `UPDATE users SET name = $1, email = $2, address = $3, password = $4, updated_at = $5 WHERE id = $6`
+func (r *PostgresUserRepository) UpdateUser(ctx context.Context, user models.User) error {
+	query := `UPDATE users SET name = $1, email = $2, address = $3, role = $4, updated_at = $5 WHERE id = $6`
 
 	user.UpdatedAt = time.Now()
 
-	result, err := r.db.Exec(query, user.Name, user.Email, user.Address, user.Password, user.UpdatedAt, user.ID)
+	result, err := r.db.ExecContext(ctx, query, user.Name, user.Email, user.Address, user.Role, user.UpdatedAt, user.ID)
 	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrDuplicateEmail
+		}
 		return err
 	}
 
@@ -112,16 +136,34 @@ func (r *PostgresUserRepository) UpdateUser(user models.User) error {
 		return err
 	}
 	if rowsAffected == 0 {
-		return errors.New("user not found")
+		return apperrors.NotFound("user not found")
 	}
 
 	return nil
 }
 
-func (r *PostgresUserRepository) DeleteUser(id string) error {
+func (r *PostgresUserRepository) UpdatePassword(ctx context.Context, id, passwordHash string) error {
+	query := `UPDATE users SET password = $1, updated_at = $2 WHERE id = $3`
+
+	result, err := r.db.ExecContext(ctx, query, passwordHash, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return apperrors.NotFound("user not found")
+	}
+	return nil
+}
+
+func (r *PostgresUserRepository) DeleteUser(ctx context.Context, id string) error {
 	query := `DELETE FROM users WHERE id = $1`
 
-	result, err := r.db.Exec(query, id)
+	result, err := r.db.ExecContext(ctx, query, id)
 	if err != nil {
 		return err
 	}
@@ -132,7 +174,12 @@ func (r *PostgresUserRepository) DeleteUser(id string) error {
 	}
 
 	if rowsAffected == 0 {
-		return errors.New("user not found")
+		return apperrors.NotFound("user not found")
 	}
 	return nil
 }
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/apperrors"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/logging"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/user-service/internal/models"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/user-service/internal/repository"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/user-service/pkg/notify"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrIncorrectPassword = apperrors.Forbidden("current password is incorrect")
+	ErrInvalidResetToken = apperrors.Validation("reset token is invalid or has expired")
+)
+
+type PasswordService struct {
+	repo     repository.UserRepository
+	tokens   repository.ResetTokenRepository
+	notifier notify.Notifier
+	tokenTTL time.Duration
+}
+
+func NewPasswordService(repo repository.UserRepository, tokens repository.ResetTokenRepository, notifier notify.Notifier, tokenTTL time.Duration) PasswordService {
+	return PasswordService{
+		repo:     repo,
+		tokens:   tokens,
+		notifier: notifier,
+		tokenTTL: tokenTTL,
+	}
+}
+
+func (s *PasswordService) ChangePassword(ctx context.Context, id string, request models.ChangePasswordRequest) error {
+	user, err := s.repo.GetUserByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(request.CurrentPassword)); err != nil {
+		return ErrIncorrectPassword
+	}
+
+	return s.setPassword(ctx, user.ID, request.NewPassword)
+}
+
+// ForgotPassword issues a reset token for the account, if there is one. It
+// reports success for unknown emails so callers cannot probe for accounts.
+func (s *PasswordService) ForgotPassword(ctx context.Context, email string) error {
+	user, err := s.repo.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, apperrors.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	expiresAt := time.Now().Add(s.tokenTTL)
+
+	err = s.tokens.CreateResetToken(ctx, models.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: hashResetToken(token),
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Delivery failures are logged rather than returned so the response is the
+	// same whether or not the account exists
+	if err := s.notifier.SendPasswordReset(user.Email, token, expiresAt); err != nil {
+		logging.For("password").ErrorContext(ctx, "Failed to send password reset", "user_id", user.ID, "error", err)
+	}
+	return nil
+}
+
+func (s *PasswordService) ResetPassword(ctx context.Context, request models.ResetPasswordRequest) error {
+	userID, err := s.tokens.ConsumeResetToken(ctx, hashResetToken(request.Token))
+	if err != nil {
+		if errors.Is(err, apperrors.ErrNotFound) {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+	return s.setPassword(ctx, userID, request.NewPassword)
+}
+
+// setPassword stores the new password and revokes the user's reset links.
+// Access tokens already issued are not revoked: the other services verify
+// them on their own, so they stay valid until they expire (JWT_TTL).
+func (s *PasswordService) setPassword(ctx context.Context, userID, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.UpdatePassword(ctx, userID, string(hashedPassword)); err != nil {
+		return err
+	}
+
+	// Any outstanding reset links stop working once the password changes
+	return s.tokens.InvalidateResetTokens(ctx, userID)
+}
+
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/user-service/internal/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// sentResets records the reset tokens the password service sends.
+type sentResets struct {
+	tokens map[string][]string
+}
+
+func (n *sentResets) SendPasswordReset(email, token string, expiresAt time.Time) error {
+	if n.tokens == nil {
+		n.tokens = make(map[string][]string)
+	}
+	n.tokens[email] = append(n.tokens[email], token)
+	return nil
+}
+
+func (n *sentResets) last(t *testing.T, email string) string {
+	t.Helper()
+	tokens := n.tokens[email]
+	if len(tokens) == 0 {
+		t.Fatalf("no reset token was sent to %s", email)
+	}
+	return tokens[len(tokens)-1]
+}
+
+type passwordWorld struct {
+	users     *memoryUsers
+	tokens    *memoryResetTokens
+	sent      *sentResets
+	passwords PasswordService
+	accounts  UserService
+}
+
+func newPasswordWorld(t *testing.T, tokenTTL time.Duration) *passwordWorld {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte("old-password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &passwordWorld{
+		users: newMemoryUsers(models.User{
+			ID:       "user-1",
+			Name:     "Ada",
+			Email:    "ada@example.com",
+			Role:     "customer",
+			Password: string(hash),
+		}),
+		tokens: newMemoryResetTokens(),
+		sent:   &sentResets{},
+	}
+	w.passwords = NewPasswordService(w.users, w.tokens, w.sent, tokenTTL)
+	w.accounts = NewUserService(w.users)
+	return w
+}
+
+// loginWorks reports whether password logs the user in.
+func (w *passwordWorld) loginWorks(t *testing.T, password string) bool {
+	t.Helper()
+	_, err := w.accounts.Authenticate(context.Background(), "ada@example.com", password)
+	if err != nil && !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatal(err)
+	}
+	return err == nil
+}
+
+func TestChangePassword(t *testing.T) {
+	ctx := context.Background()
+	w := newPasswordWorld(t, time.Hour)
+
+	wrong := models.ChangePasswordRequest{CurrentPassword: "guess", NewPassword: "new-password"}
+	if err := w.passwords.ChangePassword(ctx, "user-1", wrong); !errors.Is(err, ErrIncorrectPassword) {
+		t.Fatalf("ChangePassword with the wrong current password error = %v, want %v", err, ErrIncorrectPassword)
+	}
+	if !w.loginWorks(t, "old-password") {
+		t.Fatal("a rejected change replaced the password")
+	}
+
+	if err := w.passwords.ForgotPassword(ctx, "ada@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	outstanding := w.sent.last(t, "ada@example.com")
+
+	change := models.ChangePasswordRequest{CurrentPassword: "old-password", NewPassword: "new-password"}
+	if err := w.passwords.ChangePassword(ctx, "user-1", change); err != nil {
+		t.Fatal(err)
+	}
+	if w.loginWorks(t, "old-password") || !w.loginWorks(t, "new-password") {
+		t.Error("after the change only the new password should log in")
+	}
+
+	// A reset link sent before the change no longer works
+	reset := models.ResetPasswordRequest{Token: outstanding, NewPassword: "third-password"}
+	if err := w.passwords.ResetPassword(ctx, reset); !errors.Is(err, ErrInvalidResetToken) {
+		t.Errorf("ResetPassword with a token sent before the change error = %v, want %v", err, ErrInvalidResetToken)
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	ctx := context.Background()
+	w := newPasswordWorld(t, time.Hour)
+
+	if err := w.passwords.ForgotPassword(ctx, "ada@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	token := w.sent.last(t, "ada@example.com")
+	for _, stored := range w.tokens.tokens {
+		if stored.TokenHash == token {
+			t.Fatal("the reset token was stored in the clear")
+		}
+	}
+
+	if err := w.passwords.ResetPassword(ctx, models.ResetPasswordRequest{Token: token, NewPassword: "new-password"}); err != nil {
+		t.Fatal(err)
+	}
+	if w.loginWorks(t, "old-password") || !w.loginWorks(t, "new-password") {
+		t.Error("after the reset only the new password should log in")
+	}
+
+	// Each token resets the password once
+	again := models.ResetPasswordRequest{Token: token, NewPassword: "third-password"}
+	if err := w.passwords.ResetPassword(ctx, again); !errors.Is(err, ErrInvalidResetToken) {
+		t.Errorf("second ResetPassword error = %v, want %v", err, ErrInvalidResetToken)
+	}
+	if !w.loginWorks(t, "new-password") {
+		t.Error("a reused token replaced the password")
+	}
+}
+
+func TestResetPasswordRejectsExpiredAndUnknownTokens(t *testing.T) {
+	ctx := context.Background()
+	w := newPasswordWorld(t, -time.Second)
+
+	if err := w.passwords.ForgotPassword(ctx, "ada@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	expired := w.sent.last(t, "ada@example.com")
+	for _, token := range []string{expired, "made-up"} {
+		request := models.ResetPasswordRequest{Token: token, NewPassword: "new-password"}
+		if err := w.passwords.ResetPassword(ctx, request); !errors.Is(err, ErrInvalidResetToken) {
+			t.Errorf("ResetPassword(%s) error = %v, want %v", token, err, ErrInvalidResetToken)
+		}
+	}
+	if !w.loginWorks(t, "old-password") {
+		t.Error("a rejected token replaced the password")
+	}
+}
+
+func TestForgotPasswordForUnknownEmail(t *testing.T) {
+	w := newPasswordWorld(t, time.Hour)
+
+	if err := w.passwords.ForgotPassword(context.Background(), "nobody@example.com"); err != nil {
+		t.Errorf("ForgotPassword for an unknown email error = %v, want nil", err)
+	}
+	if len(w.sent.tokens) != 0 || len(w.tokens.tokens) != 0 {
+		t.Error("a reset token was issued for an unknown email")
+	}
+}
+
+// staleUsers answers reads with the user as they were before the password
+// changed, like a profile or role update that read the user first.
+type staleUsers struct {
+	*memoryUsers
+	stale models.User
+}
+
+func (r staleUsers) GetUserByID(ctx context.Context, id string) (models.User, error) {
+	return r.stale, nil
+}
+
+func TestProfileUpdateKeepsConcurrentPasswordReset(t *testing.T) {
+	ctx := context.Background()
+	w := newPasswordWorld(t, time.Hour)
+	before, err := w.users.GetUserByID(ctx, "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.passwords.ForgotPassword(ctx, "ada@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	reset := models.ResetPasswordRequest{Token: w.sent.last(t, "ada@example.com"), NewPassword: "new-password"}
+	if err := w.passwords.ResetPassword(ctx, reset); err != nil {
+		t.Fatal(err)
+	}
+
+	accounts := NewUserService(staleUsers{w.users, before})
+	if _, err := accounts.UpdateUserRole(ctx, "user-1", "support"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := accounts.UpdateUser(ctx, "user-1", models.UpdateUserRequest{Name: "Ada L.", Email: "ada@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if !w.loginWorks(t, "new-password") {
+		t.Error("a profile update written from a stale read undid the password reset")
+	}
+}
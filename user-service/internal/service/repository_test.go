@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/apperrors"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/pagination"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/user-service/internal/models"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/user-service/internal/repository"
+)
+
+// memoryUsers keeps users in a map and writes the same columns as the
+// Postgres repository does.
+type memoryUsers struct {
+	mu    sync.Mutex
+	users map[string]models.User
+}
+
+var _ repository.UserRepository = (*memoryUsers)(nil)
+
+func newMemoryUsers(users ...models.User) *memoryUsers {
+	r := &memoryUsers{users: make(map[string]models.User)}
+	for _, user := range users {
+		r.users[user.ID] = user
+	}
+	return r
+}
+
+func (r *memoryUsers) CreateUser(ctx context.Context, user models.User) (models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.users {
+		if existing.Email == user.Email {
+			return models.User{}, repository.ErrDuplicateEmail
+		}
+	}
+	r.users[user.ID] = user
+	return user, nil
+}
+
+func (r *memoryUsers) GetUserByID(ctx context.Context, id string) (models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[id]
+	if !ok {
+		return models.User{}, apperrors.NotFound("user not found")
+	}
+	return user, nil
+}
+
+func (r *memoryUsers) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, user := range r.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return models.User{}, apperrors.NotFound("user not found")
+}
+
+func (r *memoryUsers) ListUsers(ctx context.Context, filter models.UserFilter, params pagination.Params) ([]models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var users []models.User
+	for _, user := range r.users {
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+func (r *memoryUsers) UpdateUser(ctx context.Context, user models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing, ok := r.users[user.ID]
+	if !ok {
+		return apperrors.NotFound("user not found")
+	}
+	existing.Name, existing.Email, existing.Address, existing.Role = user.Name, user.Email, user.Address, user.Role
+	existing.UpdatedAt = time.Now()
+	r.users[user.ID] = existing
+	return nil
+}
+
+func (r *memoryUsers) UpdatePassword(ctx context.Context, id, passwordHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[id]
+	if !ok {
+		return apperrors.NotFound("user not found")
+	}
+	user.Password = passwordHash
+	user.UpdatedAt = time.Now()
+	r.users[id] = user
+	return nil
+}
+
+func (r *memoryUsers) DeleteUser(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.users[id]; !ok {
+		return apperrors.NotFound("user not found")
+	}
+	delete(r.users, id)
+	return nil
+}
+
+// memoryResetTokens keeps reset tokens in a map and redeems them under the
+// same conditions as the Postgres repository's UPDATE.
+type memoryResetTokens struct {
+	mu     sync.Mutex
+	tokens map[string]models.PasswordResetToken
+}
+
+var _ repository.ResetTokenRepository = (*memoryResetTokens)(nil)
+
+func newMemoryResetTokens() *memoryResetTokens {
+	return &memoryResetTokens{tokens: make(map[string]models.PasswordResetToken)}
+}
+
+func (r *memoryResetTokens) CreateResetToken(ctx context.Context, token models.PasswordResetToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	token.CreatedAt = time.Now()
+	r.tokens[token.TokenHash] = token
+	return nil
+}
+
+func (r *memoryResetTokens) ConsumeResetToken(ctx context.Context, tokenHash string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	token, ok := r.tokens[tokenHash]
+	if !ok || token.UsedAt != nil || !token.ExpiresAt.After(now) {
+		return "", apperrors.NotFound("reset token not found")
+	}
+	token.UsedAt = &now
+	r.tokens[tokenHash] = token
+	return token.UserID, nil
+}
+
+func (r *memoryResetTokens) InvalidateResetTokens(ctx context.Context, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	for hash, token := range r.tokens {
+		if token.UserID == userID && token.UsedAt == nil {
+			token.UsedAt = &now
+			r.tokens[hash] = token
+		}
+	}
+	return nil
+}
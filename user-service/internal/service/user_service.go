@@ -1,24 +1,43 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/apperrors"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/auth"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/pagination"
 	"github.com/robaa12/keploy-ContractTesting-MicroServices/user-service/internal/models"
 	"github.com/robaa12/keploy-ContractTesting-MicroServices/user-service/internal/repository"
 	"golang.org/x/crypto/bcrypt"
 )
 
+var (
+	ErrInvalidCredentials = apperrors.Unauthorized("invalid email or password")
+	ErrEmailTaken         = apperrors.Conflict("user with that email already exists")
+)
+
+// dummyPasswordHash is compared against when the email is unknown, so a login
+// takes as long whether or not the account exists.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("no such account"), bcrypt.DefaultCost)
+
 type UserServiceInterface interface {
-	CreateUser(request models.CreateUserRequest) (models.UserResponse, error)
-	GetUserByID(id string) (models.UserResponse, error)
-	GetUserByEmail(email string) (models.UserResponse, error)
-	ListUsers() ([]models.UserResponse, error)
-	UpdateUser(id string, userData models.User) (models.UserResponse, error)
-	DeleteUser(id string) error
+	CreateUser(ctx context.Context, request models.CreateUserRequest) (models.UserResponse, error)
+	Authenticate(ctx context.Context, email, password string) (models.UserResponse, error)
+	GetUserByID(ctx context.Context, id string) (models.UserResponse, error)
+	GetUserByEmail(ctx context.Context, email string) (models.UserResponse, error)
+	ListUsers(ctx context.Context, filter models.UserFilter, params pagination.Params) ([]models.UserResponse, *pagination.Cursor, error)
+	UpdateUser(ctx context.Context, id string, request models.UpdateUserRequest) (models.UserResponse, error)
+	GetEditableFields(ctx context.Context, id string) (models.UpdateUserRequest, error)
+	UpdateUserRole(ctx context.Context, id string, role string) (models.UserResponse, error)
+	DeleteUser(ctx context.Context, id string) error
 }
 
+var _ UserServiceInterface = (*UserService)(nil)
+
 type UserService struct {
 	repo repository.UserRepository
 }
@@ -29,11 +48,11 @@ func NewUserService(repo repository.UserRepository) UserService {
 	}
 }
 
-func (s *UserService) CreateUser(request models.CreateUserRequest) (models.UserResponse, error) {
+func (s *UserService) CreateUser(ctx context.Context, request models.CreateUserRequest) (models.UserResponse, error) {
 	// Check if user with that email already exists
-	_, err := s.repo.GetUserByEmail(request.Email)
+	_, err := s.repo.GetUserByEmail(ctx, request.Email)
 	if err == nil {
-		return models.UserResponse{}, errors.New("user with that email already exists")
+		return models.UserResponse{}, ErrEmailTaken
 	}
 
 	// Hash the password
@@ -48,74 +67,141 @@ func (s *UserService) CreateUser(request models.CreateUserRequest) (models.UserR
 		Email:     request.Email,
 		Password:  string(hashedPassword),
 		Address:   request.Address,
+		Role:      string(auth.RoleCustomer),
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
 
-	createdUser, err := s.repo.CreateUser(user)
+	createdUser, err := s.repo.CreateUser(ctx, user)
 	if err != nil {
+		if errors.Is(err, repository.ErrDuplicateEmail) {
+			return models.UserResponse{}, ErrEmailTaken
+		}
 		return models.UserResponse{}, err
 	}
 	return createdUser.ToUserResponse(), nil
 }
 
-func (s *UserService) GetUserByID(id string) (models.UserResponse, error) {
-	user, err := s.repo.GetUserByID(id)
+func (s *UserService) Authenticate(ctx context.Context, email, password string) (models.UserResponse, error) {
+	user, err := s.repo.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, apperrors.ErrNotFound) {
+			bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+			return models.UserResponse{}, ErrInvalidCredentials
+		}
+		return models.UserResponse{}, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return models.UserResponse{}, ErrInvalidCredentials
+	}
+	return user.ToUserResponse(), nil
+}
+
+func (s *UserService) GetUserByID(ctx context.Context, id string) (models.UserResponse, error) {
+	user, err := s.repo.GetUserByID(ctx, id)
 	if err != nil {
 		return models.UserResponse{}, err
 	}
 	return user.ToUserResponse(), nil
 }
 
-func (s *UserService) GetUserByEmail(email string) (models.UserResponse, error) {
-	user, err := s.repo.GetUserByEmail(email)
+func (s *UserService) GetUserByEmail(ctx context.Context, email string) (models.UserResponse, error) {
+	user, err := s.repo.GetUserByEmail(ctx, email)
 	if err != nil {
 		return models.UserResponse{}, err
 	}
 	return user.ToUserResponse(), nil
 }
 
-func (s *UserService) ListUsers() ([]models.UserResponse, error) {
-	users, err := s.repo.ListUsers()
+func (s *UserService) ListUsers(ctx context.Context, filter models.UserFilter, params pagination.Params) ([]models.UserResponse, *pagination.Cursor, error) {
+	users, err := s.repo.ListUsers(ctx, filter, params)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
+	users, next := pagination.Trim(users, params, func(user models.User) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: user.CreatedAt, ID: user.ID}
+	})
+
 	var userResponses []models.UserResponse
 	for _, user := range users {
 		userResponses = append(userResponses, user.ToUserResponse())
 	}
-	return userResponses, nil
+	return userResponses, next, nil
 }
 
-func (s *UserService) UpdateUser(id string, userData models.User) (models.UserResponse, error) {
+// UpdateUser replaces every editable field of the user. Changing the email
+// checks that no other account already uses it.
+func (s *UserService) UpdateUser(ctx context.Context, id string, request models.UpdateUserRequest) (models.UserResponse, error) {
 	// Get the user from the database
-	existingUser, err := s.repo.GetUserByID(id)
+	existingUser, err := s.repo.GetUserByID(ctx, id)
 	if err != nil {
 		return models.UserResponse{}, err
 	}
 
+	if !strings.EqualFold(existingUser.Email, request.Email) {
+		owner, err := s.repo.GetUserByEmail(ctx, request.Email)
+		if err == nil && owner.ID != id {
+			return models.UserResponse{}, ErrEmailTaken
+		}
+		if err != nil && !errors.Is(err, apperrors.ErrNotFound) {
+			return models.UserResponse{}, err
+		}
+	}
+
 	// Update fields
-	existingUser.Name = userData.Name
-	existingUser.Email = userData.Email
-	existingUser.Address = userData.Address
+	existingUser.Name = request.Name
+	existingUser.Email = request.Email
+	existingUser.Address = request.Address
 	existingUser.UpdatedAt = time.Now()
 
 	// Save the updated user
-	err = s.repo.UpdateUser(existingUser)
+	err = s.repo.UpdateUser(ctx, existingUser)
 	if err != nil {
+		if errors.Is(err, repository.ErrDuplicateEmail) {
+			return models.UserResponse{}, ErrEmailTaken
+		}
 		return models.UserResponse{}, err
 	}
 
 	// Get the updated user
-	updatedUser, err := s.repo.GetUserByID(id)
+	updatedUser, err := s.repo.GetUserByID(ctx, id)
+	if err != nil {
+		return models.UserResponse{}, err
+	}
+
+	return updatedUser.ToUserResponse(), nil
+}
+
+// GetEditableFields returns the user's current editable fields, the document a
+// merge patch is applied to.
+func (s *UserService) GetEditableFields(ctx context.Context, id string) (models.UpdateUserRequest, error) {
+	user, err := s.repo.GetUserByID(ctx, id)
+	if err != nil {
+		return models.UpdateUserRequest{}, err
+	}
+	return user.ToUpdateUserRequest(), nil
+}
+
+func (s *UserService) UpdateUserRole(ctx context.Context, id string, role string) (models.UserResponse, error) {
+	user, err := s.repo.GetUserByID(ctx, id)
 	if err != nil {
 		return models.UserResponse{}, err
 	}
 
+	user.Role = role
+	if err := s.repo.UpdateUser(ctx, user); err != nil {
+		return models.UserResponse{}, err
+	}
+
+	updatedUser, err := s.repo.GetUserByID(ctx, id)
+	if err != nil {
+		return models.UserResponse{}, err
+	}
 	return updatedUser.ToUserResponse(), nil
 }
 
-func (s *UserService) DeleteUser(id string) error {
-	return s.repo.DeleteUser(id)
+func (s *UserService) DeleteUser(ctx context.Context, id string) error {
+	return s.repo.DeleteUser(ctx, id)
 }
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/user-service/internal/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAuthenticate(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("right-password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := NewUserService(newMemoryUsers(models.User{
+		ID:       "user-1",
+		Email:    "ada@example.com",
+		Role:     "support",
+		Password: string(hash),
+	}))
+
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		wantErr  error
+	}{
+		{"right password", "ada@example.com", "right-password", nil},
+		{"wrong password", "ada@example.com", "wrong-password", ErrInvalidCredentials},
+		// Unknown emails get the same answer, so logins cannot probe for accounts
+		{"unknown email", "nobody@example.com", "right-password", ErrInvalidCredentials},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := users.Authenticate(context.Background(), tt.email, tt.password)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Authenticate() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (user.ID != "user-1" || user.Role != "support") {
+				t.Errorf("Authenticate() = %+v, want user-1 as support", user)
+			}
+		})
+	}
+}
+
+func TestAuthenticateUnknownEmailTakesAsLongAsWrongPassword(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("right-password"), bcrypt.DefaultCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := NewUserService(newMemoryUsers(models.User{ID: "user-1", Email: "ada@example.com", Password: string(hash)}))
+
+	elapsed := func(email string) time.Duration {
+		start := time.Now()
+		if _, err := users.Authenticate(context.Background(), email, "wrong-password"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("Authenticate(%s) error = %v, want %v", email, err, ErrInvalidCredentials)
+		}
+		return time.Since(start)
+	}
+	known, unknown := elapsed("ada@example.com"), elapsed("nobody@example.com")
+	// Both run one bcrypt comparison at the default cost; without it the
+	// unknown email would answer thousands of times faster
+	if unknown < known/4 {
+		t.Errorf("unknown email answered in %s, wrong password in %s", unknown, known)
+	}
+}
@@ -0,0 +1,9 @@
+// Package migrations embeds the versioned SQL schema changes for this service.
+// Files are named NNNN_name.up.sql and NNNN_name.down.sql and are applied in
+// version order by database.Migrator.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var Files embed.FS
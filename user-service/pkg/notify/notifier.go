@@ -0,0 +1,87 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/config"
+	"github.com/robaa12/keploy-ContractTesting-MicroServices/platform/logging"
+)
+
+// Notifier delivers password reset tokens to users. Production deployments
+// plug in an email or SMS sender; the log and file notifiers are for local dev.
+type Notifier interface {
+	SendPasswordReset(email, token string, expiresAt time.Time) error
+}
+
+type Config struct {
+	Kind string
+	File string
+}
+
+func GetConfigFromEnv(env *config.Env) Config {
+	return Config{
+		Kind: env.String("NOTIFIER", "log"),
+		File: env.String("NOTIFIER_FILE", "notifications.jsonl"),
+	}
+}
+
+func NewNotifier(config Config) (Notifier, error) {
+	switch config.Kind {
+	case "log":
+		return LogNotifier{}, nil
+	case "file":
+		return NewFileNotifier(config.File), nil
+	default:
+		return nil, fmt.Errorf("unsupported notifier %q", config.Kind)
+	}
+}
+
+// LogNotifier records reset requests in the service log. The token is masked
+// there like any other secret, so use FileNotifier to read tokens locally.
+type LogNotifier struct{}
+
+func (LogNotifier) SendPasswordReset(email, token string, expiresAt time.Time) error {
+	logging.For("notify").Info("Password reset requested", "email", email, "token", token, "expires_at", expiresAt.Format(time.RFC3339))
+	return nil
+}
+
+// FileNotifier appends one JSON line per notification to a file.
+type FileNotifier struct {
+	path string
+	mu   sync.Mutex
+}
+
+type fileNotification struct {
+	Kind      string    `json:"kind"`
+	Email     string    `json:"email"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	SentAt    time.Time `json:"sent_at"`
+}
+
+func NewFileNotifier(path string) *FileNotifier {
+	return &FileNotifier{path: path}
+}
+
+func (n *FileNotifier) SendPasswordReset(email, token string, expiresAt time.Time) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	file, err := os.OpenFile(n.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open notification file: %w", err)
+	}
+	defer file.Close()
+
+	return json.NewEncoder(file).Encode(fileNotification{
+		Kind:      "password_reset",
+		Email:     email,
+		Token:     token,
+		ExpiresAt: expiresAt,
+		SentAt:    time.Now(),
+	})
+}